@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Lines of org_creation.log understood by the analyzer: JSON objects, see
+// logEntry, or lines of the format before JSON logging
+var (
+	logLine     = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) (?:\S+\.go:\d+: )?(.*)$`)
+	logCreated  = regexp.MustCompile(`^Successfully created organization \S+ in (\S+)$`)
+	logElapsed  = regexp.MustCompile(`^Total time taken to create all organizations: (\S+)$`)
+	logDeadline = regexp.MustCompile(`^Organization creation stopped after its deadline of (\S+):`)
+)
+
+// Fields of a JSON log line read by the analyzer
+type logEntry struct {
+	Time    time.Time     `json:"time"`
+	Msg     string        `json:"msg"`
+	Op      string        `json:"op"`
+	Latency time.Duration `json:"latency"` // Nanoseconds
+}
+
+// Organization creations found in a log line
+const (
+	lineOther = iota
+	lineCreated
+	lineFailed
+)
+
+// Kind of a line of the format before JSON logging, and the creation time
+// of a created organization
+func legacyLine(msg string) (int, time.Duration) {
+	if m := logCreated.FindStringSubmatch(msg); m != nil {
+		if d, err := time.ParseDuration(m[1]); err == nil {
+			return lineCreated, d
+		}
+	}
+	if strings.HasPrefix(msg, "Failed to create organization ") {
+		return lineFailed, 0
+	}
+	return lineOther, 0
+}
+
+// Kind of a JSON line, and the creation time of a created organization
+func entryLine(e logEntry) (int, time.Duration) {
+	switch {
+	case e.Op != "Create Organization":
+		return lineOther, 0
+	case e.Msg == "request succeeded":
+		return lineCreated, e.Latency
+	case e.Msg == "request failed":
+		return lineFailed, 0
+	}
+	return lineOther, 0
+}
+
+// One run found in a log
+type loggedRun struct {
+	started, last time.Time
+	summary       runSummary
+	totalDuration time.Duration // Sum of the creation times of the created organizations
+	finished      bool          // The summary of the run was logged
+}
+
+// Add one log line to the run
+func (r *loggedRun) add(at time.Time, msg string, kind int, d time.Duration) {
+	if r.started.IsZero() {
+		r.started = at
+	}
+	r.last = at
+
+	switch {
+	case kind == lineCreated:
+		r.summary.createdOrgs++
+		r.totalDuration += d
+	case kind == lineFailed:
+		r.summary.failedOrgs++
+	case logElapsed.MatchString(msg):
+		r.summary.totalElapsed, _ = time.ParseDuration(logElapsed.FindStringSubmatch(msg)[1])
+	case strings.HasPrefix(msg, "Total organizations created: "):
+		r.finished = true
+	case strings.HasPrefix(msg, "Organization creation interrupted"):
+		r.summary.stopped = context.Canceled
+	case logDeadline.MatchString(msg):
+		r.summary.stopped = context.DeadlineExceeded
+		createTimeout, _ = time.ParseDuration(logDeadline.FindStringSubmatch(msg)[1])
+	}
+}
+
+// Whether a message belongs to the next run: runs log their ID first, runs
+// before run IDs were logged only follow the summary of the previous one
+func (r *loggedRun) endsBefore(msg string, kind int) bool {
+	if r.started.IsZero() {
+		return false
+	}
+	if strings.HasPrefix(msg, "Run ID: ") {
+		return true
+	}
+	return r.finished && kind != lineOther
+}
+
+// Print the run like a live run reports its organization creation
+func (r *loggedRun) report(n int, path string) {
+	if r.summary.createdOrgs > 0 {
+		r.summary.avgDuration = r.totalDuration / time.Duration(r.summary.createdOrgs)
+	}
+	// Runs interrupted before their summary only have the log timestamps
+	if r.summary.totalElapsed == 0 {
+		r.summary.totalElapsed = r.last.Sub(r.started)
+	}
+	fmt.Printf("\nRun %d from %s, started %s:\n", n, path, r.started.Format("2006/01/02 15:04:05"))
+	r.summary.report()
+}
+
+// Split a log into runs
+func analyzeLog(path string) ([]*loggedRun, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening log: %v", err)
+	}
+	defer file.Close()
+
+	var runs []*loggedRun
+	run := &loggedRun{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		var at time.Time
+		var msg string
+		var kind int
+		var d time.Duration
+		var entry logEntry
+		if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &entry) == nil {
+			at, msg = entry.Time, entry.Msg
+			kind, d = entryLine(entry)
+		} else if m := logLine.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil {
+			at, _ = time.ParseInLocation("2006/01/02 15:04:05", m[1], time.Local)
+			msg = m[2]
+			kind, d = legacyLine(msg)
+		}
+		if !at.IsZero() {
+			if run.endsBefore(msg, kind) {
+				runs = append(runs, run)
+				run = &loggedRun{}
+			}
+			run.add(at, msg, kind, d)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading log: %v", err)
+		}
+	}
+	if !run.started.IsZero() {
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Run the analyze command: report the runs recorded in org_creation.log
+// files in the format of live runs, so that old and new results can be compared
+func runAnalyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	only := fs.Int("run", 0, "Only report the run with this number (0: all runs)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s analyze [-run N] [org_creation.log ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"org_creation.log"}
+	}
+
+	// The report also logs its lines, which would only repeat them on stderr
+	log.SetOutput(io.Discard)
+
+	n := 0
+	for _, path := range paths {
+		runs, err := analyzeLog(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error analyzing %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		for _, run := range runs {
+			// Runs that stopped before creating organizations, e.g. on a login error
+			if run.summary.createdOrgs == 0 && run.summary.failedOrgs == 0 {
+				continue
+			}
+			n++
+			if *only == 0 || *only == n {
+				run.report(n, path)
+			}
+		}
+	}
+	if n == 0 {
+		fmt.Println("No runs with organization creation found")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/casdoor/casdoor-go-sdk/casdoorsdk"
+	"github.com/xuri/excelize/v2"
+)
+
+// Settings of the import benchmark
+var (
+	importUsers       int           // Users created per path (0 disables the import benchmark)
+	importBatch       = 1000        // Users per upload-users request
+	importConcurrency = 10          // Concurrent AddUser calls or uploads
+	importTimeout     time.Duration // Deadline of the import benchmark (0: no limit)
+	importColumns     = []string{   // Header of the uploaded sheet: JSON names of the user fields
+		"owner", "name", "createdTime", "type", "password", "displayName", "email", "phone", "countryCode",
+	}
+)
+
+// Outcome of one path of the import benchmark
+type importResult struct {
+	name     string
+	orgName  string
+	stats    *latencyStats // Latency of the requests of the path
+	requests int
+	failed   int // Users in failed requests
+	elapsed  time.Duration
+	verified int // Users found in the organization afterwards
+}
+
+// Row values of the user at index i (1-based) of the dataset in organization
+// owner; both paths import the same users
+func importUser(owner string, i int) *casdoorsdk.User {
+	name := fmt.Sprintf("user_%d", i)
+	return &casdoorsdk.User{
+		Owner:       owner,
+		Name:        name,
+		CreatedTime: time.Now().Format("2006-01-02T15:04:05Z"),
+		Type:        "normal-user",
+		Password:    fmt.Sprintf("Secret@%d", 1000+i),
+		DisplayName: fmt.Sprintf("Imported User %d", i),
+		Email:       fmt.Sprintf("%s@%s.example.com", name, owner),
+		Phone:       fmt.Sprintf("555%07d", i),
+		CountryCode: "US",
+	}
+}
+
+// Function to compare per-user AddUser calls with the batch upload of
+// /api/upload-users on the same importUsers users, each path in its own
+// freshly created organization
+func runImportBenchmark(ctx context.Context) {
+	ctx, cancel := phaseContext(ctx, importTimeout)
+	defer cancel()
+
+	fmt.Printf("Import benchmark: %d users per path\n", importUsers)
+	log.Printf("Import benchmark: %d users per path, batches of %d, concurrency %d\n", importUsers, importBatch, importConcurrency)
+
+	var results []*importResult
+	for i, path := range []struct {
+		name string
+		run  func(context.Context, *importResult)
+	}{
+		{"Per-user AddUser", importPerUser},
+		{"Batch upload-users", importBatches},
+	} {
+		if ctx.Err() != nil || breaker.hasAborted() {
+			break
+		}
+		res := &importResult{name: path.name, orgName: entityName("org", entityPath("", "import", i+1)), stats: newLatencyStats(path.name)}
+		orgStart := time.Now()
+		success, err := casdoorsdk.AddOrganization(newOrganization(res.orgName))
+		if err == nil && !success {
+			err = fmt.Errorf("organization already exists")
+		}
+		logRequest(withLogFields(ctx, "Create Import Organization", res.orgName), time.Since(orgStart), err)
+		if err != nil {
+			fmt.Printf("%s skipped: organization %s could not be created (%v)\n", path.name, res.orgName, err)
+			continue
+		}
+
+		start := time.Now()
+		path.run(ctx, res)
+		res.elapsed = time.Since(start)
+
+		// Count what actually arrived: uploads skip existing users silently
+		_, count, err := orgClient(res.orgName).GetPaginationUsers(1, 1, map[string]string{})
+		if err != nil {
+			// Fall back to the users of successful requests
+			log.Printf("Failed to count the users of %s: %v\n", res.orgName, err)
+			count = importUsers - res.failed
+		}
+		res.verified = count
+		results = append(results, res)
+	}
+
+	fmt.Println()
+	for _, res := range results {
+		res.report()
+	}
+	if len(results) == 2 && results[0].verified > 0 && results[1].verified > 0 {
+		ratio := results[1].usersPerSecond() / results[0].usersPerSecond()
+		fmt.Printf("Batch upload throughput: %.1fx per-user creation\n", ratio)
+		log.Printf("Batch upload throughput: %.1fx per-user creation\n", ratio)
+	}
+	reportStopped(ctx.Err(), "Import benchmark", importTimeout)
+}
+
+// Run the requests of a path, importConcurrency at a time; request returns
+// the number of users it failed to add
+func runImportRequests(ctx context.Context, res *importResult, n int, request func(i int) (int, error)) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < importConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				startTime := time.Now()
+				failed, err := request(i)
+				breaker.record(ctx, err != nil)
+				mu.Lock()
+				res.requests++
+				res.failed += failed
+				mu.Unlock()
+				if err != nil {
+					res.stats.fail(classifyError(err))
+					continue
+				}
+				res.stats.record(time.Since(startTime))
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if breaker.wait(ctx) != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Add the users one request at a time
+func importPerUser(ctx context.Context, res *importResult) {
+	client := orgClient(res.orgName)
+	runImportRequests(ctx, res, importUsers, func(i int) (int, error) {
+		user := importUser(res.orgName, i+1)
+		start := time.Now()
+		success, err := client.AddUser(user)
+		if err == nil && !success {
+			err = fmt.Errorf("user %s: %w", user.Name, errNotAdded)
+		}
+		logRequest(withLogFields(ctx, "Import User", res.orgName+"/"+user.Name), time.Since(start), err)
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+	})
+}
+
+// Upload the users as spreadsheets of importBatch rows
+func importBatches(ctx context.Context, res *importResult) {
+	client := orgClient(res.orgName)
+	batches := (importUsers + importBatch - 1) / importBatch
+	runImportRequests(ctx, res, batches, func(b int) (int, error) {
+		first := b*importBatch + 1
+		last := min(first+importBatch-1, importUsers)
+		start := time.Now()
+		sheet, err := userSheet(res.orgName, first, last)
+		if err == nil {
+			_, err = client.DoPost("upload-users", nil, sheet, true, true)
+		}
+		logRequest(withLogFields(ctx, "Upload Users", fmt.Sprintf("%s/%d-%d", res.orgName, first, last)), time.Since(start), err)
+		if err != nil {
+			return last - first + 1, err
+		}
+		return 0, nil
+	})
+}
+
+// Spreadsheet (xlsx) with the users first to last of the dataset
+func userSheet(owner string, first, last int) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+	header := make([]interface{}, len(importColumns))
+	for i, column := range importColumns {
+		header[i] = column
+	}
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return nil, fmt.Errorf("writing sheet header: %v", err)
+	}
+	for i := first; i <= last; i++ {
+		u := importUser(owner, i)
+		row := []interface{}{u.Owner, u.Name, u.CreatedTime, u.Type, u.Password, u.DisplayName, u.Email, u.Phone, u.CountryCode}
+		if err := f.SetSheetRow(sheet, fmt.Sprintf("A%d", i-first+2), &row); err != nil {
+			return nil, fmt.Errorf("writing sheet row: %v", err)
+		}
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("encoding sheet: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *importResult) usersPerSecond() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.verified) / r.elapsed.Seconds()
+}
+
+// Print and log the throughput and errors of the path
+func (r *importResult) report() {
+	line := fmt.Sprintf("%s: %d of %d users in %s in %v (%.1f users/s) with %d requests, %d users in failed requests",
+		r.name, r.verified, importUsers, r.orgName, r.elapsed, r.usersPerSecond(), r.requests, r.failed)
+	fmt.Println(line)
+	log.Println(line)
+	r.stats.report(r.elapsed)
+}
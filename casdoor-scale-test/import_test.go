@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportBenchmarkReport(t *testing.T) {
+	m := startMock(t, mockConfig{}, nil)
+	prevUsers, prevBatch, prevConcurrency := importUsers, importBatch, importConcurrency
+	defer func() { importUsers, importBatch, importConcurrency = prevUsers, prevBatch, prevConcurrency }()
+	importUsers, importBatch, importConcurrency = 25, 10, 3
+
+	report := captureReport(t, func() { runImportBenchmark(context.Background()) })
+
+	// Both paths import every user into their own organization, the batch
+	// path in 3 uploads
+	perUserOrg := entityName("org", entityPath("", "import", 1))
+	batchOrg := entityName("org", entityPath("", "import", 2))
+	assertReportLines(t, report,
+		fmt.Sprintf("Per-user AddUser: 25 of 25 users in %s", perUserOrg),
+		"with 25 requests, 0 users in failed requests",
+		fmt.Sprintf("Batch upload-users: 25 of 25 users in %s", batchOrg),
+		"with 3 requests, 0 users in failed requests",
+		"Batch upload throughput:",
+	)
+	if orgs, users := m.counts(); orgs != 2 || users != 50 {
+		t.Errorf("mock stores %d organizations and %d users, want 2 and 50", orgs, users)
+	}
+}
+
+func TestImportBenchmarkRejectedBatch(t *testing.T) {
+	// The second upload is rejected, losing its users
+	startMock(t, mockConfig{}, rejectEvery(2, "/api/upload-users"))
+	prevUsers, prevBatch, prevConcurrency := importUsers, importBatch, importConcurrency
+	defer func() { importUsers, importBatch, importConcurrency = prevUsers, prevBatch, prevConcurrency }()
+	importUsers, importBatch, importConcurrency = 30, 10, 1
+
+	report := captureReport(t, func() { runImportBenchmark(context.Background()) })
+
+	assertReportLines(t, report,
+		"Batch upload-users: 20 of 30 users",
+		"with 3 requests, 10 users in failed requests",
+		"Batch upload-users: 2 succeeded, 1 failed",
+		"Batch upload-users failure: rejected (x1)",
+	)
+}
+
+func TestImportBenchmarkDeadline(t *testing.T) {
+	// The import has its own deadline, independent of -create-timeout
+	startMock(t, mockConfig{latency: 50 * time.Millisecond}, nil)
+	prevUsers, prevBatch, prevConcurrency, prevTimeout := importUsers, importBatch, importConcurrency, importTimeout
+	defer func() { importUsers, importBatch, importConcurrency, importTimeout = prevUsers, prevBatch, prevConcurrency, prevTimeout }()
+	importUsers, importBatch, importConcurrency, importTimeout = 20, 10, 1, 200*time.Millisecond
+
+	report := captureReport(t, func() { runImportBenchmark(context.Background()) })
+
+	assertReportLines(t, report, "Import benchmark stopped after its deadline of 200ms")
+	if strings.Contains(report, "Batch upload-users:") {
+		t.Errorf("the batch path ran after the deadline:\n%s", report)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Settings of the structured log
+var (
+	logLevel  = new(slog.LevelVar) // Lowest level written
+	logFormat = "json"             // "json" or "text"
+	logSample = 1.0                // Share of entities whose info and debug lines are written
+)
+
+// Fields of the request an entity is created with, added to every line
+// logged with the request's context. The SDK does not retry, so every
+// request is the first attempt.
+type logFields struct {
+	op      string
+	entity  string
+	sampled bool // Whether the info and debug lines of the entity are written
+}
+
+type logFieldsKey struct{}
+
+// Context of the request op makes for entity; whether its info and debug
+// lines are written is decided here, once per entity
+func withLogFields(ctx context.Context, op, entity string) context.Context {
+	sampled := logSample >= 1 || rand.Float64() < logSample
+	return context.WithValue(ctx, logFieldsKey{}, logFields{op: op, entity: entity, sampled: sampled})
+}
+
+// Handler adding the run ID and the request fields of the context, and
+// dropping the info and debug lines of entities that are not sampled;
+// warnings and errors are always written
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if fields, ok := ctx.Value(logFieldsKey{}).(logFields); ok {
+		if !fields.sampled && r.Level < slog.LevelWarn {
+			return nil
+		}
+		r.AddAttrs(slog.String("op", fields.op))
+		if fields.entity != "" {
+			r.AddAttrs(slog.String("entity", fields.entity))
+		}
+		r.AddAttrs(slog.Int("attempt", 1))
+	}
+	r.AddAttrs(slog.String("run_id", runID))
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Log the outcome of a request made with withLogFields: successes at info,
+// failures at warning level. Casdoor answers "ok" or "error" as status.
+func logRequest(ctx context.Context, latency time.Duration, err error, attrs ...slog.Attr) {
+	if err != nil {
+		attrs = append(attrs, slog.String("status", "error"), slog.Duration("latency", latency), slog.String("error", err.Error()))
+		slog.LogAttrs(ctx, slog.LevelWarn, "request failed", attrs...)
+		return
+	}
+	attrs = append(attrs, slog.String("status", "ok"), slog.Duration("latency", latency))
+	slog.LogAttrs(ctx, slog.LevelInfo, "request succeeded", attrs...)
+}
+
+// Setup logging to a file; lines of the log package go through the
+// structured logger at info level
+func setupLogging() {
+	var err error
+	logFile, err = os.OpenFile("org_creation.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		log.Fatalf("Error opening log file: %v", err)
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler = slog.NewJSONHandler(logFile, opts)
+	if logFormat == "text" {
+		handler = slog.NewTextHandler(logFile, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casdoor/casdoor-go-sdk/casdoorsdk"
+)
+
+// Settings for the login benchmark
+var (
+	loginUserPrefix = "LoginUser_"                     // Prefix for users created for the login phase
+	loginPassword   = "Secret@1234"                    // Password given to every login user
+	redirectURI     = "http://localhost:8000/callback" // Redirect URI registered on the application (code grant only)
+	httpClient      = &http.Client{Timeout: 30 * time.Second}
+)
+
+// Credentials of a user created for the login phase
+type loginUser struct {
+	name     string
+	password string
+}
+
+// Token endpoint response, successful or not
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Error       string `json:"error"`
+}
+
+// Name of the login user with the 0-based index
+func loginUserName(index int) string {
+	return fmt.Sprintf("%s%s_%d", loginUserPrefix, runID, index+1)
+}
+
+// Function to create a user in the application's organization so it can log in
+func createLoginUser(index int) (loginUser, error) {
+	name := loginUserName(index)
+	user := &casdoorsdk.User{
+		Owner:       casdoorOrganization,
+		Name:        name,
+		CreatedTime: time.Now().Format("2006-01-02T15:04:05Z"),
+		DisplayName: name,
+		Password:    loginPassword,
+		Type:        "normal-user",
+	}
+
+	success, err := casdoorsdk.AddUser(user)
+	if err != nil {
+		return loginUser{}, err
+	}
+	if !success {
+		return loginUser{}, fmt.Errorf("user %s: %w", name, errNotAdded)
+	}
+	return loginUser{name: name, password: loginPassword}, nil
+}
+
+// Function to obtain an access token with the OAuth password grant
+func requestPasswordToken(ctx context.Context, user loginUser) (string, error) {
+	form := url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"username":      {user.name},
+		"password":      {user.password},
+		"scope":         {"openid"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, casdoorEndpoint+"/api/login/oauth/access_token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading token response: %w", err)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("status %d: undecodable token response", resp.StatusCode)
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("%s", token.Error)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("status %d: no access token returned", resp.StatusCode)
+	}
+	return token.AccessToken, nil
+}
+
+// Function to obtain an access token with the authorization code flow:
+// sign in through /api/login to get a code, then exchange it for a token. The
+// exchange goes through the SDK, which does not take a context.
+func requestCodeToken(ctx context.Context, user loginUser) (string, error) {
+	state := casdoorApplication
+	query := url.Values{
+		"clientId":     {clientID},
+		"responseType": {"code"},
+		"redirectUri":  {redirectURI},
+		"scope":        {"openid"},
+		"state":        {state},
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"application":  casdoorApplication,
+		"organization": casdoorOrganization,
+		"username":     user.name,
+		"password":     user.password,
+		"autoSignin":   true,
+		"type":         "code",
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshalling login payload: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, casdoorEndpoint+"/api/login?"+query.Encode(), bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("login request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var login casdoorsdk.Response
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", fmt.Errorf("status %d: undecodable login response", resp.StatusCode)
+	}
+	code, ok := login.Data.(string)
+	if login.Status != "ok" || !ok || code == "" {
+		return "", fmt.Errorf("login rejected: %s", login.Msg)
+	}
+
+	token, err := casdoorsdk.GetOAuthToken(code, state)
+	if err != nil {
+		return "", fmt.Errorf("code exchange: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// Run the login benchmark: create numUsers users, log each of them in with the
+// configured grant ('password' or 'code', checked at flag parsing) and validate
+// the returned JWT against the certificate. Token requests hold while the
+// circuit breaker is paused, and their outcomes are recorded in it.
+func runLoginBenchmark(ctx context.Context, numUsers, concurrency int, grant string) {
+	requestToken := requestPasswordToken
+	if grant == "code" {
+		requestToken = requestCodeToken
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	creation := newLatencyStats("User creation")
+	issuance := newLatencyStats("Token issuance")
+	validation := newLatencyStats("Token validation")
+
+	// Create the users that will log in
+	users := make([]loginUser, 0, numUsers)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	phaseStart := time.Now()
+	for i := 0; i < numUsers && ctx.Err() == nil; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			user, err := createLoginUser(i)
+			duration := time.Since(start)
+			logRequest(withLogFields(ctx, "Create Login User", loginUserName(i)), duration, err)
+			if err != nil {
+				creation.fail(classifyError(err))
+				return
+			}
+			creation.record(duration)
+
+			mu.Lock()
+			users = append(users, user)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	creation.report(time.Since(phaseStart))
+
+	// Log every user in and validate the token it receives
+	phaseStart = time.Now()
+	for _, user := range users {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(user loginUser) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			loginCtx := withLogFields(ctx, "Log In", user.name)
+			if breaker.wait(ctx) != nil {
+				return
+			}
+			reqCtx, cancel := context.WithTimeout(ctx, httpClient.Timeout)
+			start := time.Now()
+			token, err := requestToken(reqCtx, user)
+			issueTime := time.Since(start)
+			cancel()
+			breaker.record(ctx, err != nil)
+			if err != nil {
+				logRequest(loginCtx, issueTime, err)
+				issuance.fail(classifyError(err))
+				return
+			}
+			issuance.record(issueTime)
+
+			start = time.Now()
+			claims, err := casdoorsdk.ParseJwtToken(token)
+			duration := time.Since(start)
+			if err == nil && claims.Name != user.name {
+				err = fmt.Errorf("token issued for a different user")
+			}
+			if err != nil {
+				slog.WarnContext(loginCtx, "token validation failed", "error", err)
+				validation.fail(err.Error())
+				return
+			}
+			validation.record(duration)
+			logRequest(loginCtx, issueTime, nil)
+		}(user)
+	}
+	wg.Wait()
+	elapsed := time.Since(phaseStart)
+
+	issuance.report(elapsed)
+	validation.report(elapsed)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoginBenchmarkReport(t *testing.T) {
+	for _, grant := range []string{"password", "code"} {
+		t.Run(grant, func(t *testing.T) {
+			m := startMock(t, mockConfig{}, nil)
+
+			report := captureReport(t, func() { runLoginBenchmark(context.Background(), 5, 2, grant) })
+
+			assertReportLines(t, report,
+				"User creation: 5 succeeded, 0 failed",
+				"Token issuance: 5 succeeded, 0 failed",
+				"Token validation: 5 succeeded, 0 failed",
+			)
+			if _, users := m.counts(); users != 5 {
+				t.Errorf("mock stores %d users, want 5", users)
+			}
+		})
+	}
+}
+
+func TestLoginBenchmarkRejectedUsers(t *testing.T) {
+	// Every other login user is rejected and never logs in
+	startMock(t, mockConfig{}, rejectEvery(2, "/api/add-user"))
+
+	report := captureReport(t, func() { runLoginBenchmark(context.Background(), 6, 1, "password") })
+
+	assertReportLines(t, report,
+		"User creation: 3 succeeded, 3 failed",
+		"User creation failure: rejected (x3)",
+		"Token issuance: 3 succeeded, 0 failed",
+		"Token validation: 3 succeeded, 0 failed",
+	)
+}
+
+func TestLoginBenchmarkTokenTimeout(t *testing.T) {
+	// The token endpoint answers after -request-timeout
+	startMock(t, mockConfig{}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/login/oauth/access_token" {
+				time.Sleep(200 * time.Millisecond)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	prevTimeout := httpClient.Timeout
+	defer func() { httpClient.Timeout = prevTimeout }()
+	httpClient.Timeout = 50 * time.Millisecond
+
+	report := captureReport(t, func() { runLoginBenchmark(context.Background(), 3, 3, "password") })
+
+	assertReportLines(t, report,
+		"User creation: 3 succeeded, 0 failed",
+		"Token issuance: 0 succeeded, 3 failed",
+		"Token issuance failure: timeout (x3)",
+	)
+}
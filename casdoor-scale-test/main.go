@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
@@ -13,32 +15,74 @@ import (
 
 // Configurable settings
 var (
-	numOrgs            int          // Total number of organizations to create
-	numGoroutines      int          // Number of goroutines for parallel creation
-	organizationPrefix = "TestOrg_" // Prefix for unique organization names
-	logFile            *os.File     // File to log output
+	numOrgs       int           // Total number of organizations to create
+	numGoroutines int           // Number of goroutines for parallel creation
+	usersPerOrg   int           // Number of users to create in every organization
+	logFile       *os.File      // File to log output
+	createTimeout time.Duration // Deadline of the organization creation (0: no limit)
+)
+
+// Organizations created successfully so far, used by the read benchmark
+var (
+	createdOrgs  = &orgCheckpoint{path: "created_orgs.txt"}
+	userCreation = newLatencyStats("Organization user creation")
+)
+
+// Casdoor connection settings
+var (
+	casdoorEndpoint     = "http://localhost:8000"
+	clientID            = "785e6f4416906c6d3598"
+	clientSecret        = "d8b784ac15ca6acd9fc372810679d62e57e81ecc"
+	casdoorOrganization = "built-in"
+	casdoorApplication  = "app-built-in"
 )
 
 // Struct to hold timing data
 type TimingInfo struct {
 	orgName  string
 	duration time.Duration
+	success  bool
+	skipped  bool // Not attempted because the circuit breaker aborted or the run was stopped
 }
 
-// Initialize Casdoor SDK configuration
-func initializeCasdoor() {
-	casdoorsdk.InitConfig("http://localhost:8000", "785e6f4416906c6d3598", "d8b784ac15ca6acd9fc372810679d62e57e81ecc", "your_jwt_public_key", "built-in", "app-built-in")
+// Running totals of the organization creation, added to as organizations
+// finish, so that memory does not grow with the number of organizations
+type orgTally struct {
+	mu            sync.Mutex
+	created       int
+	failed        int
+	skipped       int
+	totalDuration time.Duration // Sum of the creation times of the created organizations
 }
 
-// Function to create an organization with unique name
-func createOrganization(orgID int, wg *sync.WaitGroup, timings chan<- TimingInfo) {
-	defer wg.Done()
+func (t *orgTally) add(timing TimingInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case timing.skipped:
+		t.skipped++
+	case !timing.success:
+		t.failed++
+	default:
+		t.created++
+		t.totalDuration += timing.duration
+	}
+}
 
-	// Generate unique name
-	orgName := fmt.Sprintf("%s%d_%d", organizationPrefix, orgID, rand.Intn(10000))
+// Initialize Casdoor SDK configuration; the certificate is used to validate
+// issued JWTs, so a run without it would report every login as failed
+func initializeCasdoor(certFile string) error {
+	certificate, err := os.ReadFile(certFile)
+	if err != nil {
+		return fmt.Errorf("reading certificate %s: %v", certFile, err)
+	}
+	casdoorsdk.InitConfig(casdoorEndpoint, clientID, clientSecret, string(certificate), casdoorOrganization, casdoorApplication)
+	return nil
+}
 
-	// Create organization struct
-	organization := &casdoorsdk.Organization{
+// Organization struct of the organizations created by the tool
+func newOrganization(orgName string) *casdoorsdk.Organization {
+	return &casdoorsdk.Organization{
 		Owner:              "admin",
 		Name:               orgName,
 		CreatedTime:        time.Now().Format("2006-01-02T15:04:05Z"),
@@ -52,88 +96,336 @@ func createOrganization(orgID int, wg *sync.WaitGroup, timings chan<- TimingInfo
 		EnableSoftDeletion: false,
 		IsProfilePublic:    false,
 	}
+}
+
+// Function to create an organization with unique name
+func createOrganization(ctx context.Context, orgID int, wg *sync.WaitGroup, tally *orgTally) {
+	defer wg.Done()
+
+	// Generate unique name; orgID is 0-based
+	orgName := entityName("org", entityPath("", "org", orgID+1))
+
+	// Hold the creation while the server is considered down, skip it once the run stops
+	if breaker.wait(ctx) != nil {
+		tally.add(TimingInfo{orgName: orgName, skipped: true})
+		dash.plan("Create Organization", -1)
+		dash.plan("Create User", -usersPerOrg)
+		return
+	}
 
 	// Measure time taken for creation
 	startTime := time.Now()
-	success, err := casdoorsdk.AddOrganization(organization)
+	dash.started()
+	success, err := casdoorsdk.AddOrganization(newOrganization(orgName))
 	duration := time.Since(startTime)
 
-	// Log the result and send timing info to the channel
-	if err != nil || !success {
-		log.Printf("Failed to create organization %s: %v\n", orgName, err)
-	} else {
-		log.Printf("Successfully created organization %s in %v\n", orgName, duration)
+	// Log the result and add the timing info to the totals
+	succeeded := err == nil && success
+	breaker.record(ctx, !succeeded)
+	if err == nil && !success {
+		err = fmt.Errorf("organization %s was not added", orgName)
+	}
+	logRequest(withLogFields(ctx, "Create Organization", orgName), duration, err)
+	dash.finished("Create Organization", duration, err)
+	if !succeeded {
+		dash.plan("Create User", -usersPerOrg)
+	}
+	if succeeded {
+		createOrgUsers(ctx, orgName)
+		createdOrgs.add(orgName)
 	}
 
-	timings <- TimingInfo{orgName: orgName, duration: duration}
+	tally.add(TimingInfo{orgName: orgName, duration: duration, success: succeeded})
 }
 
-// Setup logging to a file
-func setupLogging() {
-	var err error
-	logFile, err = os.OpenFile("org_creation.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("Error opening log file: %v", err)
+// Function to populate an organization with usersPerOrg users
+func createOrgUsers(ctx context.Context, orgName string) {
+	client := orgClient(orgName)
+	for i := 0; i < usersPerOrg; i++ {
+		if breaker.wait(ctx) != nil {
+			dash.plan("Create User", -(usersPerOrg - i))
+			return
+		}
+
+		userName := fmt.Sprintf("user_%d", i)
+		user := &casdoorsdk.User{
+			Owner:       orgName,
+			Name:        userName,
+			CreatedTime: time.Now().Format("2006-01-02T15:04:05Z"),
+			DisplayName: userName,
+			Email:       fmt.Sprintf("%s@%s.example.com", userName, orgName),
+			Password:    "Secret@1234",
+			Type:        "normal-user",
+		}
+
+		startTime := time.Now()
+		dash.started()
+		success, err := client.AddUser(user)
+		duration := time.Since(startTime)
+		breaker.record(ctx, err != nil || !success)
+		if err == nil && !success {
+			err = fmt.Errorf("user %s: %w", userName, errNotAdded)
+		}
+		logRequest(withLogFields(ctx, "Create User", orgName+"/"+userName), duration, err)
+		dash.finished("Create User", duration, err)
+		if err != nil {
+			userCreation.fail(classifyError(err))
+			continue
+		}
+		userCreation.record(duration)
 	}
-	log.SetOutput(logFile)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile) // Set log flags
 }
 
-func main() {
-	// Seed the random number generator
-	rand.Seed(time.Now().UnixNano())
+// Options of the read benchmark run during and after the population phase
+type readOptions struct {
+	requests    int // Number of read requests per run (0 disables the read benchmark)
+	concurrency int
+	every       int // Also run every N created organizations
+	pageSize    int
+}
 
-	// Setup logging to a file
-	setupLogging()
-	defer logFile.Close() // Ensure the log file is closed when the program exits
+// Outcome of the organization creation phase
+type runSummary struct {
+	createdOrgs  int
+	failedOrgs   int
+	skippedOrgs  int // Not attempted because the circuit breaker aborted or the run was stopped
+	avgDuration  time.Duration
+	totalElapsed time.Duration
+	checkpoints  []readCheckpoint
+	stopped      error // Why the creation stopped early: context.Canceled or context.DeadlineExceeded
+}
 
-	// Initialize the SDK
-	initializeCasdoor()
+// Create numOrgs organizations in batches of numGoroutines, running the read
+// benchmark at the configured population sizes. No new batch is started once
+// ctx is done or the creation deadline has passed.
+func runOrgCreation(ctx context.Context, numOrgs, numGoroutines int, reads readOptions) runSummary {
+	if numGoroutines < 1 {
+		numGoroutines = 1
+	}
 
-	// User inputs
-	fmt.Print("Enter number of organizations to create: ")
-	fmt.Scan(&numOrgs)
-	fmt.Print("Enter number of goroutines (parallelism): ")
-	fmt.Scan(&numGoroutines)
+	ctx, cancel := phaseContext(ctx, createTimeout)
+	defer cancel()
 
 	// Start total time measurement
 	totalStartTime := time.Now()
 
-	// Channels and wait group for concurrency and timing
-	timings := make(chan TimingInfo, numOrgs)
+	startDashboard()
+	dash.plan("Create Organization", numOrgs)
+	if usersPerOrg > 0 {
+		dash.plan("Create User", numOrgs*usersPerOrg)
+	}
+
+	// Wait group for concurrency and totals of the finished organizations
+	var tally orgTally
 	var wg sync.WaitGroup
 
+	// Read benchmark runs at different population sizes
+	var summary runSummary
+	nextCheckpoint := reads.every
+
 	// Create goroutines in batches
 	for i := 0; i < numOrgs; i += numGoroutines {
+		// Stop launching batches once the circuit breaker has aborted or the run is stopped
+		if breaker.wait(ctx) != nil {
+			summary.skippedOrgs = numOrgs - i
+			dash.plan("Create Organization", -(numOrgs - i))
+			dash.plan("Create User", -(numOrgs-i)*usersPerOrg)
+			break
+		}
+
 		for j := 0; j < numGoroutines && (i+j) < numOrgs; j++ {
 			wg.Add(1)
-			go createOrganization(i+j, &wg, timings)
+			go createOrganization(ctx, i+j, &wg, &tally)
 		}
 		wg.Wait() // Wait for the batch to complete before moving to next
+
+		// Measure reads once enough organizations have been added since the last run
+		if reads.requests > 0 && reads.every > 0 && i+numGoroutines >= nextCheckpoint && i+numGoroutines < numOrgs {
+			summary.checkpoints = append(summary.checkpoints, runCreatedOrgReads(ctx, reads))
+			nextCheckpoint += reads.every
+		}
 	}
 
-	// Collect timing results
-	close(timings)
-	var totalDuration time.Duration
-	createdOrgs := 0
+	stopDashboard()
 
-	for timing := range timings {
-		totalDuration += timing.duration
-		createdOrgs++
-	}
+	// Collect timing results
+	summary.createdOrgs = tally.created
+	summary.failedOrgs = tally.failed
+	summary.skippedOrgs += tally.skipped
 
 	// Calculate average time
-	avgDuration := totalDuration / time.Duration(createdOrgs)
+	if summary.createdOrgs > 0 {
+		summary.avgDuration = tally.totalDuration / time.Duration(summary.createdOrgs)
+	}
 
 	// Calculate total elapsed time
-	totalElapsedTime := time.Since(totalStartTime)
+	summary.totalElapsed = time.Since(totalStartTime)
+
+	summary.stopped = ctx.Err()
+
+	// Measure reads against the full population
+	if reads.requests > 0 && !breaker.hasAborted() && ctx.Err() == nil {
+		summary.checkpoints = append(summary.checkpoints, runCreatedOrgReads(ctx, reads))
+	}
+	return summary
+}
+
+// Print and log the results of the organization creation phase
+func (s runSummary) report() {
+	fmt.Printf("Total organizations created: %d\n", s.createdOrgs)
+	fmt.Printf("Total organizations failed: %d\n", s.failedOrgs)
+	if s.skippedOrgs > 0 {
+		fmt.Printf("Total organizations skipped: %d\n", s.skippedOrgs)
+	}
+	fmt.Printf("Average time taken per organization: %v\n", s.avgDuration)
+	fmt.Printf("Total time taken to create all organizations: %v\n", s.totalElapsed)
+
+	log.Printf("Total organizations created: %d\n", s.createdOrgs)
+	log.Printf("Total organizations failed: %d\n", s.failedOrgs)
+	if s.skippedOrgs > 0 {
+		log.Printf("Total organizations skipped: %d\n", s.skippedOrgs)
+	}
+	log.Printf("Average time taken per organization: %v\n", s.avgDuration)
+	log.Printf("Total time taken to create all organizations: %v\n", s.totalElapsed)
+	if usersPerOrg > 0 {
+		userCreation.report(s.totalElapsed)
+	}
+	reportReadGrowth(s.checkpoints)
+	breaker.report()
+	reportStopped(s.stopped, "Organization creation", createTimeout)
+}
+
+func main() {
+	// Subcommands take their own flags
+	if len(os.Args) > 1 && os.Args[1] == "serve-mock" {
+		runServeMock(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		runAnalyze(os.Args[2:])
+		return
+	}
+
+	flag.StringVar(&casdoorEndpoint, "endpoint", casdoorEndpoint, "Casdoor server URL")
+	flag.StringVar(&runID, "run-id", runID, "ID of the run included in every entity name; reuse it to reproduce the names of an earlier run (default: start time)")
+	flag.StringVar(&nameTemplate, "name-template", nameTemplate, "Template of organization names with the placeholders {run}, {kind} and {path}")
+
+	// Login benchmark options
+	loginUsers := flag.Int("login-users", 0, "Number of users to create and log in after the organizations (0 disables the login phase)")
+	loginConcurrency := flag.Int("login-concurrency", 10, "Number of concurrent logins")
+	grant := flag.String("grant", "password", "OAuth grant used to log in: 'password' or 'code'")
+	certFile := flag.String("cert", "token_jwt_key.pem", "Certificate used to validate issued JWTs")
+
+	// Population and read benchmark options
+	var reads readOptions
+	flag.IntVar(&importUsers, "import-users", 0, "Number of users to import both one by one and in batches into two fresh organizations to compare their throughput (0 disables the import benchmark)")
+	flag.IntVar(&importBatch, "import-batch", importBatch, "Number of users per batch upload")
+	flag.IntVar(&importConcurrency, "import-concurrency", importConcurrency, "Number of concurrent user creations or batch uploads of the import benchmark")
+	flag.DurationVar(&importTimeout, "import-timeout", 0, "Deadline of the import benchmark; remaining requests are skipped (0: no limit)")
+	flag.IntVar(&usersPerOrg, "users-per-org", 0, "Number of users to create in every organization")
+	flag.IntVar(&reads.requests, "read-requests", 0, "Number of read requests per read benchmark run (0 disables the read benchmark)")
+	flag.IntVar(&reads.concurrency, "read-concurrency", 10, "Number of concurrent read requests")
+	flag.IntVar(&reads.every, "read-every", 0, "Also run the read benchmark every N created organizations (0 runs it once at the end)")
+	flag.IntVar(&reads.pageSize, "page-size", 50, "Page size of paginated read queries")
+	flag.StringVar(&createdOrgs.path, "orgs-file", createdOrgs.path, "File the created organizations are written to, one per line; the read benchmark samples them from it")
+
+	// Circuit breaker options
+	breakerAction := flag.String("breaker", breakerOff, "Action when the error rate trips the circuit breaker: 'off', 'pause' (wait for a health probe to succeed) or 'abort' (stop with a partial report)")
+	breakerWindow := flag.Int("breaker-window", 50, "Number of recent API calls the error rate is computed over")
+	breakerErrorRate := flag.Float64("breaker-error-rate", 0.5, "Error rate over the window that opens the circuit breaker")
+	breakerConsecutive := flag.Int("breaker-consecutive", 20, "Consecutive failed API calls that open the circuit breaker (0 disables)")
+	breakerProbeInterval := flag.Duration("breaker-probe-interval", 5*time.Second, "Delay between health probes while the circuit breaker is open")
+
+	// Deadlines
+	flag.DurationVar(&httpClient.Timeout, "request-timeout", httpClient.Timeout, "Timeout of a single API request")
+	flag.DurationVar(&createTimeout, "create-timeout", 0, "Deadline of the organization creation; remaining organizations are skipped (0: no limit)")
+
+	// Logging options
+	flag.TextVar(logLevel, "log-level", logLevel, "Lowest level written to org_creation.log: 'debug', 'info', 'warn' or 'error'")
+	flag.StringVar(&logFormat, "log-format", logFormat, "Format of org_creation.log: 'json' (one object per line, read by the analyze command) or 'text' (key=value pairs)")
+	flag.Float64Var(&logSample, "log-sample", logSample, "Share of entities (0-1) whose info lines are written; failures are always written")
+
+	// Progress view options
+	flag.StringVar(&dashboardMode, "dashboard", dashboardMode, "Live progress view of the organization creation: 'auto' (only when stdout is a terminal), 'on' or 'off'")
+	flag.DurationVar(&dashboardInterval, "dashboard-interval", dashboardInterval, "Delay between two redraws of the progress view")
+	flag.Parse()
+
+	if err := validateNameTemplate(nameTemplate); err != nil {
+		log.Fatal(err)
+	}
+
+	if *grant != "password" && *grant != "code" {
+		log.Fatalf("Invalid -grant %q. Please choose 'password' or 'code'.", *grant)
+	}
+
+	if importBatch < 1 || importConcurrency < 1 {
+		log.Fatal("-import-batch and -import-concurrency must be at least 1")
+	}
+
+	if logFormat != "json" && logFormat != "text" {
+		log.Fatalf("Invalid -log-format %q. Please choose 'json' or 'text'.", logFormat)
+	}
+	if logSample < 0 || logSample > 1 {
+		log.Fatal("-log-sample must be between 0 and 1")
+	}
 
-	// Print and log results
-	fmt.Printf("Total organizations created: %d\n", createdOrgs)
-	fmt.Printf("Average time taken per organization: %v\n", avgDuration)
-	fmt.Printf("Total time taken to create all organizations: %v\n", totalElapsedTime)
+	if dashboardMode != "auto" && dashboardMode != "on" && dashboardMode != "off" {
+		log.Fatalf("Invalid -dashboard %q. Please choose 'auto', 'on' or 'off'.", dashboardMode)
+	}
+	if dashboardInterval <= 0 {
+		log.Fatal("-dashboard-interval must be positive")
+	}
+
+	switch *breakerAction {
+	case breakerOff:
+	case breakerPause, breakerAbort:
+		if *breakerWindow < 1 || *breakerErrorRate <= 0 || *breakerErrorRate > 1 || *breakerProbeInterval <= 0 {
+			log.Fatal("-breaker-window must be at least 1, -breaker-error-rate in (0, 1] and -breaker-probe-interval positive")
+		}
+		breaker = newCircuitBreaker(*breakerAction, *breakerWindow, *breakerErrorRate, *breakerConsecutive, *breakerProbeInterval, probeCasdoor)
+	default:
+		log.Fatalf("Invalid -breaker %q. Please choose 'off', 'pause' or 'abort'.", *breakerAction)
+	}
+
+	// Seed the random number generator
+	rand.Seed(time.Now().UnixNano())
+
+	// Initialize the SDK; its requests share the client and its timeout
+	if err := initializeCasdoor(*certFile); err != nil {
+		log.Fatalf("Error initializing Casdoor: %v", err)
+	}
+	casdoorsdk.SetHttpClient(httpClient)
+
+	// Setup logging to a file
+	setupLogging()
+	defer logFile.Close() // Ensure the log file is closed when the program exits
 
-	log.Printf("Total organizations created: %d\n", createdOrgs)
-	log.Printf("Average time taken per organization: %v\n", avgDuration)
-	log.Printf("Total time taken to create all organizations: %v\n", totalElapsedTime)
+	if err := createdOrgs.open(); err != nil {
+		log.Fatalf("Error opening the organizations file: %v", err)
+	}
+	defer createdOrgs.close()
+
+	fmt.Printf("Run ID: %s\n", runID)
+	log.Printf("Run ID: %s, name template: %s\n", runID, nameTemplate)
+
+	// User inputs
+	fmt.Print("Enter number of organizations to create: ")
+	fmt.Scan(&numOrgs)
+	fmt.Print("Enter number of goroutines (parallelism): ")
+	fmt.Scan(&numGoroutines)
+
+	// From here on SIGINT/SIGTERM stops the run gracefully
+	ctx := handleShutdown()
+
+	runOrgCreation(ctx, numOrgs, numGoroutines, reads).report()
+
+	// Compare per-user creation with batch uploads on the same dataset
+	if importUsers > 0 && !breaker.hasAborted() && ctx.Err() == nil {
+		runImportBenchmark(ctx)
+	}
+
+	// Log in as freshly created users and validate the issued tokens
+	if *loginUsers > 0 && !breaker.hasAborted() && ctx.Err() == nil {
+		runLoginBenchmark(ctx, *loginUsers, *loginConcurrency, *grant)
+	}
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOrgCreationReport(t *testing.T) {
+	// Every 4th organization and every 5th user is rejected
+	reject := func(next http.Handler) http.Handler {
+		return rejectEvery(4, "/api/add-organization")(rejectEvery(5, "/api/add-user")(next))
+	}
+	m := startMock(t, mockConfig{}, reject)
+	usersPerOrg = 3
+
+	var summary runSummary
+	report := captureReport(t, func() {
+		summary = runOrgCreation(context.Background(), 8, 4, readOptions{requests: 8, concurrency: 2, every: 4, pageSize: 2})
+		summary.report()
+	})
+
+	// 6 organizations with 18 users, 3 of them rejected
+	if summary.createdOrgs != 6 || summary.failedOrgs != 2 || summary.skippedOrgs != 0 {
+		t.Errorf("got %d created, %d failed, %d skipped organizations, want 6, 2, 0", summary.createdOrgs, summary.failedOrgs, summary.skippedOrgs)
+	}
+	assertReportLines(t, report,
+		"Total organizations created: 6\n",
+		"Total organizations failed: 2\n",
+		"Organization user creation: 15 succeeded, 3 failed",
+		"Organization user creation failure: rejected (x3)",
+	)
+	if orgs, users := m.counts(); orgs != 6 || users != 15 {
+		t.Errorf("mock stores %d organizations and %d users, want 6 and 15", orgs, users)
+	}
+
+	// The created organizations are streamed to the file
+	file, err := os.Open(createdOrgs.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var lines int
+	for scanner := bufio.NewScanner(file); scanner.Scan(); lines++ {
+		if _, ok := m.orgs["admin/"+scanner.Text()]; !ok {
+			t.Errorf("%s lists %s, which the mock does not store", createdOrgs.path, scanner.Text())
+		}
+	}
+	if lines != 6 {
+		t.Errorf("%s lists %d organizations, want 6", createdOrgs.path, lines)
+	}
+
+	// Reads after the first batch of 4, of which one failed, and at the end
+	if len(summary.checkpoints) != 2 {
+		t.Fatalf("got %d read checkpoints, want 2", len(summary.checkpoints))
+	}
+	for i, want := range []int{3, 6} {
+		checkpoint := summary.checkpoints[i]
+		if checkpoint.orgs != want || checkpoint.users != want*usersPerOrg {
+			t.Errorf("checkpoint %d: %d organizations, %d users, want %d, %d", i+1, checkpoint.orgs, checkpoint.users, want, want*usersPerOrg)
+		}
+		for _, op := range readOperations {
+			if sum := checkpoint.results[op]; sum.count != 2 || sum.failed != 0 {
+				t.Errorf("checkpoint %d: %s %d succeeded, %d failed, want 2, 0", i+1, op, sum.count, sum.failed)
+			}
+		}
+	}
+}
+
+func TestOrgCreationBreakerAbort(t *testing.T) {
+	startMock(t, mockConfig{errorRate: 1}, nil)
+	breaker = newCircuitBreaker(breakerAbort, 2, 1, 0, time.Second, probeCasdoor)
+
+	var summary runSummary
+	report := captureReport(t, func() {
+		summary = runOrgCreation(context.Background(), 8, 2, readOptions{})
+		summary.report()
+	})
+
+	// The first batch trips the breaker, the others are not attempted
+	if summary.createdOrgs != 0 || summary.failedOrgs != 2 || summary.skippedOrgs != 6 {
+		t.Errorf("got %d created, %d failed, %d skipped organizations, want 0, 2, 6", summary.createdOrgs, summary.failedOrgs, summary.skippedOrgs)
+	}
+	assertReportLines(t, report,
+		"Total organizations failed: 2\n",
+		"Total organizations skipped: 6\n",
+		"Run aborted by the circuit breaker",
+	)
+}
+
+func TestOrgCreationDeadline(t *testing.T) {
+	startMock(t, mockConfig{latency: 100 * time.Millisecond}, nil)
+	prevTimeout := createTimeout
+	defer func() { createTimeout = prevTimeout }()
+	createTimeout = 150 * time.Millisecond
+
+	var summary runSummary
+	report := captureReport(t, func() {
+		summary = runOrgCreation(context.Background(), 8, 2, readOptions{})
+		summary.report()
+	})
+
+	// The second batch runs past the deadline, the remaining ones are skipped
+	if summary.createdOrgs+summary.failedOrgs != 4 || summary.skippedOrgs != 4 {
+		t.Errorf("got %d created, %d failed, %d skipped organizations, want 4 attempted and 4 skipped", summary.createdOrgs, summary.failedOrgs, summary.skippedOrgs)
+	}
+	assertReportLines(t, report, "Organization creation stopped after its deadline of 150ms")
+}
+
+func TestOrgCreationBreakerPauseDeadline(t *testing.T) {
+	// The health probes keep failing, so the breaker stays paused until the
+	// deadline of the phase, which also stops the probe loop
+	startMock(t, mockConfig{errorRate: 1}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/health" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	breaker = newCircuitBreaker(breakerPause, 2, 1, 0, 20*time.Millisecond, probeCasdoor)
+	prevTimeout := createTimeout
+	defer func() { createTimeout = prevTimeout }()
+	createTimeout = 200 * time.Millisecond
+
+	var summary runSummary
+	report := captureReport(t, func() {
+		summary = runOrgCreation(context.Background(), 8, 2, readOptions{})
+		summary.report()
+	})
+
+	if summary.createdOrgs != 0 || summary.failedOrgs != 2 || summary.skippedOrgs != 6 {
+		t.Errorf("got %d created, %d failed, %d skipped organizations, want 0, 2, 6", summary.createdOrgs, summary.failedOrgs, summary.skippedOrgs)
+	}
+	assertReportLines(t, report, "Organization creation stopped after its deadline of 200ms")
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		breaker.mu.Lock()
+		probing := breaker.probing
+		breaker.mu.Unlock()
+		if !probing {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("the probe loop still runs after the deadline")
+		}
+	}
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casdoor/casdoor-go-sdk/casdoorsdk"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/xuri/excelize/v2"
+)
+
+// Behaviour of the mock Casdoor server
+type mockConfig struct {
+	latency    time.Duration // Base latency added to every request
+	jitter     time.Duration // Random extra latency in [0, jitter)
+	errorRate  float64       // Share of requests answered with HTTP 500
+	rejectRate float64       // Share of requests answered with {"status": "error"}
+}
+
+// In-memory fake of the Casdoor API endpoints called through casdoorsdk.
+// It is an http.Handler, so tests can serve it with httptest.NewServer and
+// pass the returned URL to casdoorsdk.InitConfig.
+type mockCasdoor struct {
+	cfg  mockConfig
+	mux  *http.ServeMux
+	key  *rsa.PrivateKey
+	cert []byte // PEM certificate matching key, to validate issued tokens
+
+	mu    sync.Mutex
+	rng   *mathrand.Rand
+	orgs  map[string]*casdoorsdk.Organization // "owner/name" -> organization
+	users map[string]*casdoorsdk.User         // "owner/name" -> user
+	codes map[string]string                   // authorization code -> "owner/name"
+
+	downUntil time.Time // Simulated outage: every request fails with 503 until then
+}
+
+// Create a mock server with a freshly generated token signing key
+func newMockCasdoor(cfg mockConfig) (*mockCasdoor, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generating signing key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"mock-casdoor"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate: %v", err)
+	}
+
+	m := &mockCasdoor{
+		cfg:   cfg,
+		mux:   http.NewServeMux(),
+		key:   key,
+		cert:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		rng:   mathrand.New(mathrand.NewSource(time.Now().UnixNano())),
+		orgs:  make(map[string]*casdoorsdk.Organization),
+		users: make(map[string]*casdoorsdk.User),
+		codes: make(map[string]string),
+	}
+
+	m.handle("POST /api/add-organization", true, m.addOrganization)
+	m.handle("POST /api/delete-organization", true, m.deleteOrganization)
+	m.handle("GET /api/get-organization", true, m.getOrganization)
+	m.handle("GET /api/get-organizations", true, m.getOrganizations)
+	m.handle("POST /api/add-user", true, m.addUser)
+	m.handle("POST /api/upload-users", true, m.uploadUsers)
+	m.handle("POST /api/delete-user", true, m.deleteUser)
+	m.handle("GET /api/get-user", true, m.getUser)
+	m.handle("GET /api/get-users", true, m.getUsers)
+	m.handle("POST /api/login", false, m.login)
+	m.handle("POST /api/login/oauth/access_token", false, m.accessToken)
+	m.mux.HandleFunc("GET /api/health", m.health)
+	m.mux.HandleFunc("POST /mock/outage", m.outage)
+	return m, nil
+}
+
+func (m *mockCasdoor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+// Register a route behind latency, failure injection and, for API calls made
+// by the SDK, client credentials
+func (m *mockCasdoor) handle(pattern string, needsAuth bool, h http.HandlerFunc) {
+	m.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		delay := m.cfg.latency
+		if m.cfg.jitter > 0 {
+			delay += time.Duration(m.rng.Int63n(int64(m.cfg.jitter)))
+		}
+		roll := m.rng.Float64()
+		down := time.Now().Before(m.downUntil)
+		m.mu.Unlock()
+
+		time.Sleep(delay)
+
+		if down {
+			http.Error(w, "mock: simulated outage", http.StatusServiceUnavailable)
+			return
+		}
+
+		if needsAuth {
+			if _, _, ok := r.BasicAuth(); !ok {
+				writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "Unauthorized operation"})
+				return
+			}
+		}
+		if roll < m.cfg.errorRate {
+			http.Error(w, "mock: injected server error", http.StatusInternalServerError)
+			return
+		}
+		if roll < m.cfg.errorRate+m.cfg.rejectRate {
+			writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "mock: injected failure"})
+			return
+		}
+		h(w, r)
+	})
+}
+
+// Health endpoint used by the circuit breaker probe
+func (m *mockCasdoor) health(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	down := time.Now().Before(m.downUntil)
+	m.mu.Unlock()
+	if down {
+		http.Error(w, "mock: simulated outage", http.StatusServiceUnavailable)
+		return
+	}
+	writeMockResponse(w, casdoorsdk.Response{Status: "ok"})
+}
+
+// Simulate an outage: POST /mock/outage?duration=30s answers every request,
+// including the health endpoint, with 503 for the given duration
+func (m *mockCasdoor) outage(w http.ResponseWriter, r *http.Request) {
+	duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "invalid duration"})
+		return
+	}
+	m.mu.Lock()
+	m.downUntil = time.Now().Add(duration)
+	m.mu.Unlock()
+	log.Printf("Simulating an outage for %v", duration)
+	writeMockResponse(w, casdoorsdk.Response{Status: "ok"})
+}
+
+func writeMockResponse(w http.ResponseWriter, resp casdoorsdk.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Answer a create or delete call the way Casdoor does
+func writeAffected(w http.ResponseWriter, affected bool) {
+	data := "Unaffected"
+	if affected {
+		data = "Affected"
+	}
+	writeMockResponse(w, casdoorsdk.Response{Status: "ok", Data: data})
+}
+
+// Apply Casdoor's field/value filter and p/pageSize pagination to sorted names.
+// The second result reports whether the request was paginated.
+func paginate(r *http.Request, names []string, fieldValue func(name string) string) ([]string, bool) {
+	q := r.URL.Query()
+	if value := q.Get("value"); q.Get("field") != "" && value != "" {
+		filtered := names[:0]
+		for _, name := range names {
+			if strings.Contains(fieldValue(name), value) {
+				filtered = append(filtered, name)
+			}
+		}
+		names = filtered
+	}
+	sort.Strings(names)
+
+	pageSize, err := strconv.Atoi(q.Get("pageSize"))
+	if err != nil || pageSize <= 0 {
+		return names, false
+	}
+	page, err := strconv.Atoi(q.Get("p"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	start := (page - 1) * pageSize
+	if start > len(names) {
+		start = len(names)
+	}
+	end := start + pageSize
+	if end > len(names) {
+		end = len(names)
+	}
+	return names[start:end], true
+}
+
+func (m *mockCasdoor) addOrganization(w http.ResponseWriter, r *http.Request) {
+	var org casdoorsdk.Organization
+	if err := json.NewDecoder(r.Body).Decode(&org); err != nil || org.Name == "" {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "invalid organization"})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := org.Owner + "/" + org.Name
+	if _, ok := m.orgs[id]; ok {
+		writeAffected(w, false)
+		return
+	}
+	m.orgs[id] = &org
+	writeAffected(w, true)
+}
+
+func (m *mockCasdoor) deleteOrganization(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := r.URL.Query().Get("id")
+	_, ok := m.orgs[id]
+	delete(m.orgs, id)
+	writeAffected(w, ok)
+}
+
+func (m *mockCasdoor) getOrganization(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.orgs[r.URL.Query().Get("id")]
+	if !ok {
+		writeMockResponse(w, casdoorsdk.Response{Status: "ok", Data: nil})
+		return
+	}
+	writeMockResponse(w, casdoorsdk.Response{Status: "ok", Data: org})
+}
+
+func (m *mockCasdoor) getOrganizations(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	owner := r.URL.Query().Get("owner")
+	var names []string
+	for _, org := range m.orgs {
+		if org.Owner == owner {
+			names = append(names, org.Name)
+		}
+	}
+	total := len(names)
+	page, paginated := paginate(r, names, func(name string) string { return name })
+
+	orgs := make([]*casdoorsdk.Organization, 0, len(page))
+	for _, name := range page {
+		orgs = append(orgs, m.orgs[owner+"/"+name])
+	}
+	resp := casdoorsdk.Response{Status: "ok", Data: orgs}
+	if paginated {
+		resp.Data2 = total
+	}
+	writeMockResponse(w, resp)
+}
+
+func (m *mockCasdoor) addUser(w http.ResponseWriter, r *http.Request) {
+	var user casdoorsdk.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil || user.Name == "" {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "invalid user"})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.orgs["admin/"+user.Owner]; !ok && user.Owner != casdoorOrganization {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: fmt.Sprintf("The organization: %s does not exist", user.Owner)})
+		return
+	}
+	id := user.GetId()
+	if _, ok := m.users[id]; ok {
+		writeAffected(w, false)
+		return
+	}
+	m.users[id] = &user
+	writeAffected(w, true)
+}
+
+// Batch user import: a spreadsheet whose header row names the user fields.
+// Like Casdoor, existing users are skipped and the upload only fails when it
+// adds no user at all.
+func (m *mockCasdoor) uploadUsers(w http.ResponseWriter, r *http.Request) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: fmt.Sprintf("invalid upload: %v", err)})
+		return
+	}
+	defer file.Close()
+	sheet, err := excelize.OpenReader(file)
+	if err != nil {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: fmt.Sprintf("invalid spreadsheet: %v", err)})
+		return
+	}
+	defer sheet.Close()
+	rows, err := sheet.GetRows(sheet.GetSheetName(0))
+	if err != nil || len(rows) < 2 {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "Failed to import users"})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added := 0
+	for _, row := range rows[1:] {
+		fields := map[string]string{}
+		for i, column := range rows[0] {
+			if i < len(row) {
+				fields[column] = row[i]
+			}
+		}
+		user := &casdoorsdk.User{
+			Owner:       fields["owner"],
+			Name:        fields["name"],
+			CreatedTime: fields["createdTime"],
+			Type:        fields["type"],
+			Password:    fields["password"],
+			DisplayName: fields["displayName"],
+			Email:       fields["email"],
+			Phone:       fields["phone"],
+			CountryCode: fields["countryCode"],
+		}
+		if _, ok := m.orgs["admin/"+user.Owner]; !ok || user.Name == "" {
+			continue
+		}
+		if _, ok := m.users[user.GetId()]; ok {
+			continue
+		}
+		m.users[user.GetId()] = user
+		added++
+	}
+	if added == 0 {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "Failed to import users"})
+		return
+	}
+	writeMockResponse(w, casdoorsdk.Response{Status: "ok"})
+}
+
+func (m *mockCasdoor) deleteUser(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := r.URL.Query().Get("id")
+	_, ok := m.users[id]
+	delete(m.users, id)
+	writeAffected(w, ok)
+}
+
+func (m *mockCasdoor) getUser(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[r.URL.Query().Get("id")]
+	if !ok {
+		writeMockResponse(w, casdoorsdk.Response{Status: "ok", Data: nil})
+		return
+	}
+	writeMockResponse(w, casdoorsdk.Response{Status: "ok", Data: user})
+}
+
+func (m *mockCasdoor) getUsers(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	owner := r.URL.Query().Get("owner")
+	var names []string
+	for _, user := range m.users {
+		if user.Owner == owner {
+			names = append(names, user.Name)
+		}
+	}
+	total := len(names)
+	page, paginated := paginate(r, names, func(name string) string { return name })
+
+	users := make([]*casdoorsdk.User, 0, len(page))
+	for _, name := range page {
+		users = append(users, m.users[owner+"/"+name])
+	}
+	resp := casdoorsdk.Response{Status: "ok", Data: users}
+	if paginated {
+		resp.Data2 = total
+	}
+	writeMockResponse(w, resp)
+}
+
+// Find the user behind a login of the configured organization; callers hold m.mu
+func (m *mockCasdoor) checkPassword(username, password string) (*casdoorsdk.User, bool) {
+	user, ok := m.users[casdoorOrganization+"/"+username]
+	if !ok || user.Password != password {
+		return nil, false
+	}
+	return user, true
+}
+
+// Sign in with a password and hand out an authorization code
+func (m *mockCasdoor) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Type     string `json:"type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Type != "code" {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "unsupported login request"})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.checkPassword(req.Username, req.Password)
+	if !ok {
+		writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "password or code is incorrect"})
+		return
+	}
+	code := fmt.Sprintf("%x", m.rng.Int63())
+	m.codes[code] = user.GetId()
+	writeMockResponse(w, casdoorsdk.Response{Status: "ok", Data: code})
+}
+
+// Token endpoint supporting the password and authorization_code grants
+func (m *mockCasdoor) accessToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+
+	m.mu.Lock()
+	var user *casdoorsdk.User
+	var ok bool
+	switch r.Form.Get("grant_type") {
+	case "password":
+		user, ok = m.checkPassword(r.Form.Get("username"), r.Form.Get("password"))
+	case "authorization_code":
+		var id string
+		id, ok = m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		user = m.users[id]
+		ok = ok && user != nil
+	default:
+		m.mu.Unlock()
+		writeTokenError(w, "unsupported_grant_type")
+		return
+	}
+	m.mu.Unlock()
+	if !ok {
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"owner":     user.Owner,
+		"name":      user.Name,
+		"sub":       user.GetId(),
+		"iss":       casdoorEndpoint,
+		"aud":       []string{r.Form.Get("client_id")},
+		"iat":       now.Unix(),
+		"nbf":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+		"tokenType": "access-token",
+	}).SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": token,
+		"id_token":     token,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"scope":        r.Form.Get("scope"),
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// Run the serve-mock command: serve the mock Casdoor until the process is killed
+func runServeMock(args []string) {
+	fs := flag.NewFlagSet("serve-mock", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8000", "Address the mock server listens on")
+	certOut := fs.String("cert-out", "mock_cert.pem", "File the certificate of the token signing key is written to")
+	var cfg mockConfig
+	fs.DurationVar(&cfg.latency, "latency", 0, "Base latency added to every request")
+	fs.DurationVar(&cfg.jitter, "jitter", 0, "Random extra latency added to every request")
+	fs.Float64Var(&cfg.errorRate, "error-rate", 0, "Share of requests answered with HTTP 500 (0-1)")
+	fs.Float64Var(&cfg.rejectRate, "reject-rate", 0, "Share of requests answered with a Casdoor error status (0-1)")
+	fs.Parse(args)
+
+	mock, err := newMockCasdoor(cfg)
+	if err != nil {
+		log.Fatalf("Error creating mock server: %v", err)
+	}
+	if err := os.WriteFile(*certOut, mock.cert, 0644); err != nil {
+		log.Fatalf("Error writing certificate: %v", err)
+	}
+
+	fmt.Printf("Mock Casdoor listening on http://%s, token certificate written to %s\n", *addr, *certOut)
+	if err := http.ListenAndServe(*addr, mock); err != nil {
+		log.Fatalf("Mock server failed: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/casdoor/casdoor-go-sdk/casdoorsdk"
+)
+
+// Create a mock with cfg and serve it through wrap (none when nil), pointing
+// the SDK, the globals of a run and the organizations file at it; everything
+// is restored when the test ends
+func startMock(t *testing.T, cfg mockConfig, wrap func(http.Handler) http.Handler) *mockCasdoor {
+	t.Helper()
+	m, err := newMockCasdoor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handler http.Handler = m
+	if wrap != nil {
+		handler = wrap(m)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	prevEndpoint, prevBreaker, prevDashboard, prevUsers := casdoorEndpoint, breaker, dashboardMode, usersPerOrg
+	prevOrgs, prevUserCreation := createdOrgs, userCreation
+	t.Cleanup(func() {
+		casdoorEndpoint, breaker, dashboardMode, usersPerOrg = prevEndpoint, prevBreaker, prevDashboard, prevUsers
+		createdOrgs.close()
+		createdOrgs, userCreation = prevOrgs, prevUserCreation
+	})
+
+	casdoorEndpoint = srv.URL
+	casdoorsdk.InitConfig(casdoorEndpoint, clientID, clientSecret, string(m.cert), casdoorOrganization, casdoorApplication)
+	casdoorsdk.SetHttpClient(httpClient)
+	breaker = nil
+	dashboardMode = "off"
+	createdOrgs = &orgCheckpoint{path: filepath.Join(t.TempDir(), "created_orgs.txt")}
+	if err := createdOrgs.open(); err != nil {
+		t.Fatal(err)
+	}
+	userCreation = newLatencyStats("Organization user creation")
+	return m
+}
+
+// Answer every nth request to path with a Casdoor error status instead of
+// passing it on
+func rejectEvery(n int, path string) func(http.Handler) http.Handler {
+	var requests int32
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == path && atomic.AddInt32(&requests, 1)%int32(n) == 0 {
+				writeMockResponse(w, casdoorsdk.Response{Status: "error", Msg: "test: rejected"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Run fn and return what it printed to stdout
+func captureReport(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+// Fail unless every line is part of the report
+func assertReportLines(t *testing.T, report string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(report, line) {
+			t.Errorf("report lacks %q:\n%s", line, report)
+		}
+	}
+}
+
+// Organizations and users stored by the mock
+func (m *mockCasdoor) counts() (orgs, users int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.orgs), len(m.users)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Entity naming. Names are built from the run ID, the name template and the
+// position of the entity in the run, so that every name is unique,
+// reproducible with -run-id and traceable to its run.
+var (
+	runID        = time.Now().UTC().Format("20060102-150405")
+	nameTemplate = "TestOrg_{run}_{path}" // Placeholders: {run}, {kind}, {path}
+)
+
+// Position of an entity below its parent, e.g. "org-3"; indices are 1-based
+func entityPath(parent, kind string, index int) string {
+	if parent == "" {
+		return fmt.Sprintf("%s-%d", kind, index)
+	}
+	return fmt.Sprintf("%s-%s-%d", parent, kind, index)
+}
+
+// Name of the entity of the given kind at path
+func entityName(kind, path string) string {
+	return strings.NewReplacer("{run}", runID, "{kind}", kind, "{path}", path).Replace(nameTemplate)
+}
+
+// Part of the names shared by all entities of a kind in this run, used to
+// filter paginated reads down to the run's entities
+func namePrefix(kind string) string {
+	prefix := strings.SplitN(nameTemplate, "{path}", 2)[0]
+	return strings.NewReplacer("{run}", runID, "{kind}", kind).Replace(prefix)
+}
+
+// The path is the only part that differs between the entities of a run
+func validateNameTemplate(template string) error {
+	if !strings.Contains(template, "{path}") {
+		return fmt.Errorf("name template %q lacks the {path} placeholder", template)
+	}
+	return nil
+}
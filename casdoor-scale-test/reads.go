@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/casdoor/casdoor-go-sdk/casdoorsdk"
+)
+
+// Read operations exercised by the read benchmark, in round-robin order
+var readOperations = []string{"GetOrganizations", "GetUsers", "Paginated organizations", "Paginated users"}
+
+// Number of created organizations the read benchmark picks its targets from
+const readSampleSize = 1000
+
+// Organizations created successfully so far, appended to a file as they are
+// created so that memory does not grow with the number of organizations.
+// The read benchmark samples its targets from the file.
+type orgCheckpoint struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	count int
+}
+
+// Create the file, truncating the one of an earlier run
+func (c *orgCheckpoint) open() error {
+	file, err := os.Create(c.path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %v", c.path, err)
+	}
+	c.file = file
+	return nil
+}
+
+func (c *orgCheckpoint) close() {
+	if c.file != nil {
+		c.file.Close()
+	}
+}
+
+// Append a created organization
+func (c *orgCheckpoint) add(orgName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.WriteString(orgName + "\n"); err != nil {
+		log.Printf("Error writing %s: %v", c.path, err)
+		return
+	}
+	c.count++
+}
+
+// Return up to n organizations picked uniformly from the file, and the
+// number of organizations created so far
+func (c *orgCheckpoint) sample(n int) ([]string, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil, c.count, err
+	}
+	defer file.Close()
+
+	// Reservoir sampling: the i-th name replaces a random one with probability n/i
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for i := 0; scanner.Scan(); i++ {
+		switch {
+		case len(names) < n:
+			names = append(names, scanner.Text())
+		case rand.Intn(i+1) < n:
+			names[rand.Intn(n)] = scanner.Text()
+		}
+	}
+	return names, c.count, scanner.Err()
+}
+
+// Run the read benchmark against a sample of the organizations created so far
+func runCreatedOrgReads(ctx context.Context, reads readOptions) readCheckpoint {
+	orgNames, numOrgs, err := createdOrgs.sample(readSampleSize)
+	if err != nil {
+		log.Printf("Error reading %s: %v", createdOrgs.path, err)
+		orgNames = nil
+	}
+	return runReadBenchmark(ctx, orgNames, numOrgs, usersPerOrg, reads.requests, reads.concurrency, reads.pageSize)
+}
+
+// Read latencies measured at one point of the population phase
+type readCheckpoint struct {
+	orgs    int
+	users   int
+	elapsed time.Duration
+	results map[string]latencySummary
+}
+
+// Return a client scoped to the given owner organization
+func orgClient(owner string) *casdoorsdk.Client {
+	return casdoorsdk.NewClient(casdoorEndpoint, clientID, clientSecret, "", owner, casdoorApplication)
+}
+
+// Perform one read operation against a random organization of the sample;
+// numOrgs is the size of the whole population
+func performRead(op string, orgNames []string, numOrgs, usersPerOrg, pageSize int) error {
+	orgName := orgNames[rand.Intn(len(orgNames))]
+
+	switch op {
+	case "GetOrganizations":
+		_, err := orgClient("admin").GetOrganizations()
+		return err
+	case "GetUsers":
+		_, err := orgClient(orgName).GetUsers()
+		return err
+	case "Paginated organizations":
+		client := orgClient("admin")
+		pages := (numOrgs + pageSize - 1) / pageSize
+		query := map[string]string{
+			"owner":    "admin",
+			"p":        strconv.Itoa(rand.Intn(pages) + 1),
+			"pageSize": strconv.Itoa(pageSize),
+			"field":    "name",
+			"value":    namePrefix("org"),
+		}
+		_, err := client.DoGetResponse(client.GetUrl("get-organizations", query))
+		return err
+	case "Paginated users":
+		pages := (usersPerOrg + pageSize - 1) / pageSize
+		if pages < 1 {
+			pages = 1
+		}
+		query := map[string]string{"field": "name", "value": "user_"}
+		_, _, err := orgClient(orgName).GetPaginationUsers(rand.Intn(pages)+1, pageSize, query)
+		return err
+	}
+	return fmt.Errorf("unknown read operation %q", op)
+}
+
+// Run numRequests read requests at the given concurrency against orgNames, a
+// sample of the numOrgs organizations created so far, and report the latency
+// of every operation
+func runReadBenchmark(ctx context.Context, orgNames []string, numOrgs, usersPerOrg, numRequests, concurrency, pageSize int) readCheckpoint {
+	checkpoint := readCheckpoint{
+		orgs:    numOrgs,
+		users:   numOrgs * usersPerOrg,
+		results: make(map[string]latencySummary),
+	}
+	if len(orgNames) == 0 || numRequests <= 0 {
+		return checkpoint
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+
+	consolef("Running read benchmark with %d organizations and %d users...\n", checkpoint.orgs, checkpoint.users)
+	log.Printf("Running read benchmark with %d organizations and %d users\n", checkpoint.orgs, checkpoint.users)
+
+	stats := make(map[string]*latencyStats, len(readOperations))
+	for _, op := range readOperations {
+		stats[op] = newLatencyStats(op)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	start := time.Now()
+	for i := 0; i < numRequests && ctx.Err() == nil; i++ {
+		op := readOperations[i%len(readOperations)]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(op string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			reqStart := time.Now()
+			err := performRead(op, orgNames, numOrgs, usersPerOrg, pageSize)
+			if err != nil {
+				logRequest(withLogFields(ctx, op, ""), time.Since(reqStart), err)
+				stats[op].fail(err.Error())
+				return
+			}
+			stats[op].record(time.Since(reqStart))
+		}(op)
+	}
+	wg.Wait()
+	checkpoint.elapsed = time.Since(start)
+
+	for _, op := range readOperations {
+		stats[op].report(checkpoint.elapsed)
+		checkpoint.results[op] = stats[op].summary()
+	}
+	return checkpoint
+}
+
+// Print and log how read latency evolved as the population grew
+func reportReadGrowth(checkpoints []readCheckpoint) {
+	if len(checkpoints) == 0 {
+		return
+	}
+	lines := []string{fmt.Sprintf("%-8s %-8s %-24s %-12s %-12s %-12s %s", "Orgs", "Users", "Operation", "p50", "p95", "p99", "Failed")}
+	for _, cp := range checkpoints {
+		for _, op := range readOperations {
+			res, ok := cp.results[op]
+			if !ok {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%-8d %-8d %-24s %-12v %-12v %-12v %d", cp.orgs, cp.users, op, res.p50, res.p95, res.p99, res.failed))
+		}
+	}
+
+	fmt.Println("Read latency by population size:")
+	log.Println("Read latency by population size:")
+	for _, line := range lines {
+		fmt.Println(line)
+		log.Println(line)
+	}
+}
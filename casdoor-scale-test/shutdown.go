@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Install the signal handler and return the context that stops the run. The
+// first SIGINT/SIGTERM cancels it: no new batch or request is started and the
+// SDK requests in flight are allowed to finish, while the token requests of
+// the login phase, made outside the SDK, are canceled. The SDK calls cannot be
+// canceled, so the second signal exits immediately.
+func handleShutdown() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		consolef("\nReceived %v, finishing in-flight requests (send again to exit immediately)...\n", sig)
+		log.Printf("Received %v, no new work is started\n", sig)
+		cancel()
+
+		sig = <-signals
+		log.Printf("Received %v again, exiting\n", sig)
+		os.Exit(1)
+	}()
+	return ctx
+}
+
+// Context of a phase, canceled after timeout (no limit when zero)
+func phaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Print and log why a phase stopped before finishing its work; stopped is the
+// error of the phase context, nil when the phase ran to its end
+func reportStopped(stopped error, phase string, timeout time.Duration) {
+	var line string
+	switch stopped {
+	case context.Canceled:
+		line = fmt.Sprintf("%s interrupted: the totals above only cover the work completed before", phase)
+	case context.DeadlineExceeded:
+		line = fmt.Sprintf("%s stopped after its deadline of %v: the totals above only cover the work completed before", phase, timeout)
+	default:
+		return
+	}
+	fmt.Println(line)
+	log.Println(line)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Latencies are counted in buckets instead of being stored, so that the
+// memory of the statistics does not grow with the run. Below
+// 2*histogramSubBuckets nanoseconds every bucket holds one value, above it
+// every power of two is split into histogramSubBuckets buckets, and a bucket
+// is reported as its midpoint, off by at most 1/(2*histogramSubBuckets) (0.8%).
+const histogramSubBuckets = 64
+
+// Bucket of a latency
+func histogramBucket(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	v := uint64(d)
+	if v < 2*histogramSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - bits.Len64(2*histogramSubBuckets-1) // Keeps the top bits of v in [histogramSubBuckets, 2*histogramSubBuckets)
+	return 2*histogramSubBuckets + (shift-1)*histogramSubBuckets + int(v>>shift) - histogramSubBuckets
+}
+
+// Midpoint of the latencies counted in a bucket
+func histogramValue(bucket int) time.Duration {
+	if bucket < 2*histogramSubBuckets {
+		return time.Duration(bucket)
+	}
+	shift := (bucket-2*histogramSubBuckets)/histogramSubBuckets + 1
+	top := uint64((bucket-2*histogramSubBuckets)%histogramSubBuckets + histogramSubBuckets)
+	return time.Duration(top<<shift + 1<<shift/2)
+}
+
+// Collects latencies and failure reasons for one benchmarked operation
+type latencyStats struct {
+	mu       sync.Mutex
+	name     string
+	count    int
+	total    time.Duration
+	max      time.Duration
+	buckets  map[int]int // Histogram bucket -> latencies counted in it
+	failures map[string]int
+}
+
+func newLatencyStats(name string) *latencyStats {
+	return &latencyStats{name: name, buckets: make(map[int]int), failures: make(map[string]int)}
+}
+
+// Record the latency of a successful operation
+func (s *latencyStats) record(d time.Duration) {
+	s.mu.Lock()
+	s.count++
+	s.total += d
+	s.max = max(s.max, d)
+	s.buckets[histogramBucket(d)]++
+	s.mu.Unlock()
+}
+
+// Count a failed operation under the given reason
+func (s *latencyStats) fail(reason string) {
+	reason = strings.TrimSpace(reason) // Server error pages end with a newline
+	s.mu.Lock()
+	s.failures[reason]++
+	s.mu.Unlock()
+}
+
+// Classes failures are counted under when their messages name the entity,
+// so that the failure reasons do not grow with the run
+const (
+	errorNetwork  = "network"
+	errorTimeout  = "timeout"
+	errorCanceled = "canceled"
+	errorRejected = "rejected" // Casdoor answered with an error status or an error page
+	errorNotAdded = "not added"
+)
+
+// Returned when Casdoor answers "ok" without adding the entity
+var errNotAdded = errors.New("not added")
+
+// Class of the error of a request made through the SDK, which does not
+// expose the HTTP status of error responses
+func classifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errNotAdded):
+		return errorNotAdded
+	case errors.Is(err, context.Canceled):
+		return errorCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return errorTimeout
+	case errors.As(err, new(*url.Error)), errors.As(err, &netErr):
+		return errorNetwork
+	}
+	return errorRejected
+}
+
+// Return the p-th percentile (0-100) of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p / 100)
+	return sorted[idx]
+}
+
+// Aggregated view of the collected latencies
+type latencySummary struct {
+	count                   int
+	failed                  int
+	avg, p50, p95, p99, max time.Duration
+}
+
+// Return the p-th percentile (0-100) of the histogram, picking the same rank
+// as percentile does on the sorted latencies; the caller holds mu
+func (s *latencyStats) histogramPercentile(buckets []int, p float64) time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	rank := int(float64(s.count-1) * p / 100)
+	seen := 0
+	for _, b := range buckets {
+		seen += s.buckets[b]
+		if seen > rank {
+			// The midpoint of the highest bucket may lie above the largest latency
+			return min(histogramValue(b), s.max)
+		}
+	}
+	return s.max
+}
+
+// Compute the current summary without resetting the collected latencies
+func (s *latencyStats) summary() latencySummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := make([]int, 0, len(s.buckets))
+	for b := range s.buckets {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+
+	sum := latencySummary{
+		count: s.count,
+		p50:   s.histogramPercentile(buckets, 50),
+		p95:   s.histogramPercentile(buckets, 95),
+		p99:   s.histogramPercentile(buckets, 99),
+		max:   s.max,
+	}
+	if s.count > 0 {
+		sum.avg = s.total / time.Duration(s.count)
+	}
+	for _, n := range s.failures {
+		sum.failed += n
+	}
+	return sum
+}
+
+// Print and log the summary for this operation; elapsed is the wall time of the phase
+func (s *latencyStats) report(elapsed time.Duration) {
+	sum := s.summary()
+	var throughput float64
+	if elapsed > 0 {
+		throughput = float64(sum.count) / elapsed.Seconds()
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s: %d succeeded, %d failed in %v (%.2f/s)", s.name, sum.count, sum.failed, elapsed, throughput),
+		fmt.Sprintf("%s latency: avg %v, p50 %v, p95 %v, p99 %v, max %v", s.name, sum.avg, sum.p50, sum.p95, sum.p99, sum.max),
+	}
+
+	s.mu.Lock()
+	reasons := make([]string, 0, len(s.failures))
+	for reason := range s.failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return s.failures[reasons[i]] > s.failures[reasons[j]] })
+	for _, reason := range reasons {
+		lines = append(lines, fmt.Sprintf("%s failure: %s (x%d)", s.name, reason, s.failures[reason]))
+	}
+	s.mu.Unlock()
+
+	for _, line := range lines {
+		fmt.Println(line)
+		log.Println(line)
+	}
+}
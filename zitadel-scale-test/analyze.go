@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lines of application.log understood by the analyzer. Runs before the error
+// classes were introduced logged "Op: entity failed on attempt N after D.
+// Retrying..." and the response status of every request without its route;
+// later runs log JSON objects, see logEntry.
+var (
+	logTimestamp  = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})(?:\.\d+)? (?:\S+\.go:\d+: )?(.*)$`)
+	logSucceeded  = regexp.MustCompile(`^(.+?): .+ succeeded\. Time taken: (\S+)$`)
+	logFailed     = regexp.MustCompile(`^(.+?): .+ failed on attempt \d+ after \S+?[,.]? ?(.*)$`)
+	logErrorClass = regexp.MustCompile(`with a (?:non-retryable )?(\S+) error`)
+	logStatus     = regexp.MustCompile(`^(?:Response status|((?:GET|POST|PUT|PATCH|DELETE) \S+|gRPC \S+)): (\d{3} .*|[A-Za-z]+)`)
+	logRunID      = regexp.MustCompile(`^Run ID: ([^,]+)`)
+	logPathID     = regexp.MustCompile(`/[^/ ]*[0-9][^/ ]*`)
+	logAPIVersion = regexp.MustCompile(`^/v[0-9]+[a-z0-9]*$`)
+)
+
+// Operations whose successes are the entity totals of a creation run
+var analyzedTotals = []struct{ op, label string }{
+	{"Create Organization", "Organizations"},
+	{"Create Project", "Projects"},
+	{"Create Application", "Applications"},
+	{"Create User", "Users"},
+}
+
+// Fields of a JSON log line read by the analyzer
+type logEntry struct {
+	Time       time.Time     `json:"time"`
+	Msg        string        `json:"msg"`
+	RunID      string        `json:"run_id"`
+	Op         string        `json:"op"`
+	Latency    time.Duration `json:"latency"` // Nanoseconds
+	ErrorClass string        `json:"error_class"`
+	Outcome    string        `json:"outcome"`
+	Status     string        `json:"status"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	RPC        string        `json:"rpc"`
+}
+
+// Statistics of one run found in a log
+type loggedRun struct {
+	file        string
+	runID       string
+	first, last time.Time
+	ops         map[string]*latencyStats
+	opOrder     []string
+	responses   map[string]map[string]int // route -> status -> count
+}
+
+func newLoggedRun(file string) *loggedRun {
+	return &loggedRun{file: file, ops: make(map[string]*latencyStats), responses: make(map[string]map[string]int)}
+}
+
+func (r *loggedRun) statsFor(op string) *latencyStats {
+	s, ok := r.ops[op]
+	if !ok {
+		s = newLatencyStats(op)
+		r.ops[op] = s
+		r.opOrder = append(r.opOrder, op)
+	}
+	return s
+}
+
+func (r *loggedRun) seen(at time.Time) {
+	if r.first.IsZero() {
+		r.first = at
+	}
+	r.last = at
+}
+
+// Add one JSON log line to the run's statistics
+func (r *loggedRun) addEntry(e logEntry) {
+	r.seen(e.Time)
+	if e.RunID != "" {
+		r.runID = e.RunID
+	}
+	switch {
+	case e.Msg == "request succeeded" && e.Op != "":
+		r.statsFor(e.Op).record(e.Latency)
+	case e.Msg == "request failed" && e.Op != "":
+		r.statsFor(e.Op).fail(fmt.Sprintf("%s (%s)", e.ErrorClass, e.Outcome))
+	case e.Msg == "response" && e.RPC != "":
+		r.response("gRPC "+e.RPC, e.Status)
+	case e.Msg == "response":
+		r.response(e.Method+" "+e.Path, e.Status)
+	}
+}
+
+// Add one log line of the format before JSON logging to the run's statistics
+func (r *loggedRun) add(at time.Time, msg string) {
+	r.seen(at)
+
+	if m := logRunID.FindStringSubmatch(msg); m != nil {
+		r.runID = m[1]
+		return
+	}
+	if m := logSucceeded.FindStringSubmatch(msg); m != nil {
+		d, err := time.ParseDuration(m[2])
+		if err == nil {
+			r.statsFor(m[1]).record(d)
+		}
+		return
+	}
+	if m := logFailed.FindStringSubmatch(msg); m != nil {
+		// Failures are counted under the same reasons as in live runs
+		class := "unclassified"
+		if c := logErrorClass.FindStringSubmatch(m[2]); c != nil {
+			class = c[1]
+		}
+		var outcome string
+		switch {
+		case strings.Contains(m[2], "non-retryable"):
+			outcome = "not retried"
+		case strings.Contains(m[2], "Giving up"):
+			outcome = "gave up"
+		case strings.Contains(m[2], "retry budget"):
+			outcome = "retry budget exhausted"
+		default:
+			outcome = "retried"
+		}
+		r.statsFor(m[1]).fail(fmt.Sprintf("%s (%s)", class, outcome))
+		return
+	}
+	if m := logStatus.FindStringSubmatch(msg); m != nil {
+		route := m[1]
+		if route == "" {
+			route = "all routes"
+		}
+		r.response(route, m[2])
+	}
+}
+
+// Count a response; REST routes are grouped with their IDs left out, like
+// "GET /v2/users/:id"
+func (r *loggedRun) response(route, status string) {
+	if !strings.HasPrefix(route, "gRPC ") {
+		route = logPathID.ReplaceAllStringFunc(route, func(segment string) string {
+			if logAPIVersion.MatchString(segment) {
+				return segment
+			}
+			return "/:id"
+		})
+	}
+	if r.responses[route] == nil {
+		r.responses[route] = make(map[string]int)
+	}
+	r.responses[route][status]++
+}
+
+// Report the run like a live run reports its creation phase
+func (r *loggedRun) report(n int) {
+	elapsed := r.last.Sub(r.first)
+	header := fmt.Sprintf("Run %d from %s, %s to %s", n, r.file, r.first.Format("2006/01/02 15:04:05"), r.last.Format("15:04:05"))
+	if r.runID != "" {
+		header += ", run ID " + r.runID
+	}
+	fmt.Printf("\n%s:\n", header)
+
+	for _, total := range analyzedTotals {
+		if s, ok := r.ops[total.op]; ok {
+			fmt.Printf("Total %s Created: %d\n", total.label, s.summary().count)
+		}
+	}
+	fmt.Printf("Total Time Taken: %v (from log timestamps)\n", elapsed)
+	for _, op := range r.opOrder {
+		r.ops[op].report(elapsed)
+	}
+
+	routes := make([]string, 0, len(r.responses))
+	for route := range r.responses {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		statuses := make([]string, 0, len(r.responses[route]))
+		for status := range r.responses[route] {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		parts := make([]string, len(statuses))
+		for i, status := range statuses {
+			parts[i] = fmt.Sprintf("%s (x%d)", status, r.responses[route][status])
+		}
+		fmt.Printf("Responses of %s: %s\n", route, strings.Join(parts, ", "))
+	}
+}
+
+// Split a log into runs, each starting at an "Application started" line
+func analyzeLog(path string) ([]*loggedRun, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening log: %v", err)
+	}
+	defer file.Close()
+
+	var runs []*loggedRun
+	run := newLoggedRun(path)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		var entry logEntry
+		if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &entry) == nil {
+			if entry.Msg == "Application started" && !run.first.IsZero() {
+				runs = append(runs, run)
+				run = newLoggedRun(path)
+			}
+			run.addEntry(entry)
+		} else if m := logTimestamp.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil {
+			at, parseErr := time.ParseInLocation("2006/01/02 15:04:05", m[1], time.Local)
+			if parseErr == nil {
+				if m[2] == "Application started" && !run.first.IsZero() {
+					runs = append(runs, run)
+					run = newLoggedRun(path)
+				}
+				run.add(at, m[2])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading log: %v", err)
+		}
+	}
+	if !run.first.IsZero() {
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Report the runs recorded in application.log files of past runs in the
+// format of live runs, so that old and new results can be compared
+func runAnalyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	only := fs.Int("run", 0, "Only report the run with this number (0: all runs)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s analyze [-run N] [application.log ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"application.log"}
+	}
+
+	// The reports must not end up in the logs being read
+	log.SetOutput(ioutil.Discard)
+
+	n := 0
+	for _, path := range paths {
+		runs, err := analyzeLog(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error analyzing %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		for _, run := range runs {
+			// Runs that did not get to create anything, e.g. only printed the usage
+			if len(run.ops) == 0 && len(run.responses) == 0 {
+				continue
+			}
+			n++
+			if *only == 0 || *only == n {
+				run.report(n)
+			}
+		}
+	}
+	if n == 0 {
+		fmt.Println("No runs with API calls found")
+	}
+}
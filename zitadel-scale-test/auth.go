@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope requesting an access token valid for the Zitadel APIs
+const zitadelAPIScope = "openid urn:zitadel:iam:org:project:id:zitadel:aud"
+
+// Source of the access tokens sent with every API request; token gives up
+// when the context of the request is done
+type tokenSource interface {
+	token(ctx context.Context) (string, error)
+}
+
+// Personal access token read from a file or the environment
+type staticToken string
+
+func (t staticToken) token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Service-account key file as downloaded from the Zitadel console
+type serviceAccountKey struct {
+	Type   string `json:"type"`
+	KeyID  string `json:"keyId"`
+	Key    string `json:"key"`
+	UserID string `json:"userId"`
+}
+
+// Obtains access tokens with the JWT-profile grant and caches them. Tokens are
+// refreshed in the background once they are within refreshMargin of expiring,
+// so workers keep using the current token instead of waiting for a new one.
+// Only one token request is in flight at a time; it is sent without holding
+// mu, and workers without a usable token wait for it as long as their
+// request context allows.
+type jwtProfileSource struct {
+	key           serviceAccountKey
+	privateKey    *rsa.PrivateKey
+	issuer        string
+	refreshMargin time.Duration
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+	fetching    *tokenFetch // Token request in flight, nil when none is
+}
+
+// Token request shared by the workers waiting for it
+type tokenFetch struct {
+	done chan struct{} // Closed once the request finished
+	err  error
+}
+
+// Load a service-account key file for the given issuer
+func newJWTProfileSource(keyFile, issuer string, refreshMargin time.Duration) (*jwtProfileSource, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %v", err)
+	}
+
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("decoding key file: %v", err)
+	}
+	if key.KeyID == "" || key.UserID == "" || key.Key == "" {
+		return nil, fmt.Errorf("key file %s lacks keyId, userId or key", keyFile)
+	}
+
+	block, _ := pem.Decode([]byte(key.Key))
+	if block == nil {
+		return nil, fmt.Errorf("key file %s holds no PEM private key", keyFile)
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if pkcs8Err != nil || !ok {
+			return nil, fmt.Errorf("parsing private key: %v", err)
+		}
+		privateKey = rsaKey
+	}
+
+	return &jwtProfileSource{
+		key:           key,
+		privateKey:    privateKey,
+		issuer:        strings.TrimRight(issuer, "/"),
+		refreshMargin: refreshMargin,
+	}, nil
+}
+
+func (s *jwtProfileSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	now := time.Now()
+	if s.accessToken != "" && now.Before(s.expiry.Add(-s.refreshMargin)) {
+		token := s.accessToken
+		s.mu.Unlock()
+		return token, nil
+	}
+
+	// Still valid but about to expire: refresh in the background
+	if s.accessToken != "" && now.Before(s.expiry) {
+		token := s.accessToken
+		s.startFetch()
+		s.mu.Unlock()
+		return token, nil
+	}
+
+	// No usable token: wait for the request in flight, or start one
+	fetch := s.startFetch()
+	s.mu.Unlock()
+	select {
+	case <-fetch.done:
+	case <-ctx.Done():
+		return "", fmt.Errorf("waiting for access token: %w", ctx.Err())
+	}
+	if fetch.err != nil {
+		return "", fetch.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accessToken, nil
+}
+
+// Start a token request unless one is in flight, and return it; the caller
+// holds mu
+func (s *jwtProfileSource) startFetch() *tokenFetch {
+	if s.fetching != nil {
+		return s.fetching
+	}
+	fetch := &tokenFetch{done: make(chan struct{})}
+	s.fetching = fetch
+	go func() {
+		// Shared by every waiting worker, so not bound to one worker's
+		// request; a second signal and the request timeout still end it
+		ctx, cancel := requestContext()
+		token, expiry, err := s.fetch(ctx)
+		cancel()
+
+		s.mu.Lock()
+		refreshed := s.accessToken != ""
+		if err == nil {
+			s.accessToken, s.expiry = token, expiry
+		}
+		fetch.err = err
+		s.fetching = nil
+		s.mu.Unlock()
+		close(fetch.done)
+
+		switch {
+		case err != nil && refreshed:
+			log.Printf("Refreshing access token failed, keeping the current one while it is valid: %v", err)
+		case err == nil && refreshed:
+			log.Printf("Access token refreshed, valid until %v", expiry.Format(time.RFC3339))
+		}
+	}()
+	return fetch
+}
+
+// Sign an assertion with the service-account key
+func (s *jwtProfileSource) assertion() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.key.KeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": s.key.UserID,
+		"sub": s.key.UserID,
+		"aud": s.issuer,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing assertion: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Exchange a fresh assertion for an access token
+func (s *jwtProfileSource) fetch(ctx context.Context) (string, time.Time, error) {
+	assertion, err := s.assertion()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"scope":      {zitadelAPIScope},
+		"assertion":  {assertion},
+	}
+	// Token requests must not go through the authenticating client
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.issuer+"/oauth/v2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("creating token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := plainClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting access token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("reading token response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token request failed, status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return "", time.Time{}, fmt.Errorf("decoding token response: %v", err)
+	}
+	if tokenResponse.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token response contains no access token: %s", string(body))
+	}
+	return tokenResponse.AccessToken, time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second), nil
+}
+
+// Pick the credentials: a service-account key, else a PAT from a file, else
+// a PAT from the ZITADEL_TOKEN environment variable
+func newTokenSource(keyFile, tokenFile, issuer string, refreshMargin time.Duration) (tokenSource, error) {
+	if keyFile != "" {
+		return newJWTProfileSource(keyFile, issuer, refreshMargin)
+	}
+	if tokenFile != "" {
+		data, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading token file: %v", err)
+		}
+		return staticToken(strings.TrimSpace(string(data))), nil
+	}
+	if token := os.Getenv("ZITADEL_TOKEN"); token != "" {
+		return staticToken(token), nil
+	}
+	return nil, fmt.Errorf("no credentials: pass -key-file or -token-file, or set ZITADEL_TOKEN")
+}
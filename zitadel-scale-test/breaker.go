@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Returned instead of calling the API once the breaker has aborted the run
+var errCircuitOpen = errors.New("circuit breaker open, run aborted")
+
+// Actions taken when the breaker opens
+const (
+	breakerOff   = "off"
+	breakerPause = "pause"
+	breakerAbort = "abort"
+)
+
+// Circuit breaker watching the outcome of API calls. It opens when the error
+// rate over the last window calls, or the number of consecutive failures,
+// crosses its threshold. An open breaker either holds every caller until the
+// health probe succeeds again (pause) or fails all further calls (abort).
+type circuitBreaker struct {
+	window         int           // Number of recent calls the error rate is computed over
+	maxErrorRate   float64       // Error rate over a full window that opens the breaker
+	maxConsecutive int           // Consecutive failures that open the breaker (0 disables)
+	action         string        // breakerPause or breakerAbort
+	probeInterval  time.Duration // Delay between two health probes while paused
+	probe          func(ctx context.Context) error
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	outcomes    []bool // Ring buffer of the last window outcomes, true for a failure
+	next        int
+	filled      int
+	failures    int
+	consecutive int
+	open        bool
+	openedAt    time.Time
+	probing     bool // Whether a health probe loop is running
+	aborted     bool
+	reason      string
+	trips       int
+	pausedFor   time.Duration
+}
+
+// Breaker used by retryWithBackoff; nil when disabled
+var breaker *circuitBreaker
+
+func newCircuitBreaker(action string, window int, maxErrorRate float64, maxConsecutive int, probeInterval time.Duration, probe func(ctx context.Context) error) *circuitBreaker {
+	b := &circuitBreaker{
+		window:         window,
+		maxErrorRate:   maxErrorRate,
+		maxConsecutive: maxConsecutive,
+		action:         action,
+		probeInterval:  probeInterval,
+		probe:          probe,
+		outcomes:       make([]bool, window),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Block while the breaker is paused; fail once it has aborted the run or
+// ctx is done. A paused breaker whose probe loop stopped with the context of
+// an earlier phase is probed again under ctx.
+func (b *circuitBreaker) wait(ctx context.Context) error {
+	if b == nil {
+		return ctx.Err()
+	}
+	// Wake up the waiters when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open && !b.aborted && !b.probing && ctx.Err() == nil {
+		b.startProbing(ctx)
+	}
+	for b.open && !b.aborted && ctx.Err() == nil {
+		b.cond.Wait()
+	}
+	if b.aborted {
+		return errCircuitOpen
+	}
+	return ctx.Err()
+}
+
+// Report whether the breaker has aborted the run, without blocking
+func (b *circuitBreaker) hasAborted() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.aborted
+}
+
+// Record the outcome of a call, opening the breaker if a threshold is crossed;
+// the health probes of a paused breaker stop once ctx is done
+func (b *circuitBreaker) record(ctx context.Context, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.filled == b.window && b.outcomes[b.next] {
+		b.failures--
+	}
+	b.outcomes[b.next] = failed
+	b.next = (b.next + 1) % b.window
+	if b.filled < b.window {
+		b.filled++
+	}
+	if failed {
+		b.failures++
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+
+	if b.open {
+		return
+	}
+	rate := float64(b.failures) / float64(b.filled)
+	switch {
+	case b.maxConsecutive > 0 && b.consecutive >= b.maxConsecutive:
+		b.trip(ctx, fmt.Sprintf("%d consecutive failures", b.consecutive))
+	case b.filled == b.window && rate >= b.maxErrorRate:
+		b.trip(ctx, fmt.Sprintf("error rate %.0f%% over the last %d calls", rate*100, b.window))
+	}
+}
+
+// Open the breaker; called with mu held
+func (b *circuitBreaker) trip(ctx context.Context, reason string) {
+	b.open = true
+	b.openedAt = time.Now()
+	b.reason = reason
+	b.trips++
+	consolef("Circuit breaker opened: %s\n", reason)
+	slog.Warn("circuit breaker opened", "reason", reason)
+
+	if b.action == breakerAbort {
+		b.aborted = true
+		b.cond.Broadcast()
+		return
+	}
+	b.startProbing(ctx)
+}
+
+// Start the probe loop; called with mu held
+func (b *circuitBreaker) startProbing(ctx context.Context) {
+	b.probing = true
+	go b.probeUntilHealthy(ctx)
+}
+
+// Probe the server until it answers again, then close the breaker; give up
+// when ctx is done, leaving the breaker open
+func (b *circuitBreaker) probeUntilHealthy(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(b.probeInterval):
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.probing = false
+			b.mu.Unlock()
+			return
+		}
+		err := b.probe(ctx)
+		if err == nil {
+			break
+		}
+		slog.Warn("health probe failed, dispatch stays paused", "error", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	paused := time.Since(b.openedAt)
+	b.pausedFor += paused
+	b.open = false
+	b.next, b.filled, b.failures, b.consecutive = 0, 0, 0, 0
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+	b.cond.Broadcast()
+	consolef("Circuit breaker closed after %v, resuming dispatch\n", paused.Round(time.Millisecond))
+	log.Printf("Circuit breaker closed after %v, resuming dispatch", paused)
+}
+
+// Print and log what the breaker did during the run
+func (b *circuitBreaker) report() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var line string
+	switch {
+	case b.aborted:
+		line = fmt.Sprintf("Run aborted by the circuit breaker (%s): the totals above only cover the work completed before", b.reason)
+	case b.trips > 0:
+		line = fmt.Sprintf("Circuit breaker opened %d times, dispatch was paused for %v in total", b.trips, b.pausedFor.Round(time.Millisecond))
+	default:
+		return
+	}
+	fmt.Println(line)
+	log.Println(line)
+}
+
+// Health probe against the Zitadel health endpoint; it bypasses the
+// authenticating client so that token refreshes cannot fail the probe
+func probeZitadel(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/debug/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := plainClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings of the live progress view
+var (
+	dashboardMode     = "auto"                 // "auto" (when stdout is a terminal), "on" or "off"
+	dashboardInterval = 500 * time.Millisecond // Delay between two redraws
+)
+
+const (
+	dashboardRecent = 200              // Latest latencies per operation the p95 is computed over
+	dashboardWindow = 10 * time.Second // Span the throughput is computed over
+)
+
+// Live progress view of the current creation phase; nil when it is not
+// shown. Workers started after startDashboard read it directly, other
+// goroutines print through consolef.
+var (
+	dashMu sync.Mutex
+	dash   *dashboard
+)
+
+// Progress of one operation shown in the view
+type dashboardRow struct {
+	op      string
+	total   int             // Entities planned
+	done    int             // Entities created
+	failed  int             // Entities given up on
+	errors  int             // Failed attempts, including retried ones
+	recent  []time.Duration // Ring of the latest latencies
+	next    int             // Position of the next latency in recent
+	history []progressPoint // Created entities at earlier redraws, for the throughput
+}
+
+type progressPoint struct {
+	at   time.Time
+	done int
+}
+
+// Entities created per second over the last dashboardWindow
+func (r *dashboardRow) rate(now time.Time) float64 {
+	r.history = append(r.history, progressPoint{now, r.done})
+	for len(r.history) > 2 && now.Sub(r.history[1].at) >= dashboardWindow {
+		r.history = r.history[1:]
+	}
+	first := r.history[0]
+	if span := now.Sub(first.at); span > 0 {
+		return float64(r.done-first.done) / span.Seconds()
+	}
+	return 0
+}
+
+func (r *dashboardRow) p95() time.Duration {
+	sorted := append([]time.Duration(nil), r.recent...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentile(sorted, 95)
+}
+
+// Redraws completed/total, throughput, errors and recent latencies of every
+// operation in place, below the output printed before it was started
+type dashboard struct {
+	mu       sync.Mutex
+	out      io.Writer
+	start    time.Time
+	rows     []*dashboardRow
+	inFlight int
+	drawn    int // Lines of the last redraw, overwritten by the next one
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// Whether stdout is a terminal that understands cursor movement
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// Show the view, redrawn every dashboardInterval, unless -dashboard or the
+// output do not allow it
+func startDashboard() {
+	if dashboardMode == "off" || dashboardMode == "auto" && !stdoutIsTerminal() {
+		return
+	}
+	d := &dashboard{out: os.Stdout, start: time.Now(), stop: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(dashboardInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.redraw()
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	dashMu.Lock()
+	dash = d
+	dashMu.Unlock()
+}
+
+// Stop redrawing and leave the final state of the view on the screen
+func stopDashboard() {
+	dashMu.Lock()
+	d := dash
+	dash = nil
+	dashMu.Unlock()
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	<-d.stopped
+	d.redraw()
+}
+
+func (d *dashboard) row(op string) *dashboardRow {
+	for _, r := range d.rows {
+		if r.op == op {
+			return r
+		}
+	}
+	r := &dashboardRow{op: op}
+	d.rows = append(d.rows, r)
+	return r
+}
+
+// Add n entities to the planned total of op; negative n removes entities
+// that will not be attempted, e.g. the children of a failed organization
+func (d *dashboard) plan(op string, n int) {
+	if d == nil || n == 0 {
+		return
+	}
+	d.mu.Lock()
+	d.row(op).total += n
+	d.mu.Unlock()
+}
+
+// Count an entity of op as created or given up on
+func (d *dashboard) finished(op string, ok bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if ok {
+		d.row(op).done++
+	} else {
+		d.row(op).failed++
+	}
+	d.mu.Unlock()
+}
+
+// Count an API call of op as in flight until attemptDone
+func (d *dashboard) attempt() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.inFlight++
+	d.mu.Unlock()
+}
+
+// Record the latency of a successful attempt or count a failed one
+func (d *dashboard) attemptDone(op string, latency time.Duration, err error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inFlight--
+	r := d.row(op)
+	if err != nil {
+		r.errors++
+		return
+	}
+	if len(r.recent) < dashboardRecent {
+		r.recent = append(r.recent, latency)
+	} else {
+		r.recent[r.next] = latency
+	}
+	r.next = (r.next + 1) % dashboardRecent
+}
+
+// Print a message above the view, which is redrawn below it; without a view
+// it is printed as is
+func consolef(format string, args ...interface{}) {
+	dashMu.Lock()
+	defer dashMu.Unlock()
+	if dash == nil {
+		fmt.Printf(format, args...)
+		return
+	}
+	dash.mu.Lock()
+	dash.clear()
+	fmt.Fprintf(dash.out, format, args...)
+	dash.mu.Unlock()
+}
+
+// Erase the last redraw; the caller holds mu
+func (d *dashboard) clear() {
+	if d.drawn > 0 {
+		fmt.Fprintf(d.out, "\x1b[%dF\x1b[J", d.drawn)
+		d.drawn = 0
+	}
+}
+
+func (d *dashboard) redraw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	lines := []string{fmt.Sprintf("%-20s %17s %8s %8s %10s %12s", "Operation", "Done/Total", "Failed", "Errors", "Rate/s", "Recent p95")}
+	var rate float64
+	var remaining int
+	for _, r := range d.rows {
+		rowRate := r.rate(now)
+		rate += rowRate
+		remaining += max(r.total-r.done-r.failed, 0)
+		lines = append(lines, fmt.Sprintf("%-20s %17s %8d %8d %10.1f %12v",
+			r.op, fmt.Sprintf("%d/%d", r.done, r.total), r.failed, r.errors, rowRate, r.p95().Round(time.Microsecond)))
+	}
+	eta := "-"
+	switch {
+	case remaining == 0:
+		eta = "0s"
+	case rate > 0:
+		eta = time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	lines = append(lines, fmt.Sprintf("Elapsed %v, %d requests in flight, %.1f entities/s, ETA %s",
+		now.Sub(d.start).Round(time.Second), d.inFlight, rate, eta))
+
+	d.clear()
+	fmt.Fprintln(d.out, strings.Join(lines, "\n"))
+	d.drawn = len(lines)
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Types of the messages exchanged between the coordinator and its agents
+const (
+	msgHello  = "hello"  // agent -> coordinator: ready for a shard
+	msgShard  = "shard"  // coordinator -> agent: the workload to run
+	msgEntity = "entity" // agent -> coordinator: a created entity
+	msgResult = "result" // agent -> coordinator: final totals and statistics
+	msgStop   = "stop"   // coordinator -> agent: stop dispatching new work
+)
+
+// One message, sent as a single JSON line over the TCP connection
+type agentMessage struct {
+	Type   string         `json:"type"`
+	Agent  string         `json:"agent,omitempty"`
+	Shard  *workShard     `json:"shard,omitempty"`
+	Entity *manifestEntry `json:"entity,omitempty"`
+	Result *shardResult   `json:"result,omitempty"`
+}
+
+// Part of the workload assigned to one agent: a range of organizations with
+// their projects, applications and users
+type workShard struct {
+	Index        int              `json:"index"`
+	Agents       int              `json:"agents"`
+	RunID        string           `json:"runId"`
+	NameTemplate string           `json:"nameTemplate"`
+	FirstOrg     int              `json:"firstOrg"` // 1-based index of the first organization
+	Orgs         int              `json:"orgs"`
+	Projects     int              `json:"projects"`
+	Applications int              `json:"applications"`
+	Users        userDistribution `json:"users"` // Users per organization of the whole run
+	Seed         int64            `json:"seed"`  // Seed of the generated user profiles
+	Workers      int              `json:"workers"`
+	TypeWorkers  map[string]int   `json:"type_workers,omitempty"` // Workers of single entity types overriding Workers
+	Rate         float64          `json:"rate"`                   // API calls per second (0: no limit)
+}
+
+// Outcome of a shard, sent by the agent once it is done
+type shardResult struct {
+	Totals  creationTotals  `json:"totals"`
+	Elapsed time.Duration   `json:"elapsed"`
+	Ops     []statsSnapshot `json:"ops"`
+	Stopped bool            `json:"stopped"` // The shard was not completed
+}
+
+// Connection to the other side, with encoding serialized for concurrent senders
+type peerConn struct {
+	conn net.Conn
+	dec  *json.Decoder
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newPeerConn(conn net.Conn) *peerConn {
+	return &peerConn{conn: conn, dec: json.NewDecoder(conn), enc: json.NewEncoder(conn)}
+}
+
+func (p *peerConn) send(msg agentMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enc.Encode(msg)
+}
+
+func (p *peerConn) receive() (agentMessage, error) {
+	var msg agentMessage
+	err := p.dec.Decode(&msg)
+	return msg, err
+}
+
+// Split numOrgs organizations into n contiguous ranges of nearly equal size
+func splitOrgs(numOrgs, n int) (first, count []int) {
+	next := 1
+	for i := 0; i < n; i++ {
+		c := numOrgs / n
+		if i < numOrgs%n {
+			c++
+		}
+		first = append(first, next)
+		count = append(count, c)
+		next += c
+	}
+	return first, count
+}
+
+// A connected agent and what it reported
+type remoteAgent struct {
+	name   string
+	peer   *peerConn
+	shard  workShard
+	result *shardResult
+}
+
+// Function to run the coordinator: wait for numAgents agents on listenAddr,
+// hand each of them a shard of the workload, record the entities they stream
+// back in the manifest and merge their statistics into one report
+func runCoordinator(ctx context.Context, listenAddr string, numAgents, numOrgs, numProjects, numApplications int, rate float64) {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		log.Fatalf("Error listening for agents: %v", err)
+	}
+	defer ln.Close()
+	fmt.Printf("Coordinator listening on %s, waiting for %d agents...\n", ln.Addr(), numAgents)
+	log.Printf("Coordinator listening on %s for %d agents", ln.Addr(), numAgents)
+
+	// Stop accepting when the run is interrupted before all agents joined
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var agents []*remoteAgent
+	for len(agents) < numAgents {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error accepting agent: %v", err)
+			}
+			break
+		}
+		peer := newPeerConn(conn)
+		hello, err := peer.receive()
+		if err != nil || hello.Type != msgHello {
+			log.Printf("Ignoring connection from %s: no hello received (%v)", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		name := fmt.Sprintf("%s (%s)", hello.Agent, conn.RemoteAddr())
+		fmt.Printf("Agent %d/%d joined: %s\n", len(agents)+1, numAgents, name)
+		log.Printf("Agent joined: %s", name)
+		agents = append(agents, &remoteAgent{name: name, peer: peer})
+	}
+	if len(agents) < numAgents {
+		for _, a := range agents {
+			a.peer.conn.Close()
+		}
+		fmt.Println("Run interrupted before all agents joined; nothing was started.")
+		return
+	}
+
+	// Every agent gets a contiguous range of organizations, so entity names
+	// and indices are the same as in a single-process run
+	first, count := splitOrgs(numOrgs, numAgents)
+	startTotal := time.Now()
+	for i, a := range agents {
+		a.shard = workShard{
+			Index:        i + 1,
+			Agents:       numAgents,
+			RunID:        runID,
+			NameTemplate: nameTemplate,
+			FirstOrg:     first[i],
+			Orgs:         count[i],
+			Projects:     numProjects,
+			Applications: numApplications,
+			Users:        userDist,
+			Seed:         identitySeed,
+			Workers:      workerPoolSize,
+			TypeWorkers:  typeWorkers,
+			Rate:         rate / float64(numAgents),
+		}
+		shard := a.shard
+		if err := a.peer.send(agentMessage{Type: msgShard, Shard: &shard}); err != nil {
+			log.Printf("Error sending shard to agent %s: %v", a.name, err)
+		}
+		log.Printf("Shard %d/%d to agent %s: organizations %d-%d", shard.Index, shard.Agents, a.name, shard.FirstOrg, shard.FirstOrg+shard.Orgs-1)
+	}
+
+	// Collect the streams of all agents
+	var mu sync.Mutex
+	var received creationTotals
+	var wg sync.WaitGroup
+	for _, a := range agents {
+		wg.Add(1)
+		go func(a *remoteAgent) {
+			defer wg.Done()
+			defer a.peer.conn.Close()
+			for {
+				msg, err := a.peer.receive()
+				if err != nil {
+					log.Printf("Connection to agent %s closed: %v", a.name, err)
+					return
+				}
+				switch msg.Type {
+				case msgEntity:
+					if msg.Entity == nil {
+						continue
+					}
+					manifest.record(*msg.Entity)
+					mu.Lock()
+					countEntity(&received, msg.Entity.Type)
+					mu.Unlock()
+				case msgResult:
+					mu.Lock()
+					a.result = msg.Result
+					mu.Unlock()
+					return
+				}
+			}
+		}(a)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Report progress until every agent is done; on interrupt, tell the
+	// agents to stop dispatching, and on a second one stop waiting for them
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	stopping := ctx.Done()
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ticker.C:
+			mu.Lock()
+			fmt.Printf("Progress: %d organizations, %d projects, %d applications, %d users\n", received.Orgs, received.Projects, received.Apps, received.Users)
+			mu.Unlock()
+		case <-stopping:
+			stopping = nil
+			fmt.Println("Telling agents to stop...")
+			for _, a := range agents {
+				if err := a.peer.send(agentMessage{Type: msgStop}); err != nil {
+					log.Printf("Error stopping agent %s: %v", a.name, err)
+				}
+			}
+		case <-abortCtx.Done():
+			for _, a := range agents {
+				a.peer.conn.Close()
+			}
+			<-done
+			break wait
+		}
+	}
+	totalDuration := time.Since(startTotal)
+
+	// Merge the results into one report
+	mu.Lock()
+	defer mu.Unlock()
+	var totals creationTotals
+	var missing []string
+	fmt.Println()
+	for _, a := range agents {
+		r := a.result
+		if r == nil {
+			missing = append(missing, a.name)
+			fmt.Printf("Agent %s: no result (organizations %d-%d)\n", a.name, a.shard.FirstOrg, a.shard.FirstOrg+a.shard.Orgs-1)
+			continue
+		}
+		totals.Orgs += r.Totals.Orgs
+		totals.Projects += r.Totals.Projects
+		totals.Apps += r.Totals.Apps
+		totals.Users += r.Totals.Users
+		totals.SkippedProjects += r.Totals.SkippedProjects
+		totals.SkippedApps += r.Totals.SkippedApps
+		totals.SkippedUsers += r.Totals.SkippedUsers
+		for _, snap := range r.Ops {
+			statsFor(snap.Name).merge(snap)
+		}
+		line := fmt.Sprintf("Agent %s: %d organizations, %d projects, %d applications, %d users in %v",
+			a.name, r.Totals.Orgs, r.Totals.Projects, r.Totals.Apps, r.Totals.Users, r.Elapsed)
+		if r.Stopped {
+			line += " (stopped early)"
+		}
+		fmt.Println(line)
+		log.Println(line)
+	}
+
+	fmt.Printf("\nTotal Organizations Created: %d\n", totals.Orgs)
+	fmt.Printf("Total Projects Created: %d\n", totals.Projects)
+	fmt.Printf("Total Applications Created: %d\n", totals.Apps)
+	fmt.Printf("Total Users Created: %d\n", totals.Users)
+	reportSkipped(totals)
+	fmt.Printf("Total Time Taken: %v\n", totalDuration)
+	reportOpStats(totalDuration)
+	if len(missing) > 0 {
+		fmt.Printf("WARNING: %d agents sent no result, their statistics are missing: %v\n", len(missing), missing)
+		log.Printf("Agents without result: %v", missing)
+	}
+	reportStopped(ctx.Err(), "Distributed run", 0)
+}
+
+// Count an entity received from an agent
+func countEntity(t *creationTotals, entityType string) {
+	switch entityType {
+	case entityOrg:
+		t.Orgs++
+	case entityProject:
+		t.Projects++
+	case entityApp:
+		t.Apps++
+	case entityUser:
+		t.Users++
+	}
+}
+
+// Function to run an agent: connect to the coordinator, run the shard it
+// hands out with runConcurrent and stream the results back
+func runAgent(ctx context.Context, coordinatorAddr, transport string) {
+	// Agents may be started before the coordinator listens
+	var conn net.Conn
+	var err error
+	for {
+		conn, err = net.DialTimeout("tcp", coordinatorAddr, 5*time.Second)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		log.Printf("Coordinator %s not reachable, retrying: %v", coordinatorAddr, err)
+		sleepContext(ctx, time.Second)
+	}
+	if err != nil {
+		log.Fatalf("Error connecting to coordinator: %v", err)
+	}
+	defer conn.Close()
+	peer := newPeerConn(conn)
+
+	hostname, _ := os.Hostname()
+	if err := peer.send(agentMessage{Type: msgHello, Agent: fmt.Sprintf("%s/%d", hostname, os.Getpid())}); err != nil {
+		log.Fatalf("Error registering with coordinator: %v", err)
+	}
+	fmt.Printf("Connected to coordinator %s, waiting for a shard...\n", coordinatorAddr)
+
+	msg, err := peer.receive()
+	if err != nil || msg.Type != msgShard || msg.Shard == nil {
+		log.Fatalf("Error receiving shard from coordinator: %v", err)
+	}
+	shard := *msg.Shard
+
+	runID, nameTemplate, identitySeed = shard.RunID, shard.NameTemplate, shard.Seed
+	userDist = newUserDistribution(shard.Users.Kind, shard.Users.Mean, shard.Users.TotalOrgs, shard.Users.ZipfS)
+	if shard.Workers > 0 {
+		workerPoolSize = shard.Workers
+	}
+	if shard.TypeWorkers != nil {
+		typeWorkers = shard.TypeWorkers
+	}
+	limiter = newRateLimiter(shard.Rate)
+	fmt.Printf("Run ID: %s, shard %d/%d: organizations %d-%d\n", runID, shard.Index, shard.Agents, shard.FirstOrg, shard.FirstOrg+shard.Orgs-1)
+	log.Printf("Run ID: %s, name template: %s, transport: %s, shard %d/%d: organizations %d-%d, %d workers (per type: %v), %.1f calls/s",
+		runID, nameTemplate, transport, shard.Index, shard.Agents, shard.FirstOrg, shard.FirstOrg+shard.Orgs-1, workerPoolSize, typeWorkers, shard.Rate)
+
+	// A stop from the coordinator, or losing it, stops dispatching new work
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		for {
+			msg, err := peer.receive()
+			if err != nil {
+				log.Printf("Connection to coordinator closed: %v", err)
+				cancel()
+				return
+			}
+			if msg.Type == msgStop {
+				fmt.Println("Coordinator asked to stop, finishing in-flight requests...")
+				log.Println("Coordinator asked to stop")
+				cancel()
+			}
+		}
+	}()
+
+	// Created entities are streamed to the coordinator, which writes the manifest
+	manifest = forwardingManifest(func(entry manifestEntry) {
+		if err := peer.send(agentMessage{Type: msgEntity, Entity: &entry}); err != nil {
+			log.Printf("Error sending %s %s to coordinator: %v", entry.Type, entry.Name, err)
+		}
+	})
+
+	start := time.Now()
+	totals := runConcurrent(ctx, shard.FirstOrg, shard.Orgs, shard.Projects, shard.Applications)
+	result := shardResult{Totals: totals, Elapsed: time.Since(start), Ops: snapshotOpStats(), Stopped: ctx.Err() != nil}
+	if err := peer.send(agentMessage{Type: msgResult, Result: &result}); err != nil {
+		log.Fatalf("Error sending result to coordinator: %v", err)
+	}
+}
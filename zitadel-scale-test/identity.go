@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Seed of the synthetic identity data; the same seed and run ID produce the
+// same users, whatever the mode, concurrency or sharding
+var identitySeed int64 = 1
+
+// Generated profile of a human user; empty optional fields are not sent
+type identity struct {
+	GivenName         string
+	FamilyName        string
+	NickName          string
+	DisplayName       string
+	PreferredLanguage string
+	Gender            string
+	Email             string
+	EmailVerified     bool
+	Phone             string // E.164, empty for users without phone
+	PhoneVerified     bool
+	Password          string
+}
+
+// A name in its native script and its ASCII transliteration used in emails
+type localName struct {
+	native, latin string
+}
+
+// Names, phone numbering and email domains of a locale
+type locale struct {
+	language     string      // BCP 47 tag sent as preferred language
+	givenNames   []localName // Given names, first half female, second half male
+	familyNames  []localName
+	callingCode  string   // Country calling code of the E.164 numbers
+	mobilePrefix []string // Leading digits of the national mobile numbers
+	digits       int      // Digits after the prefix
+	domains      []string // Local email providers, next to the global ones
+}
+
+var locales = []locale{
+	{
+		language:     "en-US",
+		givenNames:   names("Emily", "Olivia", "Ava", "Madison", "James", "Michael", "Robert", "Daniel"),
+		familyNames:  names("Smith", "Johnson", "Williams", "Brown", "Garcia", "Miller", "O'Connor", "Davis-Lee"),
+		callingCode:  "1",
+		mobilePrefix: []string{"201", "312", "415", "646", "702", "917"},
+		digits:       7,
+		domains:      []string{"comcast.net", "verizon.net"},
+	},
+	{
+		language:     "de-DE",
+		givenNames:   []localName{{"Lea", "lea"}, {"Sophie", "sophie"}, {"Jördis", "joerdis"}, {"Hanna", "hanna"}, {"Jürgen", "juergen"}, {"Björn", "bjoern"}, {"Lukas", "lukas"}, {"Maximilian", "maximilian"}},
+		familyNames:  []localName{{"Müller", "mueller"}, {"Schäfer", "schaefer"}, {"Weiß", "weiss"}, {"Groß", "gross"}, {"Schmidt", "schmidt"}, {"Köhler", "koehler"}},
+		callingCode:  "49",
+		mobilePrefix: []string{"151", "160", "170", "176"},
+		digits:       8,
+		domains:      []string{"web.de", "gmx.de", "t-online.de"},
+	},
+	{
+		language:     "fr-FR",
+		givenNames:   []localName{{"Chloé", "chloe"}, {"Inès", "ines"}, {"Anaïs", "anais"}, {"François", "francois"}, {"Jérôme", "jerome"}, {"Théo", "theo"}},
+		familyNames:  []localName{{"Lefèvre", "lefevre"}, {"Dubois", "dubois"}, {"Girard", "girard"}, {"Bérénger", "berenger"}, {"de la Fontaine", "delafontaine"}},
+		callingCode:  "33",
+		mobilePrefix: []string{"6", "7"},
+		digits:       8,
+		domains:      []string{"orange.fr", "free.fr", "laposte.net"},
+	},
+	{
+		language:     "es-ES",
+		givenNames:   []localName{{"María José", "mariajose"}, {"Lucía", "lucia"}, {"Begoña", "begona"}, {"José", "jose"}, {"Íñigo", "inigo"}, {"Álvaro", "alvaro"}},
+		familyNames:  []localName{{"García López", "garcialopez"}, {"Fernández", "fernandez"}, {"Muñoz", "munoz"}, {"Martín", "martin"}, {"Pérez", "perez"}},
+		callingCode:  "34",
+		mobilePrefix: []string{"6", "7"},
+		digits:       8,
+		domains:      []string{"telefonica.net", "yahoo.es"},
+	},
+	{
+		language:     "pt-BR",
+		givenNames:   []localName{{"Ana Luíza", "analuiza"}, {"Conceição", "conceicao"}, {"Júlia", "julia"}, {"João", "joao"}, {"Antônio", "antonio"}, {"Tomé", "tome"}},
+		familyNames:  []localName{{"Gonçalves", "goncalves"}, {"Araújo", "araujo"}, {"Simões", "simoes"}, {"Silva", "silva"}, {"Conceição", "conceicao"}},
+		callingCode:  "55",
+		mobilePrefix: []string{"119", "219", "319"},
+		digits:       8,
+		domains:      []string{"uol.com.br", "bol.com.br"},
+	},
+	{
+		language:     "pl-PL",
+		givenNames:   []localName{{"Małgorzata", "malgorzata"}, {"Zuzanna", "zuzanna"}, {"Jadwiga", "jadwiga"}, {"Łukasz", "lukasz"}, {"Paweł", "pawel"}, {"Wojciech", "wojciech"}},
+		familyNames:  []localName{{"Wiśniewski", "wisniewski"}, {"Wójcik", "wojcik"}, {"Dąbrowski", "dabrowski"}, {"Szczęsny", "szczesny"}, {"Żak", "zak"}},
+		callingCode:  "48",
+		mobilePrefix: []string{"50", "60", "79"},
+		digits:       7,
+		domains:      []string{"wp.pl", "onet.pl", "o2.pl"},
+	},
+	{
+		language:     "ru-RU",
+		givenNames:   []localName{{"Анастасия", "anastasia"}, {"Екатерина", "ekaterina"}, {"Ольга", "olga"}, {"Дмитрий", "dmitry"}, {"Сергей", "sergey"}, {"Алексей", "alexey"}},
+		familyNames:  []localName{{"Иванов", "ivanov"}, {"Смирнов", "smirnov"}, {"Кузнецов", "kuznetsov"}, {"Попов", "popov"}, {"Соколов", "sokolov"}},
+		callingCode:  "7",
+		mobilePrefix: []string{"903", "916", "926", "985"},
+		digits:       7,
+		domains:      []string{"yandex.ru", "mail.ru"},
+	},
+	{
+		language:     "ar-EG",
+		givenNames:   []localName{{"فاطمة", "fatima"}, {"مريم", "mariam"}, {"نور", "nour"}, {"محمد", "mohamed"}, {"أحمد", "ahmed"}, {"عمر", "omar"}},
+		familyNames:  []localName{{"حسن", "hassan"}, {"إبراهيم", "ibrahim"}, {"عبد الله", "abdallah"}, {"السيد", "elsayed"}},
+		callingCode:  "20",
+		mobilePrefix: []string{"10", "11", "12"},
+		digits:       8,
+		domains:      []string{"yahoo.com.eg"},
+	},
+	{
+		language:     "hi-IN",
+		givenNames:   []localName{{"प्रिया", "priya"}, {"अनन्या", "ananya"}, {"Aditi", "aditi"}, {"राहुल", "rahul"}, {"Arjun", "arjun"}, {"विक्रम", "vikram"}},
+		familyNames:  []localName{{"शर्मा", "sharma"}, {"Patel", "patel"}, {"सिंह", "singh"}, {"Reddy", "reddy"}, {"गुप्ता", "gupta"}},
+		callingCode:  "91",
+		mobilePrefix: []string{"98", "97", "70", "88"},
+		digits:       8,
+		domains:      []string{"rediffmail.com"},
+	},
+	{
+		language:     "zh-CN",
+		givenNames:   []localName{{"秀英", "xiuying"}, {"静", "jing"}, {"丽", "li"}, {"伟", "wei"}, {"强", "qiang"}, {"磊", "lei"}},
+		familyNames:  []localName{{"王", "wang"}, {"李", "li"}, {"张", "zhang"}, {"刘", "liu"}, {"陈", "chen"}, {"欧阳", "ouyang"}},
+		callingCode:  "86",
+		mobilePrefix: []string{"138", "139", "186", "159"},
+		digits:       8,
+		domains:      []string{"qq.com", "163.com"},
+	},
+	{
+		language:     "ja-JP",
+		givenNames:   []localName{{"さくら", "sakura"}, {"陽菜", "hina"}, {"美咲", "misaki"}, {"翔太", "shota"}, {"大輔", "daisuke"}, {"健", "ken"}},
+		familyNames:  []localName{{"佐藤", "sato"}, {"鈴木", "suzuki"}, {"高橋", "takahashi"}, {"田中", "tanaka"}, {"渡辺", "watanabe"}},
+		callingCode:  "81",
+		mobilePrefix: []string{"70", "80", "90"},
+		digits:       8,
+		domains:      []string{"docomo.ne.jp", "yahoo.co.jp"},
+	},
+}
+
+// Providers used by every locale
+var globalDomains = []string{"gmail.com", "outlook.com", "icloud.com", "proton.me", "example.org"}
+
+// Names that are written the same in native and Latin script
+func names(list ...string) []localName {
+	out := make([]localName, len(list))
+	for i, n := range list {
+		out[i] = localName{native: n, latin: strings.ToLower(strings.NewReplacer("'", "", "-", "").Replace(n))}
+	}
+	return out
+}
+
+// Random source of one entity, derived from the seed and the entity name
+func entityRand(name string) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s", identitySeed, name)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+func pick(rng *rand.Rand, list []string) string {
+	return list[rng.Intn(len(list))]
+}
+
+// Generate the profile of the user with the given (unique) username
+func newIdentity(username string) identity {
+	rng := entityRand(username)
+	loc := locales[rng.Intn(len(locales))]
+
+	// Female and male given names are the two halves of the list
+	gi := rng.Intn(len(loc.givenNames))
+	given, family := loc.givenNames[gi], loc.familyNames[rng.Intn(len(loc.familyNames))]
+
+	id := identity{
+		GivenName:  given.native,
+		FamilyName: family.native,
+		Password:   newPassword(rng),
+	}
+
+	// The hash suffix keeps emails unique while most of them still look real
+	h := fnv.New64a()
+	h.Write([]byte(username))
+	suffix := strconv.FormatUint(h.Sum64(), 36)
+	var local string
+	switch rng.Intn(4) {
+	case 0:
+		local = given.latin + "." + family.latin
+	case 1:
+		local = given.latin[:1] + family.latin
+	case 2:
+		local = family.latin + "_" + given.latin
+	default:
+		local = given.latin + fmt.Sprint(1950+rng.Intn(60))
+	}
+	domains := globalDomains
+	if rng.Intn(2) == 0 {
+		domains = loc.domains
+	}
+	id.Email = fmt.Sprintf("%s.%s@%s", local, suffix, pick(rng, domains))
+	id.EmailVerified = rng.Float64() < 0.9
+
+	// Optional fields
+	if rng.Float64() < 0.7 {
+		var b strings.Builder
+		b.WriteString("+" + loc.callingCode + pick(rng, loc.mobilePrefix))
+		for i := 0; i < loc.digits; i++ {
+			b.WriteByte(byte('0' + rng.Intn(10)))
+		}
+		id.Phone = b.String()
+		id.PhoneVerified = rng.Float64() < 0.8
+	}
+	if rng.Float64() < 0.3 {
+		id.NickName = given.latin
+	}
+	if rng.Float64() < 0.5 {
+		id.DisplayName = given.native + " " + family.native
+	}
+	if rng.Float64() < 0.8 {
+		id.PreferredLanguage = loc.language
+	}
+	if rng.Float64() < 0.6 {
+		switch {
+		case rng.Float64() < 0.05:
+			id.Gender = "GENDER_DIVERSE"
+		case gi < len(loc.givenNames)/2:
+			id.Gender = "GENDER_FEMALE"
+		default:
+			id.Gender = "GENDER_MALE"
+		}
+	}
+	return id
+}
+
+// Password that satisfies the default complexity policy (8+ characters with
+// upper and lower case, digit and symbol) in varied lengths and shapes
+func newPassword(rng *rand.Rand) string {
+	const (
+		lower   = "abcdefghijkmnopqrstuvwxyz"
+		upper   = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+		digits  = "23456789"
+		symbols = "!@#$%^&*()-_=+[]{};:,.?/~"
+	)
+	// Passphrases
+	if rng.Intn(4) == 0 {
+		words := []string{"correct", "horse", "battery", "staple", "river", "Lantern", "quartz", "Meadow", "zebra", "orbit"}
+		parts := make([]string, 3+rng.Intn(3))
+		for i := range parts {
+			parts[i] = pick(rng, words)
+		}
+		parts[0] = strings.ToUpper(parts[0][:1]) + parts[0][1:]
+		return strings.Join(parts, string(symbols[rng.Intn(len(symbols))])) + fmt.Sprint(rng.Intn(100)) + "!"
+	}
+
+	// Random characters: one of every class, the rest from all classes
+	all := lower + upper + digits + symbols
+	chars := []byte{lower[rng.Intn(len(lower))], upper[rng.Intn(len(upper))], digits[rng.Intn(len(digits))], symbols[rng.Intn(len(symbols))]}
+	for n := 8 + rng.Intn(17); len(chars) < n; {
+		chars = append(chars, all[rng.Intn(len(all))])
+	}
+	rng.Shuffle(len(chars), func(i, j int) { chars[i], chars[j] = chars[j], chars[i] })
+	return string(chars)
+}
+
+// Request creating the user with the generated profile
+func (id identity) addRequest(userID, username, orgID string) zitadel.AddHumanUserRequest {
+	req := zitadel.AddHumanUserRequest{
+		UserID:       userID,
+		Username:     username,
+		Organization: zitadel.Organization{OrgID: orgID},
+		Profile: zitadel.Profile{
+			GivenName:         id.GivenName,
+			FamilyName:        id.FamilyName,
+			NickName:          id.NickName,
+			DisplayName:       id.DisplayName,
+			PreferredLanguage: id.PreferredLanguage,
+			Gender:            id.Gender,
+		},
+		Email:    zitadel.Email{Email: id.Email, IsVerified: id.EmailVerified},
+		Password: &zitadel.Password{Password: id.Password, ChangeRequired: false},
+	}
+	if id.Phone != "" {
+		req.Phone = &zitadel.Phone{Phone: id.Phone, IsVerified: id.PhoneVerified}
+	}
+	return req
+}
+
+// Display name Zitadel stores for a user created without one
+func defaultDisplayName(displayName, givenName, familyName string) string {
+	if displayName == "" {
+		return givenName + " " + familyName
+	}
+	return displayName
+}
+
+// Preferred language Zitadel stores for a user created without one: "und",
+// the undetermined language
+func defaultLanguage(language string) string {
+	if language == "" {
+		return "und"
+	}
+	return language
+}
+
+// Distributions of the number of users per organization
+const (
+	usersFixed   = "fixed"   // Every organization gets the entered number
+	usersUniform = "uniform" // Uniform between 0 and twice the entered number
+	usersZipf    = "zipf"    // A few large organizations and a long tail of small ones
+)
+
+// Number of users of every organization of a run, with the entered number of
+// users per organization as the mean
+type userDistribution struct {
+	Kind      string  `json:"kind"`
+	Mean      int     `json:"mean"`
+	TotalOrgs int     `json:"totalOrgs"` // Organizations of the whole run, to normalize the Zipf weights
+	ZipfS     float64 `json:"zipfS"`     // Exponent of the Zipf distribution
+
+	zipfSum float64 // Sum of the Zipf weights of all organizations
+}
+
+// Create the distribution of the users of totalOrgs organizations
+func newUserDistribution(kind string, mean, totalOrgs int, zipfS float64) userDistribution {
+	d := userDistribution{Kind: kind, Mean: mean, TotalOrgs: totalOrgs, ZipfS: zipfS}
+	if kind == usersZipf {
+		for k := 1; k <= totalOrgs; k++ {
+			d.zipfSum += math.Pow(float64(k), -zipfS)
+		}
+	}
+	return d
+}
+
+// Users of the organization at index org (1-based)
+func (d userDistribution) count(org int) int {
+	switch d.Kind {
+	case usersUniform:
+		return entityRand(fmt.Sprintf("users/%s/%d", runID, org)).Intn(2*d.Mean + 1)
+	case usersZipf:
+		// The organization with index k gets a share proportional to 1/k^s
+		// of all users of the run
+		if d.zipfSum == 0 {
+			return 0
+		}
+		total := float64(d.Mean * d.TotalOrgs)
+		return int(math.Round(total * math.Pow(float64(org), -d.ZipfS) / d.zipfSum))
+	default:
+		return d.Mean
+	}
+}
+
+// Users distribution of the current run; set by main or the coordinator
+var userDist = userDistribution{Kind: usersFixed}
+
+func validateUserDistribution(d userDistribution) error {
+	switch d.Kind {
+	case usersFixed, usersUniform:
+	case usersZipf:
+		if d.ZipfS <= 0 {
+			return fmt.Errorf("the Zipf exponent must be positive, got %v", d.ZipfS)
+		}
+	default:
+		return fmt.Errorf("invalid users distribution %q, choose '%s', '%s' or '%s'", d.Kind, usersFixed, usersUniform, usersZipf)
+	}
+	return nil
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"zitadel-scale-test/zitadel"
+)
+
+// Settings of the bulk import
+var (
+	importBatch          = 1000             // Users per import request; an organization is never split
+	importConcurrency    = 2                // Concurrent import requests
+	importRequestTimeout = 10 * time.Minute // Time the server works on one import request
+	importTimeout        time.Duration      // Deadline of each path of the import benchmark (0: no limit)
+	importHashCost       = bcrypt.MinCost   // bcrypt cost of the imported password hashes
+)
+
+// Import request of the bulk path with the emails of its users by ID
+type importBatchRequest struct {
+	label  string
+	req    zitadel.ImportDataRequest
+	emails map[string]string
+}
+
+// Outcome of one path of the import benchmark
+type importResult struct {
+	name        string
+	orgs, users int // Imported successfully
+	failedOrgs  int
+	failedUsers int
+	requests    int
+	elapsed     time.Duration
+	errors      map[string]int // Failure reason -> affected entities
+	stopped     error          // Error of the phase context when the path stopped early
+}
+
+func newImportResult(name string) *importResult {
+	return &importResult{name: name, errors: make(map[string]int)}
+}
+
+// Function to compare per-entity creation with the admin bulk import on the
+// same dataset: numOrgs organizations with users drawn from userDist, created
+// once with one request per entity and once with /admin/v1/import
+func runImportBenchmark(ctx context.Context, numOrgs int) {
+	client, ok := api.(*zitadel.Client)
+	if !ok {
+		log.Fatal("Import mode needs -transport rest: the admin import is not available over gRPC")
+	}
+
+	// Both paths get the same organizations and numbers of users. Entity
+	// names start with "single" or "bulk", and profiles are generated from
+	// the names as in every other mode, so scenarios can log in as the users.
+	// Like the users of an organization, they are generated as the paths
+	// reach them, so that memory does not grow with the dataset.
+	var totalUsers int
+	for i := 1; i <= numOrgs; i++ {
+		totalUsers += userDist.count(i)
+	}
+	fmt.Printf("Import dataset: %d organizations, %d users\n", numOrgs, totalUsers)
+	log.Printf("Import dataset: %d organizations, %d users", numOrgs, totalUsers)
+
+	start := time.Now()
+
+	single := runPerEntityImport(ctx, numOrgs)
+	var bulk *importResult
+	if ctx.Err() == nil && !breaker.hasAborted() {
+		bulk = runBulkImport(ctx, client, numOrgs)
+	}
+
+	// Print comparison
+	fmt.Printf("\nImport comparison: %d organizations, %d users\n", numOrgs, totalUsers)
+	log.Printf("Import comparison: %d organizations, %d users", numOrgs, totalUsers)
+	single.report()
+	if bulk != nil {
+		bulk.report()
+		if single.users > 0 && bulk.users > 0 && bulk.elapsed > 0 {
+			line := fmt.Sprintf("Bulk import throughput: %.1fx per-entity creation", bulk.usersPerSecond()/single.usersPerSecond())
+			fmt.Println(line)
+			log.Println(line)
+		}
+	}
+	reportOpStats(time.Since(start))
+	breaker.report()
+	reportHTTPTrace()
+	reportStopped(single.stopped, single.name, importTimeout)
+	if bulk != nil {
+		reportStopped(bulk.stopped, bulk.name, importTimeout)
+	}
+}
+
+// Hash passwords in parallel, -workers at a time
+func hashPasswords(passwords []string) []string {
+	hashes := make([]string, len(passwords))
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < min(workerPoolSize, len(passwords)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hash, err := bcrypt.GenerateFromPassword([]byte(passwords[i]), importHashCost)
+				if err != nil {
+					log.Fatalf("Error hashing password: %v", err)
+				}
+				hashes[i] = string(hash)
+			}
+		}()
+	}
+	for i := range passwords {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return hashes
+}
+
+// Create the dataset with one request per organization and user, users with
+// their plain-text password hashed by the server. The organizations go
+// through the scheduler like in concurrent mode, so only the queued tasks are
+// held in memory.
+func runPerEntityImport(ctx context.Context, numOrgs int) *importResult {
+	fmt.Println("Creating the dataset entity by entity...")
+	ctx, cancel := phaseContext(ctx, importTimeout)
+	defer cancel()
+
+	res := newImportResult("Per-entity creation")
+	var mu sync.Mutex
+	start := time.Now()
+	sched := newScheduler(ctx)
+	for i := 1; i <= numOrgs; i++ {
+		sched.submit(singleOrgTask(i, res, &mu))
+	}
+	sched.wait()
+	res.elapsed = time.Since(start)
+	res.stopped = ctx.Err()
+	return res
+}
+
+// Task creating the organization at index on the per-entity path with its
+// users, counting the outcome in res
+func singleOrgTask(index int, res *importResult, mu *sync.Mutex) *task {
+	orgName := entityName(entityOrg, entityPath("single", entityOrg, index))
+	numUsers := userDist.count(index)
+	return &task{
+		op:   "Per-entity: Create Organization",
+		kind: entityOrg,
+		name: orgName,
+		create: func(ctx context.Context, _ manifestEntry) (manifestEntry, error) {
+			orgID, err := createOrganization(ctx, orgName)
+			return manifestEntry{Type: entityOrg, ID: orgID, Name: orgName}, err
+		},
+		children: func(_ manifestEntry, emit func(*task)) {
+			for l := 1; l <= numUsers; l++ {
+				emit(singleUserTask(index, l, res, mu))
+			}
+		},
+		done: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			res.requests++
+			if err != nil {
+				res.fail(1+numUsers, err)
+				res.failedOrgs++
+				res.failedUsers += numUsers
+				return
+			}
+			res.orgs++
+		},
+	}
+}
+
+// Task creating the user at index user of the organization at index org on
+// the per-entity path, counting the outcome in res
+func singleUserTask(org, user int, res *importResult, mu *sync.Mutex) *task {
+	userName := importUserName("single", org, user)
+	return &task{
+		op:   "Per-entity: Create User",
+		kind: entityUser,
+		name: userName,
+		create: func(ctx context.Context, org manifestEntry) (manifestEntry, error) {
+			id := newIdentity(userName)
+			err := createUser(ctx, userName, userName, id, org.ID)
+			return manifestEntry{Type: entityUser, ID: userName, Name: userName, OrgID: org.ID, Email: id.Email}, err
+		},
+		done: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			res.requests++
+			if err != nil {
+				res.fail(1, err)
+				res.failedUsers++
+				return
+			}
+			res.users++
+		},
+	}
+}
+
+// Import the dataset with /admin/v1/import, packing whole organizations into
+// requests of about importBatch users. A request is generated, and the
+// passwords of its users hashed, when an import worker is about to take it,
+// so that only the requests queued and in flight are held in memory.
+func runBulkImport(ctx context.Context, client *zitadel.Client, numOrgs int) *importResult {
+	fmt.Println("Importing the dataset in bulk...")
+	ctx, cancel := phaseContext(ctx, importTimeout)
+	defer cancel()
+
+	res := newImportResult("Bulk import")
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	batches := make(chan importBatchRequest)
+	for w := 0; w < importConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				importBatchData(ctx, client, batch, res, &mu)
+			}
+		}()
+	}
+
+	start := time.Now()
+	var hashing time.Duration
+	var batchNum int
+	send := func(first, last int) {
+		// Once the run stops, the remaining organizations are not generated
+		stopErr := ctx.Err()
+		if stopErr == nil && breaker.hasAborted() {
+			stopErr = errCircuitOpen
+		}
+		if stopErr != nil {
+			mu.Lock()
+			for i := first; i <= last; i++ {
+				res.failedOrgs++
+				res.failedUsers += userDist.count(i)
+				res.fail(1+userDist.count(i), stopErr)
+			}
+			mu.Unlock()
+			return
+		}
+		batchNum++
+		hashStart := time.Now()
+		req, emails := importRequest(first, last)
+		hashing += time.Since(hashStart)
+		batches <- importBatchRequest{label: fmt.Sprintf("batch %d", batchNum), req: req, emails: emails}
+	}
+	first, users := 1, 0
+	for i := 1; i <= numOrgs; i++ {
+		n := userDist.count(i)
+		if i > first && users+n > importBatch {
+			send(first, i-1)
+			first, users = i, 0
+		}
+		users += n
+	}
+	if numOrgs > 0 {
+		send(first, numOrgs)
+	}
+	close(batches)
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	res.stopped = ctx.Err()
+	fmt.Printf("Generated the requests and hashed their passwords (bcrypt cost %d) in %v, while earlier requests were imported\n", importHashCost, hashing)
+	return res
+}
+
+// Send one import request and count its outcome in res
+func importBatchData(ctx context.Context, client *zitadel.Client, batch importBatchRequest, res *importResult, mu *sync.Mutex) {
+	label, req, emails := batch.label, batch.req, batch.emails
+
+	// The request lasts as long as the server works on the import. An
+	// import is not idempotent, so a request that may have reached the
+	// server is not sent again: it may still have applied all or part of it.
+	var resp *zitadel.ImportDataResponse
+	err := retryWithTimeout(ctx, "Bulk: Import Data", label, importRequestTimeout, func(reqCtx context.Context) error {
+		var err error
+		resp, err = client.ImportData(reqCtx, req)
+		if ambiguousImport(err) {
+			return noRetry(err)
+		}
+		return err
+	})
+	if ambiguousImport(err) && ctx.Err() == nil {
+		log.Printf("Import of %s failed (%v), checking what the server applied", label, err)
+		resp = appliedImport(ctx, req)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	res.requests++
+	if resp != nil {
+		failedBefore := res.failedOrgs + res.failedUsers
+		res.record(req, resp, emails)
+		if missing := res.failedOrgs + res.failedUsers - failedBefore; err != nil && missing > 0 {
+			res.errors[classifyError(err)+" (not applied)"] += missing
+		}
+		return
+	}
+	if err != nil {
+		// Nothing is known to be imported when the request failed
+		for _, org := range req.DataOrgs.Orgs {
+			res.failedOrgs++
+			res.failedUsers += len(org.HumanUsers)
+			res.fail(1+len(org.HumanUsers), err)
+		}
+		return
+	}
+	res.record(req, resp, emails)
+}
+
+// Report whether a failed import request may have been applied by the server:
+// it timed out, the connection broke or the server failed with a 5xx after
+// the request was sent. A 429 or 4xx answer means nothing was imported.
+func ambiguousImport(err error) bool {
+	switch classifyError(err) {
+	case errorTimeout, errorNetwork, errorServer:
+		return true
+	}
+	return false
+}
+
+// Find out which organizations and users of an ambiguously failed import
+// request the server applied, reading the users back by ID: the list and search results
+// may lag behind. An organization counts as applied when one of its users is
+// found in it, or, without users, when the organization search finds it.
+// Entities whose lookup failed count as not applied.
+func appliedImport(ctx context.Context, req zitadel.ImportDataRequest) *zitadel.ImportDataResponse {
+	success := &zitadel.ImportDataSuccess{}
+	for _, org := range req.DataOrgs.Orgs {
+		applied := zitadel.ImportDataSuccessOrg{OrgID: org.OrgID}
+		found := false
+		for _, u := range org.HumanUsers {
+			var user *zitadel.GetUserByIDResponse
+			err := retryWithBackoff(ctx, "Bulk: Check Import", u.UserID, func(reqCtx context.Context) error {
+				var err error
+				user, err = api.GetUserByID(reqCtx, u.UserID)
+				return err
+			})
+			var apiErr *zitadel.APIError
+			switch {
+			case err == nil && user.Details.ResourceOwner == org.OrgID:
+				found = true
+				applied.HumanUserIDs = append(applied.HumanUserIDs, u.UserID)
+			case err == nil:
+				log.Printf("Imported user %s belongs to organization %s, expected %s", u.UserID, user.Details.ResourceOwner, org.OrgID)
+			case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			default:
+				log.Printf("Could not check whether user %s was imported: %v", u.UserID, err)
+			}
+		}
+		if !found && len(org.HumanUsers) == 0 {
+			err := retryWithBackoff(ctx, "Bulk: Check Import", org.OrgID, func(reqCtx context.Context) error {
+				_, err := getOrganizationIDByName(reqCtx, org.Org.Name)
+				return err
+			})
+			found = err == nil
+		}
+		if found {
+			success.Orgs = append(success.Orgs, applied)
+		}
+	}
+	return &zitadel.ImportDataResponse{Success: success}
+}
+
+// Name of the user at index user of the organization at index org, on the
+// given path of the benchmark
+func importUserName(path string, org, user int) string {
+	return entityName(entityUser, entityPath(entityPath(path, entityOrg, org), entityUser, user))
+}
+
+// Build the import request of the organizations at indexes first to last,
+// generating their users and hashing their passwords; emails maps the user
+// IDs to their email
+func importRequest(first, last int) (zitadel.ImportDataRequest, map[string]string) {
+	req := zitadel.ImportDataRequest{Timeout: importRequestTimeout.String()}
+	emails := make(map[string]string)
+	for index := first; index <= last; index++ {
+		orgPath := entityPath("bulk", entityOrg, index)
+		orgName := entityName(entityOrg, orgPath)
+		data := zitadel.ImportDataOrg{OrgID: orgName, Org: zitadel.ImportOrg{Name: orgName}}
+		ids := make([]identity, userDist.count(index))
+		passwords := make([]string, len(ids))
+		for l := range ids {
+			ids[l] = newIdentity(importUserName("bulk", index, l+1))
+			passwords[l] = ids[l].Password
+		}
+		hashes := hashPasswords(passwords)
+		for l, id := range ids {
+			userName := importUserName("bulk", index, l+1)
+			user := zitadel.ImportHumanUserRequest{
+				UserName: userName,
+				Profile: zitadel.ImportProfile{
+					FirstName:         id.GivenName,
+					LastName:          id.FamilyName,
+					NickName:          id.NickName,
+					DisplayName:       id.DisplayName,
+					PreferredLanguage: id.PreferredLanguage,
+					Gender:            id.Gender,
+				},
+				Email:          zitadel.ImportEmail{Email: id.Email, IsEmailVerified: id.EmailVerified},
+				HashedPassword: &zitadel.HashedPassword{Value: hashes[l]},
+			}
+			if id.Phone != "" {
+				user.Phone = &zitadel.ImportPhone{Phone: id.Phone, IsPhoneVerified: id.PhoneVerified}
+			}
+			data.HumanUsers = append(data.HumanUsers, zitadel.ImportHumanUser{UserID: userName, User: user})
+			emails[userName] = id.Email
+		}
+		req.DataOrgs.Orgs = append(req.DataOrgs.Orgs, data)
+	}
+	return req, emails
+}
+
+// Count the imported entities of a batch and the ones reported as errors
+func (r *importResult) record(req zitadel.ImportDataRequest, resp *zitadel.ImportDataResponse, emails map[string]string) {
+	imported := make(map[string]bool)
+	if resp.Success != nil {
+		for _, org := range resp.Success.Orgs {
+			imported[org.OrgID] = true
+			manifest.record(manifestEntry{Type: entityOrg, ID: org.OrgID, Name: org.OrgID})
+			for _, userID := range org.HumanUserIDs {
+				imported[userID] = true
+				manifest.record(manifestEntry{Type: entityUser, ID: userID, Name: userID, OrgID: org.OrgID, Email: emails[userID]})
+			}
+		}
+	}
+	for _, e := range resp.Errors {
+		log.Printf("Import error: %s %s: %s", e.Type, e.ID, e.Message)
+		r.errors[fmt.Sprintf("%s: %s", e.Type, e.Message)]++
+	}
+	for _, org := range req.DataOrgs.Orgs {
+		if imported[org.OrgID] {
+			r.orgs++
+		} else {
+			r.failedOrgs++
+		}
+		for _, u := range org.HumanUsers {
+			if imported[u.UserID] {
+				r.users++
+			} else {
+				r.failedUsers++
+			}
+		}
+	}
+}
+
+// Count n entities that failed with err
+func (r *importResult) fail(n int, err error) {
+	r.errors[classifyError(err)] += n
+}
+
+func (r *importResult) usersPerSecond() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.users) / r.elapsed.Seconds()
+}
+
+// Print and log the throughput and errors of the path
+func (r *importResult) report() {
+	lines := []string{fmt.Sprintf("%s: %d organizations, %d users in %v (%.1f users/s) with %d requests; %d organizations and %d users failed",
+		r.name, r.orgs, r.users, r.elapsed, r.usersPerSecond(), r.requests, r.failedOrgs, r.failedUsers)}
+	reasons := make([]string, 0, len(r.errors))
+	for reason := range r.errors {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return r.errors[reasons[i]] > r.errors[reasons[j]] })
+	for _, reason := range reasons {
+		lines = append(lines, fmt.Sprintf("  %s failure: %s (x%d)", r.name, reason, r.errors[reason]))
+	}
+	for _, line := range lines {
+		fmt.Println(line)
+		log.Println(line)
+	}
+}
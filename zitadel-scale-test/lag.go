@@ -0,0 +1,381 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Settings of the projection lag measurement
+var (
+	lagSample      float64                  // Share of created entities whose lag is measured (0 disables it)
+	lagInterval    = 100 * time.Millisecond // Delay between two searches for the same entity
+	lagTimeout     = 30 * time.Second       // Time after which an entity counts as not visible
+	lagWorkers     = 10                     // Concurrent searches of the measurement
+	lagQueueSize   = 10000                  // Sampled entities waiting for their next search
+	lagResultsFile = "lag_results.csv"
+)
+
+// Lag tracker of the current run; nil when the lag is not measured
+var lag *lagTracker
+
+// Measures how long created entities take to show up in list and search
+// endpoints, which Zitadel serves from asynchronously updated projections.
+// Every sample is also filed under the write rate at the time the entity was
+// created, so that the lag can be compared across write loads.
+type lagTracker struct {
+	writes    int64 // Entities created so far
+	writeRate int64 // Entities created during the last second
+	lastWrite int64 // Creation time of the latest entity, in Unix nanoseconds
+
+	mu          sync.Mutex
+	stats       map[string]*latencyStats // Entity type, or type and write load -> lag
+	notMeasured map[string]int           // Entity type, or type and write load -> samples given up without a result
+	reasons     map[string]int           // Why samples were not measured -> count
+	wg          sync.WaitGroup           // Sampled entities not yet found or given up on
+	started     sync.Once                // The write rate is measured and the workers started from the first created entity
+	start       time.Time
+	done        chan struct{}
+
+	queueMu sync.Mutex
+	queue   lagQueue // Sampled entities by the time of their next search
+	ready   *sync.Cond
+	closed  bool // Set once every poll finished, stopping the workers
+}
+
+// Min-heap of polls by the time of their next search
+type lagQueue []*lagPoll
+
+func (q lagQueue) Len() int           { return len(q) }
+func (q lagQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q lagQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *lagQueue) Push(x any)        { *q = append(*q, x.(*lagPoll)) }
+func (q *lagQueue) Pop() any {
+	old := *q
+	p := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return p
+}
+
+// Sampled entity, searched every lagInterval until it shows up
+type lagPoll struct {
+	entry   manifestEntry
+	created time.Time
+	load    string    // Write load when it was created
+	next    time.Time // Time of the next search
+}
+
+func newLagTracker() *lagTracker {
+	t := &lagTracker{stats: make(map[string]*latencyStats), notMeasured: make(map[string]int), reasons: make(map[string]int), done: make(chan struct{})}
+	t.ready = sync.NewCond(&t.queueMu)
+	return t
+}
+
+// Keep writeRate at the number of entities created during the last second,
+// updated every 100ms; during the first second it is extrapolated
+func (t *lagTracker) measureWriteRate() {
+	const step = 100 * time.Millisecond
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	var window [10]int64 // Values of writes at the last ten ticks
+	for tick := 1; ; tick++ {
+		select {
+		case <-ticker.C:
+			writes := atomic.LoadInt64(&t.writes)
+			i := tick % len(window)
+			span := time.Duration(min(tick, len(window))) * step
+			atomic.StoreInt64(&t.writeRate, (writes-window[i])*int64(time.Second)/int64(span))
+			window[i] = writes
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Write load bucket of a rate, by order of magnitude, e.g. "10-99 writes/s"
+func writeLoad(rate int64) string {
+	if rate < 10 {
+		return "0-9 writes/s"
+	}
+	low := int64(math.Pow(10, math.Floor(math.Log10(float64(rate)))))
+	return fmt.Sprintf("%d-%d writes/s", low, low*10-1)
+}
+
+// Count a created entity and, for the sampled share, queue it to be searched
+// by the workers until it is found. A sample is dropped and counted as not
+// measured when lagQueueSize polls are already waiting. A no-op on a nil
+// tracker.
+func (t *lagTracker) track(entry manifestEntry) {
+	if t == nil {
+		return
+	}
+	created := time.Now()
+	t.started.Do(func() {
+		t.start = created
+		go t.measureWriteRate()
+		for w := 0; w < lagWorkers; w++ {
+			go t.work()
+		}
+	})
+	atomic.AddInt64(&t.writes, 1)
+	atomic.StoreInt64(&t.lastWrite, created.UnixNano())
+	if rand.Float64() >= lagSample {
+		return
+	}
+
+	p := &lagPoll{entry: entry, created: created, load: writeLoad(atomic.LoadInt64(&t.writeRate)), next: created}
+	t.wg.Add(1)
+	if !t.enqueue(p, true) {
+		t.wg.Done()
+		t.unmeasured(p, "queue full")
+	}
+}
+
+// Queue a poll in the order of its next search. With limit set, the poll is
+// not queued when lagQueueSize polls are waiting; returns whether it was.
+// Polls searched again are queued without limit: their worker took them off
+// the queue, so it does not grow.
+func (t *lagTracker) enqueue(p *lagPoll, limit bool) bool {
+	t.queueMu.Lock()
+	defer t.queueMu.Unlock()
+	if limit && t.queue.Len() >= lagQueueSize {
+		return false
+	}
+	heap.Push(&t.queue, p)
+	t.ready.Signal()
+	return true
+}
+
+// Worker searching the queued entities once their next search is due, until
+// the tracker is closed. Like requests in flight, polls outlive the phase and
+// are only canceled by a second signal or an aborting circuit breaker; their
+// entities count as not measured.
+//
+// A search that starts more than lagInterval after it was due waited for a
+// worker, the rate or the breaker; the entity may have shown up during the
+// wait, so when such a search finds it, the sample is not measured either.
+func (t *lagTracker) work() {
+	for {
+		t.queueMu.Lock()
+		for t.queue.Len() == 0 && !t.closed {
+			t.ready.Wait()
+		}
+		if t.queue.Len() == 0 {
+			t.queueMu.Unlock()
+			return
+		}
+		p := heap.Pop(&t.queue).(*lagPoll)
+		t.queueMu.Unlock()
+
+		sleepContext(abortCtx, time.Until(p.next))
+		if abortCtx.Err() != nil {
+			t.skip(p, "run interrupted")
+			continue
+		}
+		found, sent, err := searchOnce(p.entry)
+		switch {
+		case err != nil:
+			t.skip(p, classifyError(err))
+		case found && sent.Sub(p.next) > lagInterval:
+			t.skip(p, "late search")
+		case found:
+			t.record(p, sent.Sub(p.created), nil)
+		case time.Since(p.created) >= lagTimeout:
+			t.record(p, 0, fmt.Errorf("not visible after %v", lagTimeout))
+		default:
+			p.next = time.Now().Add(lagInterval)
+			t.enqueue(p, false)
+		}
+	}
+}
+
+// File the lag of a poll, or why it gave up, under its type and write load
+func (t *lagTracker) record(p *lagPoll, elapsed time.Duration, err error) {
+	defer t.wg.Done()
+	for _, s := range []*latencyStats{t.statsFor(p.entry.Type), t.statsFor(p.entry.Type + " at " + p.load)} {
+		if err != nil {
+			s.fail(err.Error())
+		} else {
+			s.record(elapsed)
+		}
+	}
+}
+
+// Count a queued poll that ended without a result as not measured
+func (t *lagTracker) skip(p *lagPoll, reason string) {
+	defer t.wg.Done()
+	t.unmeasured(p, reason)
+}
+
+// Count a sample as not measured under its type and write load and reason
+func (t *lagTracker) unmeasured(p *lagPoll, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notMeasured[p.entry.Type]++
+	t.notMeasured[p.entry.Type+" at "+p.load]++
+	t.reasons[reason]++
+}
+
+func (t *lagTracker) statsFor(key string) *latencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stats[key]
+	if !ok {
+		s = newLatencyStats(key)
+		t.stats[key] = s
+	}
+	return s
+}
+
+// Search for the entity once, keeping to the request rate and holding while
+// the circuit breaker is open, and return whether it was found and when the
+// search was sent. Failed searches are logged and count as not found; the
+// error is only set when the search was not sent because the run was
+// interrupted or the circuit breaker aborted it.
+func searchOnce(entry manifestEntry) (bool, time.Time, error) {
+	if err := breaker.wait(abortCtx); err != nil {
+		return false, time.Time{}, err
+	}
+	if err := limiter.wait(abortCtx); err != nil {
+		return false, time.Time{}, err
+	}
+	sent := time.Now()
+	reqCtx, cancel := requestContext()
+	found, err := searchVisible(reqCtx, entry)
+	cancel()
+	breaker.record(abortCtx, err != nil && isRetryable(classifyError(err)))
+	if err != nil && abortCtx.Err() == nil {
+		slog.Warn("lag search failed", "entity_type", entry.Type, "entity", entry.Name, "entity_id", entry.ID, "error", err)
+	}
+	return found, sent, nil
+}
+
+// Report whether the list or search endpoint of the entity's type returns it
+func searchVisible(ctx context.Context, entry manifestEntry) (bool, error) {
+	var resp *zitadel.SearchResponse
+	var err error
+	switch entry.Type {
+	case entityOrg:
+		resp, err = api.ListOrganizations(ctx, zitadel.SearchByName(entry.Name))
+	case entityProject:
+		resp, err = api.SearchProjects(ctx, entry.OrgID, zitadel.SearchByName(entry.Name))
+	case entityApp:
+		resp, err = api.SearchApps(ctx, entry.OrgID, entry.ProjectID, zitadel.SearchByName(entry.Name))
+	case entityUser:
+		users, err := api.ListUsers(ctx, "", zitadel.ListUsersRequest{
+			Query:   zitadel.ListQuery{Limit: 1},
+			Queries: []zitadel.UserQuery{{UserNameQuery: &zitadel.UserNameQuery{UserName: entry.Name, Method: zitadel.TextQueryEquals}}},
+		})
+		return err == nil && len(users.Result) > 0, err
+	default:
+		return false, fmt.Errorf("unknown entity type %q", entry.Type)
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = exactMatch(resp, entry.Type, entry.Name)
+	return err == nil, nil
+}
+
+// Wait for the pending polls, then print and log the lag percentiles per
+// entity type and write load and append them to lagResultsFile
+func (t *lagTracker) report() {
+	if t == nil {
+		return
+	}
+	t.wg.Wait()
+	close(t.done)
+	t.queueMu.Lock()
+	t.closed = true
+	t.ready.Broadcast()
+	t.queueMu.Unlock()
+
+	t.mu.Lock()
+	keys := make([]string, 0, len(t.stats))
+	for key := range t.stats {
+		keys = append(keys, key)
+	}
+	for key := range t.notMeasured {
+		if _, ok := t.stats[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	t.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	var avgRate float64
+	if span := time.Unix(0, atomic.LoadInt64(&t.lastWrite)).Sub(t.start); span > 0 {
+		avgRate = float64(atomic.LoadInt64(&t.writes)) / span.Seconds()
+	}
+
+	fmt.Printf("\nProjection lag (poll interval %v, average write rate %.1f/s):\n", lagInterval, avgRate)
+	log.Printf("Projection lag (poll interval %v, average write rate %.1f/s):", lagInterval, avgRate)
+	for _, key := range keys {
+		sum := t.statsFor(key).summary()
+		line := fmt.Sprintf("Lag %s: %d visible, %d not visible after %v, %d not measured; p50 %v, p95 %v, p99 %v, max %v",
+			key, sum.count, sum.failed, lagTimeout, t.notMeasured[key], sum.p50, sum.p95, sum.p99, sum.max)
+		fmt.Println(line)
+		log.Println(line)
+	}
+	if len(t.reasons) > 0 {
+		reasons := make([]string, 0, len(t.reasons))
+		for reason := range t.reasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool { return t.reasons[reasons[i]] > t.reasons[reasons[j]] })
+		for _, reason := range reasons {
+			line := fmt.Sprintf("Lag samples not measured: %s (x%d)", reason, t.reasons[reason])
+			fmt.Println(line)
+			log.Println(line)
+		}
+	}
+
+	if err := t.appendResults(keys, avgRate); err != nil {
+		log.Printf("Error writing lag results: %v", err)
+	}
+}
+
+// Append the percentiles of this run to the results CSV so that runs with
+// different write loads can be compared
+func (t *lagTracker) appendResults(keys []string, avgRate float64) error {
+	_, statErr := os.Stat(lagResultsFile)
+	file, err := os.OpenFile(lagResultsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if os.IsNotExist(statErr) {
+		w.Write([]string{"timestamp", "run_id", "avg_write_rate", "entities", "visible", "not_visible", "p50_ms", "p95_ms", "p99_ms", "max_ms"})
+	}
+	now := time.Now().Format(time.RFC3339)
+	for _, key := range keys {
+		sum := t.statsFor(key).summary()
+		w.Write([]string{
+			now, runID, fmt.Sprintf("%.1f", avgRate), key,
+			strconv.Itoa(sum.count), strconv.Itoa(sum.failed),
+			fmt.Sprintf("%.3f", sum.p50.Seconds()*1000),
+			fmt.Sprintf("%.3f", sum.p95.Seconds()*1000),
+			fmt.Sprintf("%.3f", sum.p99.Seconds()*1000),
+			fmt.Sprintf("%.3f", sum.max.Seconds()*1000),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
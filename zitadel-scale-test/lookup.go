@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Lookups of existing entities, used to resolve the 409 Conflict returned when
+// an entity of the same name exists already so that repeated runs with the
+// same -run-id reuse what an earlier run created.
+
+// Return the ID of the search result named exactly name; the query matches
+// exactly, but do not rely on the server for that
+func exactMatch(resp *zitadel.SearchResponse, kind, name string) (string, error) {
+	for _, r := range resp.Result {
+		if r.Name == name {
+			return r.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no %s named %s found", kind, name)
+}
+
+// Function to fetch organization ID by its name
+func getOrganizationIDByName(ctx context.Context, orgName string) (string, error) {
+	resp, err := api.ListOrganizations(ctx, zitadel.SearchByName(orgName))
+	if err != nil {
+		return "", err
+	}
+	return exactMatch(resp, "organization", orgName)
+}
+
+// Function to fetch project ID by its name within an organization
+func getProjectIDByName(ctx context.Context, orgID, projName string) (string, error) {
+	resp, err := api.SearchProjects(ctx, orgID, zitadel.SearchByName(projName))
+	if err != nil {
+		return "", err
+	}
+	return exactMatch(resp, "project", projName)
+}
+
+// Function to fetch application ID by its name within a project
+func getApplicationIDByName(ctx context.Context, orgID, projID, appName string) (string, error) {
+	resp, err := api.SearchApps(ctx, orgID, projID, zitadel.SearchByName(appName))
+	if err != nil {
+		return "", err
+	}
+	return exactMatch(resp, "application", appName)
+}
+
+// Function to check that an existing user belongs to the given organization
+func checkUserInOrganization(ctx context.Context, userId, orgId string) error {
+	resp, err := api.GetUserByID(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if resp.Details.ResourceOwner != orgId {
+		return fmt.Errorf("user %s belongs to organization %s, expected %s", userId, resp.Details.ResourceOwner, orgId)
+	}
+	return nil
+}
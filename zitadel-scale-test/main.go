@@ -1,423 +1,423 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
-)
-
-// Structs to represent organization, project, application, and user payload
-type Organization struct {
-	Name string `json:"name"`
-}
 
-type Project struct {
-	ID   string `json:"id"` // Assuming the response includes an ID field for the project
-	Name string `json:"name"`
-}
+	"golang.org/x/crypto/bcrypt"
+	"zitadel-scale-test/zitadel"
+)
 
-type Application struct {
-	ID   string `json:"id"` // Assuming the response includes an ID field for the application
-	Name string `json:"name"`
-}
+var issuer = "http://localhost:8080"
 
-type User struct {
-	UserId       string `json:"userId"`
-	Username     string `json:"username"`
-	Organization struct {
-		OrgId string `json:"orgId"`
-	} `json:"organization"`
-	Profile struct {
-		GivenName  string `json:"givenName"`
-		FamilyName string `json:"familyName"`
-	} `json:"profile"`
-	Email struct {
-		Email      string `json:"email"`
-		IsVerified bool   `json:"isVerified"`
-	} `json:"email"`
-	Phone struct {
-		Phone      string `json:"phone"`
-		IsVerified bool   `json:"isVerified"`
-	} `json:"phone"`
-	Password struct {
-		Password       string `json:"password"`
-		ChangeRequired bool   `json:"changeRequired"`
-	} `json:"password"`
-}
+// Client of the Zitadel API over the transport chosen with -transport; main
+// creates it with the authenticating token source
+var api zitadel.API
 
-var apiToken = "hIpIAjr-Hy6ickpfhq5CB-awmwQARH9p68nvoJuW0sDfpKBRZ0_pulFKSru90jjS--Y6ezM" // Replace with your actual API token
-var baseURL = "http://localhost:8080/management/v1"
-var baseURLv2 = "http://localhost:8080/v2" // Replace with actual Zitadel API URL
-
-// Create a single HTTP client to be reused
-var client = &http.Client{}
+// Client of the requests bypassing api, token requests and health probes;
+// main sets its timeout to -request-timeout
+var plainClient = &http.Client{Timeout: requestTimeout}
 
 // Function to create organization
-func createOrganization(orgName string) (string, error) {
-	url := fmt.Sprintf("%s/orgs", baseURL) // Make sure the URL is correct
-	method := "POST"
-
-	// Create the payload with the organization name
-	payload := map[string]string{"name": orgName}
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling JSON: %v", err)
-	}
-
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("creating HTTP request for organization: %v", err)
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", "Bearer "+apiToken)
-
-	// Retry logic in case of transient failures (e.g., network issues or 5xx server errors)
-	maxRetries := 3
-	var resp *http.Response
-	for retries := 0; retries < maxRetries; retries++ {
-		resp, err = client.Do(req)
-		if err != nil {
-			if retries < maxRetries-1 {
-				log.Printf("Request failed, retrying (%d/%d)...: %v", retries+1, maxRetries, err)
-				time.Sleep(2 * time.Second) // Wait before retrying
-				continue
-			}
-			return "", fmt.Errorf("sending request to create organization after %d retries: %v", maxRetries, err)
-		}
-		break
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("reading response body: %v", err)
-	}
-
-	// Log response details for debugging purposes
-	log.Printf("Response status: %s", resp.Status)
-	log.Printf("Response body: %s", string(body))
+func createOrganization(ctx context.Context, orgName string) (string, error) {
+	// Transient failures are retried by the caller with retryWithBackoff
+	resp, err := api.AddOrganization(ctx, zitadel.AddOrganizationRequest{Name: orgName})
 
 	// Handle the "409 Conflict" (organization already exists) case
-	if resp.StatusCode == http.StatusConflict {
-		log.Printf("Organization %s already exists, proceeding with ID retrieval", orgName)
+	if zitadel.IsAlreadyExists(err) {
+		slog.InfoContext(ctx, "organization already exists, fetching its ID")
 
 		// Fetch the organization ID by name since it already exists
-		orgID, err := getOrganizationIDByName(orgName)
+		orgID, err := getOrganizationIDByName(ctx, orgName)
 		if err != nil {
-			return "", fmt.Errorf("organization %s exists but failed to fetch ID: %v", orgName, err)
+			return "", fmt.Errorf("organization %s exists but failed to fetch ID: %w", orgName, err)
 		}
 
-		log.Printf("Fetched existing organization ID: %s", orgID)
+		slog.InfoContext(ctx, "reusing existing organization", "entity_id", orgID)
 		return orgID, nil
 	}
-
-	// Check for success (201 Created or 200 OK)
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to create organization %s, status code: %d, response: %s", orgName, resp.StatusCode, string(body))
-	}
-
-	// Parse the response for organization ID
-	var orgResponse struct {
-		ID string `json:"id"`
-	}
-	if err := json.Unmarshal(body, &orgResponse); err != nil {
-		return "", fmt.Errorf("decoding organization response: %v", err)
+	if err != nil {
+		return "", fmt.Errorf("failed to create organization %s: %w", orgName, err)
 	}
 
 	// Check if the organization ID is returned, otherwise log an error
-	if orgResponse.ID == "" {
-		return "", fmt.Errorf("organization created but no ID returned in response: %s", string(body))
+	if resp.ID == "" {
+		return "", fmt.Errorf("organization %s created but no ID returned in response", orgName)
 	}
 
-	log.Printf("Organization created successfully: %s (ID: %s)", orgName, orgResponse.ID)
+	slog.InfoContext(ctx, "organization created", "entity_id", resp.ID)
 
-	return orgResponse.ID, nil
+	return resp.ID, nil
 }
 
-// Function to fetch organization ID by its name (assuming an API exists for this)
-func getOrganizationIDByName(orgName string) (string, error) {
-	url := fmt.Sprintf("%s/orgs/me", baseURL) // Adjust the URL as per Zitadel API to fetch org details
-	method := "GET"
-
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return "", fmt.Errorf("creating HTTP request for fetching org ID: %v", err)
+// Function to create project
+func createProject(ctx context.Context, orgID, projName string) (string, error) {
+	resp, err := api.AddProject(ctx, orgID, zitadel.AddProjectRequest{
+		Name:                   projName,
+		ProjectRoleAssertion:   true,
+		ProjectRoleCheck:       true,
+		HasProjectCheck:        true,
+		PrivateLabelingSetting: zitadel.PrivateLabelingDefault,
+	})
+
+	// The project exists already, e.g. when a run is repeated with the same -run-id
+	if zitadel.IsAlreadyExists(err) {
+		projID, err := getProjectIDByName(ctx, orgID, projName)
+		if err != nil {
+			return "", fmt.Errorf("project %s exists but failed to fetch ID: %w", projName, err)
+		}
+		slog.InfoContext(ctx, "reusing existing project", "entity_id", projID, "org_id", orgID)
+		return projID, nil
 	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", "Bearer "+apiToken)
-
-	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("sending request to fetch organization: %v", err)
+		return "", fmt.Errorf("failed to create project %s in organization %s: %w", projName, orgID, err)
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("reading response body: %v", err)
+	if resp.ID == "" {
+		return "", fmt.Errorf("project %s created but no ID returned in response", projName)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch organization, status code: %d, response: %s", resp.StatusCode, string(body))
+	slog.InfoContext(ctx, "project created", "entity_id", resp.ID, "org_id", orgID)
+	if dash == nil {
+		fmt.Printf("Successfully created project: %s in organization: %s\n", projName, orgID)
 	}
+	return resp.ID, nil
+}
 
-	// Parse the response for organization ID
-	var orgResponse struct {
-		Org struct {
-			ID   string `json:"id"`
-			Name string `json:"name"`
-		} `json:"org"`
+// Function to create application
+func createApplication(ctx context.Context, orgID, projID, appName string) (string, error) {
+	resp, err := api.AddAPIApp(ctx, orgID, projID, zitadel.AddAPIAppRequest{
+		Name:           appName,
+		AuthMethodType: zitadel.APIAuthMethodBasic,
+	})
+
+	// The application exists already, e.g. when a run is repeated with the same -run-id
+	if zitadel.IsAlreadyExists(err) {
+		appID, err := getApplicationIDByName(ctx, orgID, projID, appName)
+		if err != nil {
+			return "", fmt.Errorf("application %s exists but failed to fetch ID: %w", appName, err)
+		}
+		slog.InfoContext(ctx, "reusing existing application", "entity_id", appID, "project_id", projID)
+		return appID, nil
 	}
-	if err := json.Unmarshal(body, &orgResponse); err != nil {
-		return "", fmt.Errorf("decoding organization response: %v", err)
+	if err != nil {
+		return "", fmt.Errorf("failed to create application %s in project %s: %w", appName, projID, err)
 	}
 
-	// Verify if the organization name matches
-	if orgResponse.Org.Name != orgName {
-		return "", fmt.Errorf("organization name mismatch, expected: %s, got: %s", orgName, orgResponse.Org.Name)
-	}
+	// Log application details; the secret only at debug level
+	slog.InfoContext(ctx, "application created", "entity_id", resp.AppID, "project_id", projID, "client_id", resp.ClientID)
+	slog.DebugContext(ctx, "application credentials", "client_id", resp.ClientID, "client_secret", resp.ClientSecret)
 
-	return orgResponse.Org.ID, nil
+	return resp.AppID, nil
 }
 
-// Function to create project
-func createProject(orgID, projName string) (string, error) {
-	url := fmt.Sprintf("%s/projects", baseURL) // Correct endpoint for project creation
-	method := "POST"
-
-	// Create the payload for project creation
-	payload := bytes.NewBufferString(fmt.Sprintf(`{
-		"name": "%s",
-		"projectRoleAssertion": true,
-		"projectRoleCheck": true,
-		"hasProjectCheck": true,
-		"privateLabelingSetting": "PRIVATE_LABELING_SETTING_UNSPECIFIED"
-	}`, projName))
-
-	req, err := http.NewRequest(method, url, payload)
-	if err != nil {
-		return "", fmt.Errorf("creating HTTP request for project: %v", err)
-	}
+// Function to create a human user with a generated profile
+func createUser(ctx context.Context, userId, username string, id identity, orgId string) error {
+	_, err := api.AddHumanUser(ctx, id.addRequest(userId, username, orgId))
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", "Bearer "+apiToken)
-	req.Header.Add("x-zitadel-orgid", orgID) // Specify the organization ID
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("sending request to create project: %v", err)
+	// The user exists already; it counts as created when it belongs to the
+	// same organization, e.g. when a run is repeated with the same -run-id
+	if zitadel.IsAlreadyExists(err) {
+		if err := checkUserInOrganization(ctx, userId, orgId); err != nil {
+			return fmt.Errorf("user %s exists but cannot be reused: %w", username, err)
+		}
+		slog.InfoContext(ctx, "reusing existing user", "entity_id", userId, "org_id", orgId)
+		return nil
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("reading project creation response body: %v", err)
+		return fmt.Errorf("failed to create user %s in organization %s: %w", username, orgId, err)
 	}
 
-	// Log response details for debugging purposes
-	log.Printf("Response status: %s", resp.Status)
-	log.Printf("Response body: %s", string(body))
-
-	// Treat both 200 OK and 201 Created as valid success cases
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to create project %s in organization %s, status code: %d, response: %s", projName, orgID, resp.StatusCode, string(body))
+	slog.InfoContext(ctx, "user created", "entity_id", userId, "org_id", orgId)
+	if dash == nil {
+		fmt.Printf("Successfully created user: %s\n", username)
 	}
+	return nil
+}
 
-	// Assuming the response body includes the project ID
-	var projResponse struct {
-		ID string `json:"id"` // Adjust field according to actual response structure
-	}
-	if err := json.Unmarshal(body, &projResponse); err != nil {
-		return "", fmt.Errorf("decoding project response: %v", err)
-	}
+func main() {
+	var numOrgs, numProjects, numApplications, numUsers int
+	var mode, manifestPath, pageSizes, scenarioPath string
+	var keyFile, tokenFile, transport string
+	var refreshMargin time.Duration
+	var search, verify bool
+	var listenAddr, coordinatorAddr string
+	var numAgents int
+	var rate, zipfS float64
+	var usersKind string
 
-	if projResponse.ID == "" {
-		return "", fmt.Errorf("project created but no ID returned in response: %s", string(body))
+	// The analyzer reads application.log and must not append to it
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		runAnalyze(os.Args[2:])
+		return
 	}
 
-	fmt.Printf("Successfully created project: %s in organization: %s\n", projName, orgID)
-	return projResponse.ID, nil
-}
+	// Initialize logging
+	initLogging("application.log")
+	log.Println("Application started") // Test log entry
 
-// Function to create application
-func createApplication(orgID, projID, appName string) (string, error) {
-	// Construct the URL using the project ID
-	url := fmt.Sprintf("%s/projects/%s/apps/api", baseURL, projID)
-	method := "POST"
-
-	// Create the payload for application creation
-	payload := bytes.NewBufferString(fmt.Sprintf(`{
-		"name": "%s",
-		"authMethodType": "API_AUTH_METHOD_TYPE_BASIC"
-	}`, appName))
-
-	req, err := http.NewRequest(method, url, payload)
-	if err != nil {
-		return "", fmt.Errorf("creating HTTP request for application: %v", err)
+	// Subcommands take their own flags
+	if len(os.Args) > 1 && os.Args[1] == "serve-mock" {
+		runServeMock(os.Args[2:])
+		return
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", "Bearer "+apiToken)
-	req.Header.Add("x-zitadel-orgid", orgID) // Specify the organization ID
+	// Accept the mode of operation as a command-line argument
+	flag.StringVar(&mode, "mode", "sequential", "Execution mode: 'sequential', 'concurrent', 'search', 'verify', 'scenario', 'coordinator', 'agent' or 'import'")
+	flag.StringVar(&scenarioPath, "scenario", "scenario.yaml", "Scenario file executed in scenario mode")
+	flag.StringVar(&manifestPath, "manifest", "manifest.jsonl", "File recording every created entity, read back by the search benchmark")
+	flag.StringVar(&runID, "run-id", runID, "ID of the run included in every entity name; reuse it to reproduce the names of an earlier run (default: start time)")
+	flag.StringVar(&nameTemplate, "name-template", nameTemplate, "Template of entity names with the placeholders {run}, {kind} and {path}")
+
+	// Authentication options
+	flag.StringVar(&keyFile, "key-file", "", "Service-account JSON key used to obtain access tokens with the JWT-profile grant")
+	flag.StringVar(&tokenFile, "token-file", "", "File containing a personal access token (default: ZITADEL_TOKEN environment variable)")
+	flag.StringVar(&issuer, "issuer", issuer, "Zitadel issuer URL used for the JWT-profile grant")
+	flag.StringVar(&transport, "transport", "rest", "Transport of the API calls: 'rest' (REST gateway) or 'grpc' (native gRPC API)")
+
+	// HTTP transport options of the REST client
+	flag.IntVar(&maxIdleConns, "max-idle-conns", maxIdleConns, "Maximum idle HTTP connections kept across all hosts (0: no limit)")
+	flag.IntVar(&maxIdleConnsPerHost, "max-idle-conns-per-host", maxIdleConnsPerHost, "Maximum idle HTTP connections kept per host")
+	flag.DurationVar(&idleConnTimeout, "idle-conn-timeout", idleConnTimeout, "Time an idle HTTP connection is kept open")
+	flag.BoolVar(&enableHTTP2, "http2", enableHTTP2, "Negotiate HTTP/2 with TLS servers")
+	flag.BoolVar(&keepAlive, "keep-alive", keepAlive, "Reuse HTTP connections between requests")
+	flag.DurationVar(&refreshMargin, "token-refresh-margin", 5*time.Minute, "Refresh access tokens this long before they expire")
+
+	// Load options
+	flag.IntVar(&workerPoolSize, "workers", workerPoolSize, "Concurrent workers per entity type in concurrent mode")
+	flag.Func("type-workers", "Comma-separated workers of single entity types overriding -workers, e.g. 'org=10,user=200' (types: org, project, app, user)", setTypeWorkers)
+	flag.Float64Var(&rate, "rate", 0, "Maximum API calls per second (0: no limit); the coordinator splits it across its agents")
+
+	// Generated data options
+	flag.Int64Var(&identitySeed, "seed", identitySeed, "Seed of the generated user profiles; the same seed and -run-id reproduce the same users")
+	flag.StringVar(&usersKind, "users-dist", usersFixed, "Distribution of the users per organization around the entered number: 'fixed', 'uniform' (0 to twice the number) or 'zipf' (few large organizations, long tail)")
+	flag.Float64Var(&zipfS, "users-zipf-s", 1.1, "Exponent of the Zipf distribution of users per organization")
+
+	// Import mode options
+	flag.IntVar(&importBatch, "import-batch", importBatch, "Users per bulk import request; organizations are not split across requests")
+	flag.IntVar(&importConcurrency, "import-concurrency", importConcurrency, "Concurrent bulk import requests")
+	flag.DurationVar(&importRequestTimeout, "import-request-timeout", importRequestTimeout, "Time the server may spend on one bulk import request")
+	flag.DurationVar(&importTimeout, "import-timeout", 0, "Deadline of each path of the import benchmark; remaining organizations are skipped (0: no limit)")
+	flag.IntVar(&importHashCost, "import-hash-cost", importHashCost, "bcrypt cost of the password hashes sent with the bulk import")
+
+	// Verify phase options
+	flag.BoolVar(&verify, "verify", false, "Read back every created entity after the run and report missing, duplicated or mismatched ones")
+	flag.IntVar(&verifyConcurrency, "verify-concurrency", verifyConcurrency, "Number of concurrent read-backs of the verify phase")
+
+	// Projection lag options
+	flag.Float64Var(&lagSample, "lag-sample", 0, "Share of created entities (0-1) polled in list and search endpoints until they show up, to measure the projection lag (0 disables it)")
+	flag.DurationVar(&lagInterval, "lag-interval", lagInterval, "Delay between two searches for an entity whose lag is measured")
+	flag.DurationVar(&lagTimeout, "lag-timeout", lagTimeout, "Time after creation after which an entity counts as not visible")
+	flag.IntVar(&lagWorkers, "lag-workers", lagWorkers, "Concurrent searches of the projection lag measurement; they go through -rate and the circuit breaker like every API call")
+	flag.IntVar(&lagQueueSize, "lag-queue", lagQueueSize, "Sampled entities waiting for their next search; further samples are dropped and counted as not measured")
+	flag.StringVar(&lagResultsFile, "lag-results", lagResultsFile, "CSV file the lag percentiles are appended to")
+
+	// Distributed mode options
+	flag.StringVar(&listenAddr, "listen", ":7070", "Address the coordinator accepts agents on")
+	flag.IntVar(&numAgents, "agents", 1, "Number of agents the coordinator waits for before starting")
+	flag.StringVar(&coordinatorAddr, "coordinator", "localhost:7070", "Address of the coordinator an agent connects to")
+
+	// Search benchmark options
+	flag.BoolVar(&search, "search", false, "Run the user search benchmark after creating the entities")
+	flag.StringVar(&pageSizes, "search-page-sizes", "10,50,100", "Comma-separated page sizes used to page through search results")
+	flag.IntVar(&searchMaxPages, "search-max-pages", searchMaxPages, "Maximum number of pages fetched per search query")
+	flag.IntVar(&searchRepeat, "search-repeat", searchRepeat, "Number of times every search query is executed")
+	flag.IntVar(&searchConcurrency, "search-concurrency", searchConcurrency, "Number of concurrent search queries")
+	flag.StringVar(&searchResultsFile, "search-results", searchResultsFile, "CSV file the search percentiles are appended to")
+	flag.IntVar(&retry.maxAttempts, "max-attempts", retry.maxAttempts, "Maximum attempts per API call, including the first one")
+	flag.DurationVar(&retry.baseDelay, "retry-base", retry.baseDelay, "Backoff ceiling of the first retry, doubled on every further retry")
+	flag.DurationVar(&retry.maxDelay, "retry-max-delay", retry.maxDelay, "Upper bound of the backoff between two attempts")
+	flag.DurationVar(&retry.maxElapsed, "retry-budget", retry.maxElapsed, "Total time per API call after which no further attempt is started")
+
+	// Circuit breaker options
+	var breakerAction string
+	var breakerWindow, breakerConsecutive int
+	var breakerErrorRate float64
+	var breakerProbeInterval time.Duration
+	flag.StringVar(&breakerAction, "breaker", breakerOff, "Action when the error rate trips the circuit breaker: 'off', 'pause' (wait for a health probe to succeed) or 'abort' (stop with a partial report)")
+	flag.IntVar(&breakerWindow, "breaker-window", 50, "Number of recent API calls the error rate is computed over")
+	flag.Float64Var(&breakerErrorRate, "breaker-error-rate", 0.5, "Error rate over the window that opens the circuit breaker")
+	flag.IntVar(&breakerConsecutive, "breaker-consecutive", 20, "Consecutive failed API calls that open the circuit breaker (0 disables)")
+	flag.DurationVar(&breakerProbeInterval, "breaker-probe-interval", 5*time.Second, "Delay between health probes while the circuit breaker is open")
+
+	// Deadlines
+	flag.DurationVar(&requestTimeout, "request-timeout", requestTimeout, "Timeout of a single API request")
+	flag.DurationVar(&createTimeout, "create-timeout", 0, "Deadline of the creation phase; remaining entities are skipped (0: no limit)")
+	flag.DurationVar(&searchTimeout, "search-timeout", 0, "Deadline of the search benchmark; remaining queries are skipped (0: no limit)")
+	flag.DurationVar(&verifyTimeout, "verify-timeout", 0, "Deadline of the verify phase; remaining entities are not checked (0: no limit)")
+
+	// Logging options
+	flag.TextVar(logLevel, "log-level", logLevel, "Lowest level written to application.log: 'debug' (every response, with the bodies of errors), 'info', 'warn' or 'error'")
+	flag.StringVar(&logFormat, "log-format", logFormat, "Format of application.log: 'json' (one object per line, read by the analyze command) or 'text' (key=value pairs)")
+	flag.Float64Var(&logSample, "log-sample", logSample, "Share of entities (0-1) whose info and debug lines are written; warnings and errors are always written")
+	flag.IntVar(&logBodyLimit, "log-body-limit", logBodyLimit, "Bytes of a response body written to the log before it is cut off (0: no limit)")
+
+	// Console options
+	flag.StringVar(&dashboardMode, "dashboard", dashboardMode, "Live progress view of the concurrent creation: 'auto' (only when stdout is a terminal), 'on' or 'off'")
+	flag.DurationVar(&dashboardInterval, "dashboard-interval", dashboardInterval, "Delay between two redraws of the progress view")
+	flag.Parse()
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("sending request to create application: %v", err)
+	if logSample < 0 || logSample > 1 || logBodyLimit < 0 {
+		log.Fatal("-log-sample must be between 0 and 1, -log-body-limit must not be negative")
 	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("reading application creation response body: %v", err)
+	if err := configureLogging(); err != nil {
+		log.Fatal(err)
+	}
+	if dashboardMode != "auto" && dashboardMode != "on" && dashboardMode != "off" || dashboardInterval <= 0 {
+		log.Fatalf("Invalid -dashboard %q or -dashboard-interval %v. Please choose 'auto', 'on' or 'off' and a positive interval.", dashboardMode, dashboardInterval)
 	}
 
-	// Log response details for debugging purposes
-	log.Printf("Response status: %s", resp.Status)
-	log.Printf("Response body: %s", string(body))
-
-	// Treat both 200 OK and 201 Created as valid success cases
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to create application %s in project %s, status code: %d, response: %s", appName, projID, resp.StatusCode, string(body))
+	searchPageSizes = nil
+	for _, size := range strings.Split(pageSizes, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid search page size %q", size)
+		}
+		searchPageSizes = append(searchPageSizes, n)
 	}
 
-	// Assuming the response body includes the application details
-	var appResponse struct {
-		AppId        string `json:"appId"`
-		ClientId     string `json:"clientId"`
-		ClientSecret string `json:"clientSecret"`
+	if retry.maxAttempts < 1 || retry.baseDelay <= 0 || retry.maxDelay <= 0 {
+		log.Fatal("-max-attempts must be at least 1, -retry-base and -retry-max-delay must be positive")
 	}
-	if err := json.Unmarshal(body, &appResponse); err != nil {
-		return "", fmt.Errorf("decoding application response: %v", err)
+	if requestTimeout <= 0 {
+		log.Fatal("-request-timeout must be positive")
 	}
-
-	// Log application details
-	log.Printf("Successfully created application: %s in project: %s", appName, projID)
-	log.Printf("App ID: %s, Client ID: %s, Client Secret: %s", appResponse.AppId, appResponse.ClientId, appResponse.ClientSecret)
-
-	return appResponse.AppId, nil
-}
-
-// Function to create a human user
-func createUser(userId, username, givenName, familyName, email, phone, password, orgId string) error {
-	// Construct the URL for creating a new human user
-	url := fmt.Sprintf("%s/users/human", baseURLv2) // Replace with your actual domain
-	method := "POST"
-
-	// Create the payload for user creation
-	userPayload := User{
-		UserId:   userId,
-		Username: username,
-		Organization: struct {
-			OrgId string `json:"orgId"`
-		}{
-			OrgId: orgId,
-		},
-		Profile: struct {
-			GivenName  string `json:"givenName"`
-			FamilyName string `json:"familyName"`
-		}{
-			GivenName:  givenName,
-			FamilyName: familyName,
-		},
-		Email: struct {
-			Email      string `json:"email"`
-			IsVerified bool   `json:"isVerified"`
-		}{
-			Email:      email,
-			IsVerified: true, // Consider making this configurable
-		},
-		Phone: struct {
-			Phone      string `json:"phone"`
-			IsVerified bool   `json:"isVerified"`
-		}{
-			Phone:      phone,
-			IsVerified: true, // Consider making this configurable
-		},
-		Password: struct {
-			Password       string `json:"password"`
-			ChangeRequired bool   `json:"changeRequired"`
-		}{
-			Password:       password,
-			ChangeRequired: false,
-		},
+	plainClient.Timeout = requestTimeout
+	if err := validateNameTemplate(nameTemplate); err != nil {
+		log.Fatal(err)
 	}
-
-	// Marshal the user payload to JSON
-	payload, err := json.Marshal(userPayload)
-	if err != nil {
-		return fmt.Errorf("marshalling user payload: %v", err)
+	if workerPoolSize < 1 || rate < 0 || numAgents < 1 || verifyConcurrency < 1 {
+		log.Fatal("-workers, -agents and -verify-concurrency must be at least 1, -rate must not be negative")
 	}
-
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("creating HTTP request for user: %v", err)
+	if importBatch < 1 || importConcurrency < 1 || importHashCost < bcrypt.MinCost || importHashCost > bcrypt.MaxCost {
+		log.Fatalf("-import-batch and -import-concurrency must be at least 1, -import-hash-cost between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if mode == "import" && transport != "rest" {
+		log.Fatal("-mode import needs -transport rest: the admin import is not available over gRPC")
+	}
+	if mode == "scenario" && verify {
+		log.Fatal("-verify cannot check a scenario run: its update_user and delete_user steps change users after they are recorded in the manifest")
+	}
+	if lagSample < 0 || lagSample > 1 || lagInterval <= 0 || lagTimeout <= 0 || lagWorkers < 1 || lagQueueSize < 1 {
+		log.Fatal("-lag-sample must be between 0 and 1, -lag-interval and -lag-timeout must be positive, -lag-workers and -lag-queue at least 1")
+	}
+	if lagSample > 0 && mode != "coordinator" {
+		lag = newLagTracker()
+	}
+	limiter = newRateLimiter(rate)
+	if err := validateUserDistribution(userDistribution{Kind: usersKind, ZipfS: zipfS}); err != nil {
+		log.Fatal(err)
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", "Bearer "+apiToken)
-	req.Header.Add("x-zitadel-orgid", orgId) // Specify the organization ID
+	switch breakerAction {
+	case breakerOff:
+	case breakerPause, breakerAbort:
+		if breakerWindow < 1 || breakerErrorRate <= 0 || breakerErrorRate > 1 || breakerProbeInterval <= 0 {
+			log.Fatal("-breaker-window must be at least 1, -breaker-error-rate in (0, 1] and -breaker-probe-interval positive")
+		}
+		breaker = newCircuitBreaker(breakerAction, breakerWindow, breakerErrorRate, breakerConsecutive, breakerProbeInterval, probeZitadel)
+	default:
+		log.Fatalf("Invalid -breaker %q. Please choose 'off', 'pause' or 'abort'.", breakerAction)
+	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("sending request to create user: %v", err)
+	// The coordinator makes no API calls itself, its agents do
+	var err error
+	if mode != "coordinator" {
+		tokens, err := newTokenSource(keyFile, tokenFile, issuer, refreshMargin)
+		if err != nil {
+			log.Fatalf("Error setting up authentication: %v", err)
+		}
+		switch transport {
+		case "rest":
+			client := zitadel.NewClient(issuer, &http.Client{Transport: newHTTPTransport()})
+			client.Token = tokens.token
+			client.Logger = slog.Default()
+			api = client
+		case "grpc":
+			client, err := zitadel.NewGRPCClient(issuer)
+			if err != nil {
+				log.Fatalf("Error setting up the gRPC client: %v", err)
+			}
+			defer client.Close()
+			client.Token = tokens.token
+			client.Logger = slog.Default()
+			api = client
+		default:
+			log.Fatalf("Invalid -transport %q. Please choose 'rest' or 'grpc'.", transport)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		// Read response body for better error context
-		body, _ := ioutil.ReadAll(resp.Body) // Ignore error for simplicity
-		return fmt.Errorf("failed to create user %s in organization %s, status code: %d, response: %s", username, orgId, resp.StatusCode, string(body))
+	// Agents receive their workload, run ID and name template from the coordinator
+	if mode == "agent" {
+		runAgent(handleShutdown(), coordinatorAddr, transport)
+		lag.report()
+		return
 	}
 
-	fmt.Printf("Successfully created user: %s\n", username)
-	return nil
-}
+	// The search mode only reads back the manifest of a previous run
+	if mode == "search" {
+		runSearchBenchmark(handleShutdown(), manifestPath)
+		return
+	}
 
-func main() {
-	var numOrgs, numProjects, numApplications, numUsers int
-	var mode string
+	// The verify mode only reads back the manifest of a previous run
+	if mode == "verify" {
+		runVerify(handleShutdown(), manifestPath)
+		return
+	}
 
-	// Initialize logging
-	initLogging("application.log")
-	log.Println("Application started") // Test log entry
+	fmt.Printf("Run ID: %s\n", runID)
+	log.Printf("Run ID: %s, name template: %s, transport: %s", runID, nameTemplate, transport)
 
-	// Accept the mode of operation as a command-line argument
-	flag.StringVar(&mode, "mode", "sequential", "Execution mode: 'sequential' or 'concurrent'")
-	flag.Parse()
+	// Scenarios describe their own workload instead of prompting for counts
+	if mode == "scenario" {
+		sc, seed, err := prepareScenario(scenarioPath, manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			log.Fatal(err)
+		}
+		manifest, err = openManifest(manifestPath)
+		if err != nil {
+			log.Fatalf("Error creating manifest: %v", err)
+		}
+		ctx := handleShutdown()
+		runScenario(ctx, sc, seed)
+		lag.report()
+		if err := manifest.close(); err != nil {
+			log.Fatalf("Error writing manifest: %v", err)
+		}
+		return
+	}
 
 	// Take inputs from user
 	fmt.Print("Enter number of organizations: ")
-	_, err := fmt.Scan(&numOrgs)
+	_, err = fmt.Scan(&numOrgs)
 	if err != nil {
 		log.Fatal("Invalid input for number of organizations.")
 	}
 
-	fmt.Print("Enter number of projects per organization: ")
-	_, err = fmt.Scan(&numProjects)
-	if err != nil {
-		log.Fatal("Invalid input for number of projects.")
-	}
+	// The import dataset only consists of organizations and users
+	if mode != "import" {
+		fmt.Print("Enter number of projects per organization: ")
+		_, err = fmt.Scan(&numProjects)
+		if err != nil {
+			log.Fatal("Invalid input for number of projects.")
+		}
 
-	fmt.Print("Enter number of applications per project: ")
-	_, err = fmt.Scan(&numApplications)
-	if err != nil {
-		log.Fatal("Invalid input for number of applications.")
+		fmt.Print("Enter number of applications per project: ")
+		_, err = fmt.Scan(&numApplications)
+		if err != nil {
+			log.Fatal("Invalid input for number of applications.")
+		}
 	}
 
 	fmt.Print("Enter number of users per organization: ")
@@ -430,70 +430,146 @@ func main() {
 	if numOrgs < 0 || numProjects < 0 || numApplications < 0 || numUsers < 0 {
 		log.Fatal("All input values must be equal or greate than 0")
 	}
+	userDist = newUserDistribution(usersKind, numUsers, numOrgs, zipfS)
+
+	if mode != "concurrent" && mode != "sequential" && mode != "coordinator" && mode != "import" {
+		log.Fatal("Invalid mode. Please choose 'sequential', 'concurrent', 'search', 'verify', 'scenario', 'coordinator', 'agent' or 'import'.")
+	}
+
+	manifest, err = openManifest(manifestPath)
+	if err != nil {
+		log.Fatalf("Error creating manifest: %v", err)
+	}
+
+	// From here on SIGINT/SIGTERM stops the run gracefully
+	ctx := handleShutdown()
 
 	// Check the mode and run accordingly
 	switch mode {
 	case "concurrent":
-		runConcurrent(numOrgs, numProjects, numApplications, numUsers)
+		runConcurrent(ctx, 1, numOrgs, numProjects, numApplications)
 	case "sequential":
-		runSequential(numOrgs, numProjects, numApplications, numUsers)
-	default:
-		log.Fatal("Invalid mode. Please choose 'sequential' or 'concurrent'.")
+		runSequential(ctx, numOrgs, numProjects, numApplications)
+	case "import":
+		runImportBenchmark(ctx, numOrgs)
+	case "coordinator":
+		runCoordinator(ctx, listenAddr, numAgents, numOrgs, numProjects, numApplications, rate)
+	}
+
+	lag.report()
+
+	// The manifest records whatever was created, even after an interrupt
+	if err := manifest.close(); err != nil {
+		log.Fatalf("Error writing manifest: %v", err)
+	}
+
+	// The coordinator has no API client to run the verify phase or the
+	// search benchmark with
+	if verify && ctx.Err() == nil && mode != "coordinator" {
+		runVerify(ctx, manifestPath)
+	}
+	if search && ctx.Err() == nil && mode != "coordinator" {
+		runSearchBenchmark(ctx, manifestPath)
 	}
 }
 
-func runSequential(numOrgs, numProjects, numApplications, numUsers int) {
+// The number of users of every organization is drawn from userDist
+func runSequential(ctx context.Context, numOrgs, numProjects, numApplications int) {
 	fmt.Println("Running in sequential mode...")
 
+	ctx, cancel := phaseContext(ctx, createTimeout)
+	defer cancel()
+
+	startTotal := time.Now() // Start tracking total execution time
+
 	// Initialize counters for created entities
 	var orgCount, projectCount, appCount, userCount int
 
 	// Create organizations, projects, applications, and users (sequentially)
+orgs:
 	for i := 0; i < numOrgs; i++ {
-		orgName := fmt.Sprintf("org-%d", i+1)
+		orgPath := entityPath("", entityOrg, i+1)
+		orgName := entityName(entityOrg, orgPath)
 
 		// Create organization
-		orgId, err := createOrganization(orgName)
+		var orgId string
+		err := retryWithBackoff(ctx, "Create Organization", orgName, func(reqCtx context.Context) (err error) {
+			orgId, err = createOrganization(reqCtx, orgName)
+			return err
+		})
+		if stopping(ctx, err) {
+			break orgs
+		}
 		if err != nil {
 			log.Fatalf("Error creating organization %s: %v", orgName, err)
 		}
 		orgCount++
+		entry := manifestEntry{Type: entityOrg, ID: orgId, Name: orgName}
+		manifest.record(entry)
+		lag.track(entry)
 
 		// Create projects for each organization
 		for j := 0; j < numProjects; j++ {
-			projName := fmt.Sprintf("project-%d", j+1)
-			projId, err := createProject(orgId, projName)
+			projPath := entityPath(orgPath, entityProject, j+1)
+			projName := entityName(entityProject, projPath)
+			var projId string
+			err := retryWithBackoff(ctx, "Create Project", projName, func(reqCtx context.Context) (err error) {
+				projId, err = createProject(reqCtx, orgId, projName)
+				return err
+			})
+			if stopping(ctx, err) {
+				break orgs
+			}
 			if err != nil {
 				log.Fatalf("Error creating project %s: %v", projName, err)
 			}
 			projectCount++
+			entry := manifestEntry{Type: entityProject, ID: projId, Name: projName, OrgID: orgId}
+			manifest.record(entry)
+			lag.track(entry)
 
 			// Create applications for each project
 			for k := 0; k < numApplications; k++ {
-				appName := fmt.Sprintf("app-%d", k+1)
-				_, err := createApplication(orgId, projId, appName)
+				appName := entityName(entityApp, entityPath(projPath, entityApp, k+1))
+				var appId string
+				err := retryWithBackoff(ctx, "Create Application", appName, func(reqCtx context.Context) (err error) {
+					appId, err = createApplication(reqCtx, orgId, projId, appName)
+					return err
+				})
+				if stopping(ctx, err) {
+					break orgs
+				}
 				if err != nil {
 					log.Fatalf("Error creating application %s: %v", appName, err)
 				}
 				appCount++
+				entry := manifestEntry{Type: entityApp, ID: appId, Name: appName, OrgID: orgId, ProjectID: projId}
+				manifest.record(entry)
+				lag.track(entry)
 			}
 		}
 
 		// Create users for each organization
+		numUsers := userDist.count(i + 1)
 		for l := 0; l < numUsers; l++ {
-			userId := fmt.Sprintf("user-%d-org-%d", l+1, i+1)
-			userName := fmt.Sprintf("user-%d-org-%d", l+1, i+1)
-			givenName := fmt.Sprintf("GivenName%d", l+1)
-			familyName := fmt.Sprintf("FamilyName%d", l+1)
-			email := fmt.Sprintf("user%d-org%d@example.com", l+1, i+1)
-			phone := fmt.Sprintf("+123456789%d", l)
-			password := "Secret@1234"
-
-			err := createUser(userId, userName, givenName, familyName, email, phone, password, orgId)
+			userName := entityName(entityUser, entityPath(orgPath, entityUser, l+1))
+			userId := userName
+			id := newIdentity(userName)
+			email := id.Email
+
+			err := retryWithBackoff(ctx, "Create User", userName, func(reqCtx context.Context) error {
+				return createUser(reqCtx, userId, userName, id, orgId)
+			})
+			if stopping(ctx, err) {
+				break orgs
+			}
 			if err != nil {
 				log.Fatalf("Error creating user %s: %v", userName, err)
 			}
 			userCount++
+			entry := manifestEntry{Type: entityUser, ID: userId, Name: userName, OrgID: orgId, Email: email}
+			manifest.record(entry)
+			lag.track(entry)
 		}
 	}
 
@@ -502,41 +578,43 @@ func runSequential(numOrgs, numProjects, numApplications, numUsers int) {
 	fmt.Printf("Total Projects Created: %d\n", projectCount)
 	fmt.Printf("Total Applications Created: %d\n", appCount)
 	fmt.Printf("Total Users Created: %d\n", userCount)
+	reportOpStats(time.Since(startTotal))
+	breaker.report()
+	reportHTTPTrace()
+	reportStopped(ctx.Err(), "Creation phase", createTimeout)
 }
 
-// Constants for retry logic
-const maxRetries = 3
-const initialBackoff = time.Millisecond * 100
-
-// Worker pool size to limit concurrent goroutines
-const workerPoolSize = 100
+// Worker pool size to limit concurrent goroutines, per entity type
+var workerPoolSize = 100
 
-// Create exponential backoff with time tracking
-func retryWithBackoff(attempts int, fn func() error, actionName string) error {
-	backoff := initialBackoff
-	for i := 0; i < attempts; i++ {
-		start := time.Now() // Start the timer for the API call
-		err := fn()
-		duration := time.Since(start) // Calculate the duration of the API call
+// Numbers of entities created by a run
+type creationTotals struct {
+	Orgs     int `json:"orgs"`
+	Projects int `json:"projects"`
+	Apps     int `json:"apps"`
+	Users    int `json:"users"`
 
-		if err == nil {
-			log.Printf("%s succeeded. Time taken: %v\n", actionName, duration)
-			return nil
-		}
-		log.Printf("%s failed on attempt %d after %v. Retrying...\n", actionName, i+1, duration)
-		if i < attempts-1 {
-			time.Sleep(backoff)
-			backoff *= 2
-		}
-	}
-	return fmt.Errorf("after %d attempts, last error: %v", attempts, fn())
+	// Not attempted because their organization or project failed
+	SkippedProjects int `json:"skipped_projects,omitempty"`
+	SkippedApps     int `json:"skipped_apps,omitempty"`
+	SkippedUsers    int `json:"skipped_users,omitempty"`
 }
 
-// Worker pool to control concurrency
-func workerPool(workerLimit int, wg *sync.WaitGroup, jobs <-chan func()) {
+// Deadline of the creation phase (0: no limit)
+var createTimeout time.Duration
+
+// Worker pool to control concurrency. Once ctx is done, queued jobs no longer
+// wait for a free worker: they are started right away and return immediately,
+// since every API call checks the same context.
+func workerPool(ctx context.Context, workerLimit int, wg *sync.WaitGroup, jobs <-chan func()) {
 	sem := make(chan struct{}, workerLimit)
 	for job := range jobs {
-		sem <- struct{}{} // Acquire worker
+		select {
+		case sem <- struct{}{}: // Acquire worker
+		case <-ctx.Done():
+			job()
+			continue
+		}
 		wg.Add(1)
 		go func(job func()) {
 			defer wg.Done()
@@ -546,164 +624,127 @@ func workerPool(workerLimit int, wg *sync.WaitGroup, jobs <-chan func()) {
 	}
 }
 
-func generateUniqueName(base string, count int) string {
-	// Random number generation for uniqueness
-	randomSuffix := rand.Intn(10000)                          // Random number between 0 and 9999
-	return fmt.Sprintf("%s-%d-%d", base, count, randomSuffix) // Add random number for uniqueness
+// Task creating the organization at path with numProjects projects of
+// numApplications applications each, and numUsers users
+func orgTask(orgPath string, numProjects, numApplications, numUsers int) *task {
+	orgName := entityName(entityOrg, orgPath) // Unique org name
+	return &task{
+		op:   "Create Organization",
+		kind: entityOrg,
+		name: orgName,
+		create: func(ctx context.Context, _ manifestEntry) (manifestEntry, error) {
+			orgId, err := createOrganization(ctx, orgName)
+			return manifestEntry{Type: entityOrg, ID: orgId, Name: orgName}, err
+		},
+		children: func(_ manifestEntry, emit func(*task)) {
+			for j := 0; j < numProjects; j++ {
+				emit(projectTask(entityPath(orgPath, entityProject, j+1), numApplications))
+			}
+			for l := 0; l < numUsers; l++ {
+				emit(userTask(entityPath(orgPath, entityUser, l+1)))
+			}
+		},
+	}
 }
 
-func runConcurrent(numOrgs, numProjects, numApplications, numUsers int) {
-	fmt.Println("Running in concurrent mode...")
+// Task creating the project at path, with numApplications applications, in
+// the organization of its parent
+func projectTask(projPath string, numApplications int) *task {
+	projName := entityName(entityProject, projPath) // Unique project name
+	return &task{
+		op:   "Create Project",
+		kind: entityProject,
+		name: projName,
+		create: func(ctx context.Context, org manifestEntry) (manifestEntry, error) {
+			projId, err := createProject(ctx, org.ID, projName)
+			return manifestEntry{Type: entityProject, ID: projId, Name: projName, OrgID: org.ID}, err
+		},
+		children: func(_ manifestEntry, emit func(*task)) {
+			for k := 0; k < numApplications; k++ {
+				emit(appTask(entityPath(projPath, entityApp, k+1)))
+			}
+		},
+	}
+}
 
-	startTotal := time.Now() // Start tracking total execution time
+// Task creating the application at path in the project of its parent
+func appTask(appPath string) *task {
+	appName := entityName(entityApp, appPath) // Unique application name
+	return &task{
+		op:   "Create Application",
+		kind: entityApp,
+		name: appName,
+		create: func(ctx context.Context, project manifestEntry) (manifestEntry, error) {
+			appId, err := createApplication(ctx, project.OrgID, project.ID, appName)
+			return manifestEntry{Type: entityApp, ID: appId, Name: appName, OrgID: project.OrgID, ProjectID: project.ID}, err
+		},
+	}
+}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
+// Task creating the user at path in the organization of its parent
+func userTask(userPath string) *task {
+	userName := entityName(entityUser, userPath) // Unique user name
+	return &task{
+		op:   "Create User",
+		kind: entityUser,
+		name: userName,
+		create: func(ctx context.Context, org manifestEntry) (manifestEntry, error) {
+			userId := userName
+			id := newIdentity(userName)
+			err := createUser(ctx, userId, userName, id, org.ID)
+			return manifestEntry{Type: entityUser, ID: userId, Name: userName, OrgID: org.ID, Email: id.Email}, err
+		},
+	}
+}
 
-	// Initialize counters for created entities
-	var orgCount, projectCount, appCount, userCount int
+// Create numOrgs organizations, starting with the one at index firstOrg
+// (1-based), with their projects, applications and users; the number of
+// users of every organization is drawn from userDist
+func runConcurrent(ctx context.Context, firstOrg, numOrgs, numProjects, numApplications int) creationTotals {
+	fmt.Println("Running in concurrent mode...")
 
-	// Create channels for jobs
-	orgJobs := make(chan func(), numOrgs)
-	projectJobs := make(chan func(), numProjects*numOrgs)
-	appJobs := make(chan func(), numApplications*numProjects*numOrgs)
-	userJobs := make(chan func(), numUsers*numOrgs)
+	ctx, cancel := phaseContext(ctx, createTimeout)
+	defer cancel()
 
-	// Create a worker pool to handle org, project, app, and user creation concurrently
-	go workerPool(workerPoolSize, &wg, orgJobs)
-	go workerPool(workerPoolSize, &wg, projectJobs)
-	go workerPool(workerPoolSize, &wg, appJobs)
-	go workerPool(workerPoolSize, &wg, userJobs)
+	startTotal := time.Now() // Start tracking total execution time
 
-	// Create organizations concurrently
+	// The users of an organization are drawn again when it is submitted, so
+	// that no per-organization state is kept
+	var totalUsers int
 	for i := 0; i < numOrgs; i++ {
-		orgName := generateUniqueName("org", i+1) // Unique org name
-		wg.Add(1)                                 // Add to WaitGroup before submitting the job
-		orgJobs <- func() {
-			defer wg.Done() // Mark job as done when finished
-			err := retryWithBackoff(maxRetries, func() error {
-				orgId, err := createOrganization(orgName)
-				if err != nil {
-					return err
-				}
-
-				// Create projects, apps, and users for each organization
-				for j := 0; j < numProjects; j++ {
-					projName := generateUniqueName(orgName+"-project", j+1) // Unique project name
-					wg.Add(1)                                               // Add to WaitGroup before submitting the project job
-					projectJobs <- func() {
-						defer wg.Done() // Mark job as done when finished
-						err := retryWithBackoff(maxRetries, func() error {
-							projId, err := createProject(orgId, projName)
-							if err != nil {
-								return err
-							}
-
-							mu.Lock()
-							projectCount++
-							mu.Unlock()
-
-							// Create applications for the project
-							for k := 0; k < numApplications; k++ {
-								appName := generateUniqueName(projName+"-app", k+1) // Unique application name
-								wg.Add(1)                                           // Add to WaitGroup before submitting the application job
-								appJobs <- func() {
-									defer wg.Done() // Mark job as done when finished
-									err := retryWithBackoff(maxRetries, func() error {
-										_, err := createApplication(orgId, projId, appName)
-										if err != nil {
-											return err
-										}
-
-										mu.Lock()
-										appCount++
-										mu.Unlock()
-										return nil
-									}, fmt.Sprintf("Create Application: %s", appName))
-									if err != nil {
-										log.Printf("Error creating application %s: %v", appName, err)
-									}
-								}
-							}
-							return nil
-						}, fmt.Sprintf("Create Project: %s", projName))
-						if err != nil {
-							log.Printf("Error creating project %s: %v", projName, err)
-						}
-					}
-				}
-
-				// Create users for the organization
-				for l := 0; l < numUsers; l++ {
-					userName := generateUniqueName(orgName+"-user", l+1) // Unique user name
-					wg.Add(1)                                            // Add to WaitGroup before submitting the user job
-					userJobs <- func() {
-						defer wg.Done() // Mark job as done when finished
-						err := retryWithBackoff(maxRetries, func() error {
-							userId := fmt.Sprintf("user-%d-org-%s", l+1, orgId)
-							givenName := fmt.Sprintf("GivenName%d", l+1)
-							familyName := fmt.Sprintf("FamilyName%d", l+1)
-							email := fmt.Sprintf("user%d-org%s@example.com", l+1, orgId)
-							phone := fmt.Sprintf("+123456789%d", l)
-							password := "Secret@1234"
-
-							err := createUser(userId, userName, givenName, familyName, email, phone, password, orgId)
-							if err != nil {
-								return err
-							}
-
-							mu.Lock()
-							userCount++
-							mu.Unlock()
-							return nil
-						}, fmt.Sprintf("Create User: %s", userName))
-						if err != nil {
-							log.Printf("Error creating user %s: %v", userName, err)
-						}
-					}
-				}
-
-				mu.Lock()
-				orgCount++
-				mu.Unlock()
-				return nil
-			}, fmt.Sprintf("Create Organization: %s", orgName))
-			if err != nil {
-				log.Printf("Error creating organization %s: %v", orgName, err)
-			}
-		}
+		totalUsers += userDist.count(firstOrg + i)
 	}
 
-	// Close job channels only after all jobs have been submitted and processed
-	go func() {
-		wg.Wait() // Wait for all jobs to be added and processed
-		close(orgJobs)
-		close(projectJobs)
-		close(appJobs)
-		close(userJobs)
-	}()
+	// The live view replaces the per-entity output while the phase runs
+	startDashboard()
+	dash.plan("Create Organization", numOrgs)
+	dash.plan("Create Project", numOrgs*numProjects)
+	dash.plan("Create Application", numOrgs*numProjects*numApplications)
+	dash.plan("Create User", totalUsers)
 
-	// Wait for all goroutines to finish
-	wg.Wait()
+	// Every organization is the root of a subtree of projects with their
+	// applications, and of users; a task is only queued once its parent was created
+	sched := newScheduler(ctx)
+	for i := 0; i < numOrgs; i++ {
+		sched.submit(orgTask(entityPath("", entityOrg, firstOrg+i), numProjects, numApplications, userDist.count(firstOrg+i)))
+	}
+	sched.wait()
+	stopDashboard()
+	totals := sched.totals()
 
 	// Track total execution time
 	totalDuration := time.Since(startTotal)
 
 	// Print summary
-	fmt.Printf("\nTotal Organizations Created: %d\n", orgCount)
-	fmt.Printf("Total Projects Created: %d\n", projectCount)
-	fmt.Printf("Total Applications Created: %d\n", appCount)
-	fmt.Printf("Total Users Created: %d\n", userCount)
+	fmt.Printf("\nTotal Organizations Created: %d\n", totals.Orgs)
+	fmt.Printf("Total Projects Created: %d\n", totals.Projects)
+	fmt.Printf("Total Applications Created: %d\n", totals.Apps)
+	fmt.Printf("Total Users Created: %d\n", totals.Users)
+	reportSkipped(totals)
 	fmt.Printf("Total Time Taken: %v\n", totalDuration)
-}
-
-func initLogging(logFilePath string) {
-	file, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening log file: %v", err)
-	}
-	log.SetOutput(file)
-
-	// Add this line to confirm logging is initialized
-	log.Println("Logging initialized successfully")
+	reportOpStats(totalDuration)
+	breaker.report()
+	reportHTTPTrace()
+	reportStopped(ctx.Err(), "Creation phase", createTimeout)
+	return totals
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// Create every organization with users through runConcurrent
+func runConcurrentWithUsers(numOrgs, numProjects, numApplications, numUsers int) creationTotals {
+	prevDist := userDist
+	defer func() { userDist = prevDist }()
+	userDist = newUserDistribution(usersFixed, numUsers, numOrgs, 0)
+	return runConcurrent(context.Background(), 1, numOrgs, numProjects, numApplications)
+}
+
+func TestRunConcurrentTotals(t *testing.T) {
+	// Conflicts go through the lookup of the existing entity and still count
+	m := startMock(t, mockConfig{ConflictRate: 0.2})
+
+	totals := runConcurrentWithUsers(3, 2, 2, 4)
+	want := creationTotals{Orgs: 3, Projects: 6, Apps: 12, Users: 12}
+	if totals != want {
+		t.Errorf("got totals %+v, want %+v", totals, want)
+	}
+	if orgs, projects, apps, users := m.counts(); orgs != 3 || projects != 6 || apps != 12 || users != 12 {
+		t.Errorf("mock stores %d orgs, %d projects, %d apps, %d users, want 3, 6, 12, 12", orgs, projects, apps, users)
+	}
+	for op, n := range map[string]int{"Create Organization": 3, "Create Project": 6, "Create Application": 12, "Create User": 12} {
+		if sum := statsFor(op).summary(); sum.count != n || sum.failed != 0 {
+			t.Errorf("%s: %d succeeded, %d failed, want %d, 0", op, sum.count, sum.failed, n)
+		}
+	}
+}
+
+func TestRunConcurrentSkipsChildrenOfFailedOrgs(t *testing.T) {
+	startMock(t, mockConfig{ErrorRate: 1})
+	retry.maxAttempts = 1
+
+	totals := runConcurrentWithUsers(3, 2, 2, 4)
+	want := creationTotals{SkippedProjects: 6, SkippedApps: 12, SkippedUsers: 12}
+	if totals != want {
+		t.Errorf("got totals %+v, want %+v", totals, want)
+	}
+	if sum := statsFor("Create Organization").summary(); sum.count != 0 || sum.failed != 3 {
+		t.Errorf("organizations: %d succeeded, %d failed, want 0, 3", sum.count, sum.failed)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Entity types recorded in the manifest
+const (
+	entityOrg     = "org"
+	entityProject = "project"
+	entityApp     = "app"
+	entityUser    = "user"
+)
+
+// One created entity, written as a single JSON line to the manifest
+type manifestEntry struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	OrgID     string `json:"orgId,omitempty"`
+	ProjectID string `json:"projectId,omitempty"`
+	Email     string `json:"email,omitempty"`
+}
+
+// Append-only record of every entity created during a run
+type manifestWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+
+	// Called with every recorded entry, e.g. to stream it to the coordinator
+	forward func(manifestEntry)
+}
+
+// Manifest of the current run; nil when no manifest is written
+var manifest *manifestWriter
+
+// Create (or truncate) the manifest file at path
+func openManifest(path string) (*manifestWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("opening manifest: %v", err)
+	}
+	buf := bufio.NewWriter(file)
+	return &manifestWriter{file: file, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// Record a created entity; safe for concurrent use and a no-op on a nil manifest
+func (m *manifestWriter) record(entry manifestEntry) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.forward != nil {
+		m.forward(entry)
+	}
+	if m.enc == nil {
+		return
+	}
+	if err := m.enc.Encode(entry); err != nil {
+		log.Printf("Error writing manifest entry for %s %s: %v", entry.Type, entry.Name, err)
+	}
+}
+
+// Flush buffered entries and close the manifest file
+func (m *manifestWriter) close() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.file == nil {
+		return nil
+	}
+	if err := m.buf.Flush(); err != nil {
+		m.file.Close()
+		return fmt.Errorf("flushing manifest: %v", err)
+	}
+	return m.file.Close()
+}
+
+// Manifest that only forwards entries to send, without writing a file
+func forwardingManifest(send func(manifestEntry)) *manifestWriter {
+	return &manifestWriter{forward: send}
+}
+
+// Read all entries of a manifest written by a previous run
+func readManifest(path string) ([]manifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening manifest: %v", err)
+	}
+	defer file.Close()
+
+	var entries []manifestEntry
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for dec.More() {
+		var entry manifestEntry
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("decoding manifest entry %d: %v", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
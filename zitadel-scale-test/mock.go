@@ -0,0 +1,909 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+	"zitadel-scale-test/zitadel"
+)
+
+// Behaviour of the mock Zitadel server
+type mockConfig struct {
+	Latency      time.Duration // Base latency added to every request
+	Jitter       time.Duration // Random extra latency in [0, Jitter)
+	ErrorRate    float64       // Share of requests answered with 500
+	ConflictRate float64       // Share of create requests answered with 409 after the entity was stored
+	ThrottleRate float64       // Share of requests answered with 429
+	RetryAfter   time.Duration // Retry-After sent with 429 responses
+	TokenTTL     time.Duration // Lifetime of access tokens handed out by the token endpoint
+
+	// Time until a created entity shows up in list and search results, like
+	// Zitadel's asynchronously updated projections; reads by ID see it at once
+	ProjectionLag time.Duration
+}
+
+// Project or application with the ID of the org or project owning it
+type mockChild struct {
+	Parent string
+	Name   string
+}
+
+type mockUser struct {
+	ID         string
+	Username   string
+	OrgID      string
+	GivenName  string
+	FamilyName string
+	NickName   string
+	Display    string
+	Language   string
+	Gender     string
+	Email      string
+	Phone      string
+	Password   string
+	Hash       string // bcrypt hash of users imported with a hashed password
+}
+
+// Human part of the user as returned by reads
+func (u *mockUser) human() map[string]interface{} {
+	return map[string]interface{}{
+		"profile": map[string]string{
+			"givenName":         u.GivenName,
+			"familyName":        u.FamilyName,
+			"nickName":          u.NickName,
+			"displayName":       u.Display,
+			"preferredLanguage": u.Language,
+			"gender":            u.Gender,
+		},
+		"email": map[string]string{"email": u.Email},
+		"phone": map[string]string{"phone": u.Phone},
+	}
+}
+
+// In-memory fake of the Zitadel REST endpoints used by this tool. It is an
+// http.Handler, so tests can serve it with httptest.NewServer and point a
+// zitadel.Client at the returned URL.
+type mockZitadel struct {
+	cfg mockConfig
+	mux *http.ServeMux
+
+	mu         sync.Mutex
+	rng        *rand.Rand
+	nextID     int64
+	orgs       map[string]string    // id -> name
+	projects   map[string]mockChild // id -> project, owned by an org
+	apps       map[string]mockChild // id -> app, owned by a project
+	users      map[string]*mockUser
+	defaultOrg string
+	requests   map[string]int       // route -> number of requests
+	visibleAt  map[string]time.Time // id -> end of the projection lag of a new entity
+	downUntil  time.Time            // Simulated outage: every request fails with 503 until then
+}
+
+func newMockZitadel(cfg mockConfig) *mockZitadel {
+	m := &mockZitadel{
+		cfg:       cfg,
+		mux:       http.NewServeMux(),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		nextID:    280000000000000000,
+		orgs:      make(map[string]string),
+		projects:  make(map[string]mockChild),
+		apps:      make(map[string]mockChild),
+		users:     make(map[string]*mockUser),
+		requests:  make(map[string]int),
+		visibleAt: make(map[string]time.Time),
+	}
+	// The organization the token belongs to, returned by /orgs/me
+	m.defaultOrg = m.newID()
+	m.orgs[m.defaultOrg] = "ZITADEL"
+
+	m.handle("POST /management/v1/orgs", m.createOrg)
+	m.handle("GET /management/v1/orgs/me", m.getMyOrg)
+	m.handle("POST /management/v1/projects", m.createProject)
+	m.handle("POST /management/v1/projects/{id}/apps/api", m.createApp)
+	m.handle("POST /management/v1/projects/_search", m.searchProjects)
+	m.handle("POST /management/v1/projects/{id}/apps/_search", m.searchApps)
+	m.handle("POST /v2/organizations/_search", m.searchOrgs)
+	m.handle("GET /v2/users/{id}", m.getUser)
+	m.handle("POST /management/v1/users/_search", m.searchUsers)
+	m.handle("POST /v2/users/human", m.createUser)
+	m.handle("PUT /v2/users/human/{id}", m.updateUser)
+	m.handle("DELETE /v2/users/{id}", m.deleteUser)
+	m.handle("POST /v2/users", m.searchUsers)
+	m.handle("POST /v2/sessions", m.createSession)
+	m.handle("POST /admin/v1/import", m.importData)
+	m.mux.HandleFunc("POST /oauth/v2/token", m.issueToken)
+	m.mux.HandleFunc("GET /debug/healthz", m.healthz)
+	m.mux.HandleFunc("GET /mock/stats", m.stats)
+	m.mux.HandleFunc("POST /mock/outage", m.outage)
+	return m
+}
+
+// Register a route behind authentication, latency and failure injection
+func (m *mockZitadel) handle(pattern string, h http.HandlerFunc) {
+	m.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requests[pattern]++
+		delay := m.cfg.Latency
+		if m.cfg.Jitter > 0 {
+			delay += time.Duration(m.rng.Int63n(int64(m.cfg.Jitter)))
+		}
+		roll := m.rng.Float64()
+		down := time.Now().Before(m.downUntil)
+		m.mu.Unlock()
+
+		time.Sleep(delay)
+
+		if down {
+			writeMockError(w, http.StatusServiceUnavailable, 14, "Errors.Internal")
+			return
+		}
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			writeMockError(w, http.StatusUnauthorized, 16, "Errors.Token.Invalid")
+			return
+		}
+		if roll < m.cfg.ThrottleRate {
+			w.Header().Set("Retry-After", strconv.Itoa(int(m.cfg.RetryAfter.Seconds())))
+			writeMockError(w, http.StatusTooManyRequests, 8, "Errors.Quota.RequestsExhausted")
+			return
+		}
+		if roll < m.cfg.ThrottleRate+m.cfg.ErrorRate {
+			writeMockError(w, http.StatusInternalServerError, 13, "Errors.Internal")
+			return
+		}
+		h(w, r)
+	})
+}
+
+func (m *mockZitadel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+// Return a new unique ID; callers hold m.mu
+func (m *mockZitadel) newID() string {
+	m.nextID++
+	return strconv.FormatInt(m.nextID, 10)
+}
+
+// Hide a created entity from searches for the projection lag; callers hold m.mu
+func (m *mockZitadel) created(id string) {
+	if m.cfg.ProjectionLag > 0 {
+		m.visibleAt[id] = time.Now().Add(m.cfg.ProjectionLag)
+	}
+}
+
+// Report whether searches see the entity yet; callers hold m.mu
+func (m *mockZitadel) visible(id string) bool {
+	at, ok := m.visibleAt[id]
+	if !ok {
+		return true
+	}
+	if time.Now().Before(at) {
+		return false
+	}
+	delete(m.visibleAt, id)
+	return true
+}
+
+// Decide whether a successful create is reported as a conflict; callers hold m.mu
+func (m *mockZitadel) injectConflict() bool {
+	return m.cfg.ConflictRate > 0 && m.rng.Float64() < m.cfg.ConflictRate
+}
+
+// Return the organization a request is scoped to
+func (m *mockZitadel) requestOrg(r *http.Request) string {
+	if orgID := r.Header.Get("x-zitadel-orgid"); orgID != "" {
+		return orgID
+	}
+	return m.defaultOrg
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Write an error body shaped like the ones of the Zitadel gateway
+func writeMockError(w http.ResponseWriter, status, code int, message string) {
+	writeMockJSON(w, status, map[string]interface{}{"code": code, "message": message, "details": []interface{}{}})
+}
+
+func mockDetails() map[string]string {
+	return map[string]string{"sequence": "1", "creationDate": time.Now().UTC().Format(time.RFC3339Nano)}
+}
+
+func (m *mockZitadel) createOrg(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid AddOrgRequest.Name")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.orgs {
+		if name == req.Name {
+			writeMockError(w, http.StatusConflict, 6, "Errors.Org.AlreadyExists")
+			return
+		}
+	}
+	id := m.newID()
+	m.orgs[id] = req.Name
+	m.created(id)
+	if m.injectConflict() {
+		writeMockError(w, http.StatusConflict, 6, "Errors.Org.AlreadyExists")
+		return
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{"id": id, "details": mockDetails()})
+}
+
+func (m *mockZitadel) getMyOrg(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orgID := m.requestOrg(r)
+	name, ok := m.orgs[orgID]
+	if !ok {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.Org.NotFound")
+		return
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"org": map[string]string{"id": orgID, "name": name, "state": "ORG_STATE_ACTIVE"},
+	})
+}
+
+func (m *mockZitadel) createProject(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid AddProjectRequest.Name")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orgID := m.requestOrg(r)
+	if _, ok := m.orgs[orgID]; !ok {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.Org.NotFound")
+		return
+	}
+	for _, p := range m.projects {
+		if p.Parent == orgID && p.Name == req.Name {
+			writeMockError(w, http.StatusConflict, 6, "Errors.Project.AlreadyExists")
+			return
+		}
+	}
+	id := m.newID()
+	m.projects[id] = mockChild{Parent: orgID, Name: req.Name}
+	m.created(id)
+	if m.injectConflict() {
+		writeMockError(w, http.StatusConflict, 6, "Errors.Project.AlreadyExists")
+		return
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{"id": id, "details": mockDetails()})
+}
+
+func (m *mockZitadel) createApp(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid AddAPIAppRequest.Name")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	projID := r.PathValue("id")
+	if p, ok := m.projects[projID]; !ok || p.Parent != m.requestOrg(r) {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.Project.NotFound")
+		return
+	}
+	for _, a := range m.apps {
+		if a.Parent == projID && a.Name == req.Name {
+			writeMockError(w, http.StatusConflict, 6, "Errors.Project.App.AlreadyExists")
+			return
+		}
+	}
+	id := m.newID()
+	m.apps[id] = mockChild{Parent: projID, Name: req.Name}
+	m.created(id)
+	if m.injectConflict() {
+		writeMockError(w, http.StatusConflict, 6, "Errors.Project.App.AlreadyExists")
+		return
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"appId":        id,
+		"details":      mockDetails(),
+		"clientId":     id + "@mock",
+		"clientSecret": fmt.Sprintf("%x", m.rng.Int63()),
+	})
+}
+
+func (m *mockZitadel) createUser(w http.ResponseWriter, r *http.Request) {
+	var req zitadel.AddHumanUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" || req.Organization.OrgID == "" {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid AddHumanUserRequest")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.orgs[req.Organization.OrgID]; !ok {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.Org.NotFound")
+		return
+	}
+	for _, u := range m.users {
+		if u.Username == req.Username {
+			writeMockError(w, http.StatusConflict, 6, "Errors.User.AlreadyExists")
+			return
+		}
+	}
+	// Zitadel rejects numbers that are not E.164 and passwords that break the
+	// default complexity policy
+	if req.Phone != nil && !e164.MatchString(req.Phone.Phone) {
+		writeMockError(w, http.StatusBadRequest, 3, "Errors.User.Phone.Invalid")
+		return
+	}
+	if req.Password != nil && !complexPassword(req.Password.Password) {
+		writeMockError(w, http.StatusBadRequest, 3, "Errors.User.PasswordComplexityPolicy.Invalid")
+		return
+	}
+	id := req.UserID
+	if id == "" {
+		id = m.newID()
+	}
+	if _, ok := m.users[id]; ok {
+		writeMockError(w, http.StatusConflict, 6, "Errors.User.AlreadyExists")
+		return
+	}
+	u := &mockUser{
+		ID:         id,
+		Username:   req.Username,
+		OrgID:      req.Organization.OrgID,
+		GivenName:  req.Profile.GivenName,
+		FamilyName: req.Profile.FamilyName,
+		NickName:   req.Profile.NickName,
+		Display:    defaultDisplayName(req.Profile.DisplayName, req.Profile.GivenName, req.Profile.FamilyName),
+		Language:   defaultLanguage(req.Profile.PreferredLanguage),
+		Gender:     req.Profile.Gender,
+		Email:      req.Email.Email,
+	}
+	if req.Phone != nil {
+		u.Phone = req.Phone.Phone
+	}
+	if req.Password != nil {
+		u.Password = req.Password.Password
+	}
+	m.users[id] = u
+	m.created(id)
+	if m.injectConflict() {
+		writeMockError(w, http.StatusConflict, 6, "Errors.User.AlreadyExists")
+		return
+	}
+	writeMockJSON(w, http.StatusCreated, map[string]interface{}{"userId": id, "details": mockDetails()})
+}
+
+func (m *mockZitadel) updateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Profile *struct {
+			GivenName  string `json:"givenName"`
+			FamilyName string `json:"familyName"`
+		} `json:"profile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid UpdateHumanUserRequest")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[r.PathValue("id")]
+	if !ok {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.User.NotFound")
+		return
+	}
+	if req.Profile != nil {
+		u.GivenName, u.FamilyName = req.Profile.GivenName, req.Profile.FamilyName
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{"details": mockDetails()})
+}
+
+func (m *mockZitadel) deleteUser(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := r.PathValue("id")
+	if _, ok := m.users[id]; !ok {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.User.NotFound")
+		return
+	}
+	delete(m.users, id)
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{"details": mockDetails()})
+}
+
+// Text query as sent in user search criteria
+type mockTextQuery struct {
+	Value  string
+	Method string
+}
+
+func (q *mockTextQuery) matches(s string) bool {
+	if q == nil {
+		return true
+	}
+	switch q.Method {
+	case "TEXT_QUERY_METHOD_STARTS_WITH":
+		return strings.HasPrefix(s, q.Value)
+	case "TEXT_QUERY_METHOD_CONTAINS":
+		return strings.Contains(s, q.Value)
+	}
+	return s == q.Value
+}
+
+// Serves both the v2 user list and the management user search
+func (m *mockZitadel) searchUsers(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query struct {
+			Offset json.Number `json:"offset"`
+			Limit  int         `json:"limit"`
+		} `json:"query"`
+		Queries []struct {
+			UserNameQuery *struct {
+				UserName string `json:"userName"`
+				Method   string `json:"method"`
+			} `json:"userNameQuery"`
+			EmailQuery *struct {
+				EmailAddress string `json:"emailAddress"`
+				Method       string `json:"method"`
+			} `json:"emailQuery"`
+			OrganizationIDQuery *struct {
+				OrganizationID string `json:"organizationId"`
+			} `json:"organizationIdQuery"`
+			StateQuery *struct {
+				State string `json:"state"`
+			} `json:"stateQuery"`
+		} `json:"queries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid ListUsersRequest")
+		return
+	}
+	management := strings.HasPrefix(r.URL.Path, "/management/")
+
+	var username, email *mockTextQuery
+	orgID := ""
+	if management {
+		orgID = m.requestOrg(r)
+	}
+	for _, q := range req.Queries {
+		if q.UserNameQuery != nil {
+			username = &mockTextQuery{q.UserNameQuery.UserName, q.UserNameQuery.Method}
+		}
+		if q.EmailQuery != nil {
+			email = &mockTextQuery{q.EmailQuery.EmailAddress, q.EmailQuery.Method}
+		}
+		if q.OrganizationIDQuery != nil {
+			orgID = q.OrganizationIDQuery.OrganizationID
+		}
+		// All mock users are active, so state queries match everything
+	}
+
+	m.mu.Lock()
+	var matches []*mockUser
+	for _, u := range m.users {
+		if (orgID == "" || u.OrgID == orgID) && username.matches(u.Username) && email.matches(u.Email) && m.visible(u.ID) {
+			copied := *u
+			matches = append(matches, &copied)
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Username < matches[j].Username })
+
+	offset, _ := strconv.Atoi(req.Query.Offset.String())
+	limit := req.Query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	end := offset + limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	result := make([]map[string]interface{}, 0, end-offset)
+	for _, u := range matches[offset:end] {
+		human := u.human()
+		if management {
+			result = append(result, map[string]interface{}{"id": u.ID, "userName": u.Username, "state": "USER_STATE_ACTIVE", "human": human})
+		} else {
+			result = append(result, map[string]interface{}{"userId": u.ID, "username": u.Username, "state": "USER_STATE_ACTIVE", "human": human})
+		}
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"details": map[string]string{"totalResult": strconv.Itoa(len(matches))},
+		"result":  result,
+	})
+}
+
+func (m *mockZitadel) createSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Checks struct {
+			User struct {
+				LoginName string `json:"loginName"`
+			} `json:"user"`
+			Password *struct {
+				Password string `json:"password"`
+			} `json:"password"`
+		} `json:"checks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid CreateSessionRequest")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var user *mockUser
+	for _, u := range m.users {
+		if u.Username == req.Checks.User.LoginName {
+			user = u
+			break
+		}
+	}
+	if user == nil {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.User.NotFound")
+		return
+	}
+	if req.Checks.Password != nil && !user.checkPassword(req.Checks.Password.Password) {
+		writeMockError(w, http.StatusBadRequest, 3, "Errors.User.Password.Invalid")
+		return
+	}
+	writeMockJSON(w, http.StatusCreated, map[string]interface{}{
+		"details":      mockDetails(),
+		"sessionId":    m.newID(),
+		"sessionToken": fmt.Sprintf("%x", m.rng.Int63()),
+	})
+}
+
+func (u *mockUser) checkPassword(password string) bool {
+	if u.Hash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(u.Hash), []byte(password)) == nil
+	}
+	return password == u.Password
+}
+
+// Admin import: creates the organizations with their given IDs and their
+// users, reporting the entities that cannot be imported instead of failing
+func (m *mockZitadel) importData(w http.ResponseWriter, r *http.Request) {
+	var req zitadel.ImportDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid ImportDataRequest")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var resp zitadel.ImportDataResponse
+	success := &zitadel.ImportDataSuccess{}
+	fail := func(kind, id, message string) {
+		resp.Errors = append(resp.Errors, zitadel.ImportDataError{Type: kind, ID: id, Message: message})
+	}
+orgs:
+	for _, org := range req.DataOrgs.Orgs {
+		if _, ok := m.orgs[org.OrgID]; ok || org.OrgID == "" || org.Org.Name == "" {
+			fail("org", org.OrgID, "Errors.Org.AlreadyExists")
+			continue
+		}
+		for _, name := range m.orgs {
+			if name == org.Org.Name {
+				fail("org", org.OrgID, "Errors.Org.AlreadyExists")
+				continue orgs
+			}
+		}
+		m.orgs[org.OrgID] = org.Org.Name
+		m.created(org.OrgID)
+		done := zitadel.ImportDataSuccessOrg{OrgID: org.OrgID}
+
+	users:
+		for _, hu := range org.HumanUsers {
+			u := hu.User
+			if _, ok := m.users[hu.UserID]; ok {
+				fail("human_user", hu.UserID, "Errors.User.AlreadyExists")
+				continue
+			}
+			for _, existing := range m.users {
+				if existing.Username == u.UserName {
+					fail("human_user", hu.UserID, "Errors.User.AlreadyExists")
+					continue users
+				}
+			}
+			switch {
+			case u.Phone != nil && !e164.MatchString(u.Phone.Phone):
+				fail("human_user", hu.UserID, "Errors.User.Phone.Invalid")
+				continue
+			case u.HashedPassword != nil && !strings.HasPrefix(u.HashedPassword.Value, "$2"):
+				fail("human_user", hu.UserID, "Errors.User.Password.Hash.Invalid")
+				continue
+			case u.HashedPassword == nil && u.Password != "" && !complexPassword(u.Password):
+				fail("human_user", hu.UserID, "Errors.User.PasswordComplexityPolicy.Invalid")
+				continue
+			}
+			user := &mockUser{
+				ID:         hu.UserID,
+				Username:   u.UserName,
+				OrgID:      org.OrgID,
+				GivenName:  u.Profile.FirstName,
+				FamilyName: u.Profile.LastName,
+				NickName:   u.Profile.NickName,
+				Display:    defaultDisplayName(u.Profile.DisplayName, u.Profile.FirstName, u.Profile.LastName),
+				Language:   defaultLanguage(u.Profile.PreferredLanguage),
+				Gender:     u.Profile.Gender,
+				Email:      u.Email.Email,
+				Password:   u.Password,
+			}
+			if u.Phone != nil {
+				user.Phone = u.Phone.Phone
+			}
+			if u.HashedPassword != nil {
+				user.Hash = u.HashedPassword.Value
+			}
+			m.users[hu.UserID] = user
+			m.created(hu.UserID)
+			done.HumanUserIDs = append(done.HumanUserIDs, hu.UserID)
+		}
+		success.Orgs = append(success.Orgs, done)
+	}
+	resp.Success = success
+	writeMockJSON(w, http.StatusOK, resp)
+}
+
+// Token endpoint accepting any JWT-profile assertion; signatures are not checked
+func (m *mockZitadel) issueToken(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || r.FormValue("assertion") == "" {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	m.requests["POST /oauth/v2/token"]++
+	token := fmt.Sprintf("mock-%x", m.rng.Int63())
+	m.mu.Unlock()
+
+	ttl := m.cfg.TokenTTL
+	if ttl <= 0 {
+		ttl = 12 * time.Hour
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(ttl.Seconds()),
+	})
+}
+
+// Report entity and request counts, e.g. for assertions in tests
+func (m *mockZitadel) stats(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"orgs":     len(m.orgs),
+		"projects": len(m.projects),
+		"apps":     len(m.apps),
+		"users":    len(m.users),
+		"requests": m.requests,
+	})
+}
+
+// Decode the name query of an org, project or app search
+func decodeNameQuery(r *http.Request) (*mockTextQuery, error) {
+	var req struct {
+		Queries []struct {
+			NameQuery *struct {
+				Name   string `json:"name"`
+				Method string `json:"method"`
+			} `json:"nameQuery"`
+		} `json:"queries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	for _, q := range req.Queries {
+		if q.NameQuery != nil {
+			return &mockTextQuery{Value: q.NameQuery.Name, Method: q.NameQuery.Method}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Answer a search with the matching id -> name pairs, sorted by name
+func writeNameResults(w http.ResponseWriter, names map[string]string, query *mockTextQuery) {
+	result := []map[string]string{}
+	for id, name := range names {
+		if query == nil || query.matches(name) {
+			result = append(result, map[string]string{"id": id, "name": name})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i]["name"] < result[j]["name"] })
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"details": map[string]string{"totalResult": strconv.Itoa(len(result))},
+		"result":  result,
+	})
+}
+
+func (m *mockZitadel) searchOrgs(w http.ResponseWriter, r *http.Request) {
+	query, err := decodeNameQuery(r)
+	if err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid ListOrganizationsRequest")
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make(map[string]string)
+	for id, name := range m.orgs {
+		if m.visible(id) {
+			names[id] = name
+		}
+	}
+	writeNameResults(w, names, query)
+}
+
+func (m *mockZitadel) searchProjects(w http.ResponseWriter, r *http.Request) {
+	query, err := decodeNameQuery(r)
+	if err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid ListProjectsRequest")
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orgID := m.requestOrg(r)
+	names := make(map[string]string)
+	for id, p := range m.projects {
+		if p.Parent == orgID && m.visible(id) {
+			names[id] = p.Name
+		}
+	}
+	writeNameResults(w, names, query)
+}
+
+func (m *mockZitadel) searchApps(w http.ResponseWriter, r *http.Request) {
+	query, err := decodeNameQuery(r)
+	if err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid ListAppsRequest")
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	projID := r.PathValue("id")
+	if p, ok := m.projects[projID]; !ok || p.Parent != m.requestOrg(r) {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.Project.NotFound")
+		return
+	}
+	names := make(map[string]string)
+	for id, a := range m.apps {
+		if a.Parent == projID && m.visible(id) {
+			names[id] = a.Name
+		}
+	}
+	writeNameResults(w, names, query)
+}
+
+func (m *mockZitadel) getUser(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[r.PathValue("id")]
+	if !ok {
+		writeMockError(w, http.StatusNotFound, 5, "Errors.User.NotFound")
+		return
+	}
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"details": map[string]string{"resourceOwner": u.OrgID},
+		"user":    map[string]interface{}{"userId": u.ID, "username": u.Username, "state": "USER_STATE_ACTIVE", "human": u.human()},
+	})
+}
+
+// Health endpoint used by the circuit breaker probe
+func (m *mockZitadel) healthz(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	down := time.Now().Before(m.downUntil)
+	m.mu.Unlock()
+	if down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Simulate an outage: POST /mock/outage?duration=30s answers every request,
+// including the health endpoint, with 503 for the given duration
+func (m *mockZitadel) outage(w http.ResponseWriter, r *http.Request) {
+	duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil {
+		writeMockError(w, http.StatusBadRequest, 3, "invalid duration")
+		return
+	}
+	until := time.Now().Add(duration)
+	m.mu.Lock()
+	m.downUntil = until
+	m.mu.Unlock()
+	log.Printf("Simulating an outage for %v", duration)
+	writeMockJSON(w, http.StatusOK, map[string]string{"downUntil": until.Format(time.RFC3339)})
+}
+
+// Run the serve-mock command: serve the mock Zitadel until the process is killed
+func runServeMock(args []string) {
+	fs := flag.NewFlagSet("serve-mock", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "Address the mock server listens on")
+	var cfg mockConfig
+	fs.DurationVar(&cfg.Latency, "latency", 0, "Base latency added to every request")
+	fs.DurationVar(&cfg.Jitter, "jitter", 0, "Random extra latency added to every request")
+	fs.Float64Var(&cfg.ErrorRate, "error-rate", 0, "Share of requests answered with 500 (0-1)")
+	fs.Float64Var(&cfg.ConflictRate, "conflict-rate", 0, "Share of create requests answered with 409 after storing the entity (0-1)")
+	fs.Float64Var(&cfg.ThrottleRate, "throttle-rate", 0, "Share of requests answered with 429 (0-1)")
+	fs.DurationVar(&cfg.RetryAfter, "retry-after", time.Second, "Retry-After sent with 429 responses")
+	fs.DurationVar(&cfg.TokenTTL, "token-ttl", 12*time.Hour, "Lifetime of access tokens issued for JWT-profile assertions")
+	fs.DurationVar(&cfg.ProjectionLag, "projection-lag", 0, "Time until created entities show up in list and search results")
+	fs.Parse(args)
+
+	// gRPC calls are answered on the same port over h2c, by translating them
+	// into requests to the REST endpoints
+	rest := newMockZitadel(cfg)
+	grpcGateway := zitadel.NewGatewayServer(rest)
+	server := &http.Server{
+		Addr: *addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+				grpcGateway.ServeHTTP(w, r)
+				return
+			}
+			rest.ServeHTTP(w, r)
+		}),
+		Protocols: new(http.Protocols),
+	}
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+
+	fmt.Printf("Mock Zitadel listening on http://%s (REST and gRPC)\n", *addr)
+	log.Printf("Mock Zitadel listening on http://%s with %+v", *addr, cfg)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("Mock server failed: %v", err)
+	}
+}
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Default password complexity policy: 8+ characters with upper and lower
+// case, a digit and a symbol
+func complexPassword(p string) bool {
+	var upper, lower, digit, symbol bool
+	for _, r := range p {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	return utf8.RuneCountInString(p) >= 8 && upper && lower && digit && symbol
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Serve a mock with cfg and point the API client, the health probe and the
+// globals of a run at it, with a fast retry policy, no breaker and fresh
+// stats; everything is restored when the test ends
+func startMock(t *testing.T, cfg mockConfig) *mockZitadel {
+	t.Helper()
+	m := newMockZitadel(cfg)
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	serveAPI(t, srv.URL, srv.Client())
+	return m
+}
+
+// Point the globals of a run at the Zitadel instance at url
+func serveAPI(t *testing.T, url string, httpClient *http.Client) {
+	t.Helper()
+	prevAPI, prevIssuer, prevRetry, prevBreaker, prevDashboard := api, issuer, retry, breaker, dashboardMode
+	t.Cleanup(func() {
+		api, issuer, retry, breaker, dashboardMode = prevAPI, prevIssuer, prevRetry, prevBreaker, prevDashboard
+		resetOpStats()
+	})
+
+	client := zitadel.NewClient(url, httpClient)
+	client.Token = staticToken("test-token").token
+	api = client
+	issuer = url
+	retry = retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: 10 * time.Millisecond, maxElapsed: 10 * time.Second}
+	breaker = nil
+	dashboardMode = "off"
+	resetOpStats()
+}
+
+func resetOpStats() {
+	opStatsMu.Lock()
+	opStats = make(map[string]*latencyStats)
+	opOrder = nil
+	opStatsMu.Unlock()
+}
+
+// Entities stored by the mock
+func (m *mockZitadel) counts() (orgs, projects, apps, users int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The organization of the token is not created by the tool
+	return len(m.orgs) - 1, len(m.projects), len(m.apps), len(m.users)
+}
+
+func TestClientCreatesEntities(t *testing.T) {
+	m := startMock(t, mockConfig{})
+	ctx := context.Background()
+
+	orgID, err := createOrganization(ctx, "org-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	projID, err := createProject(ctx, orgID, "project-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appID, err := createApplication(ctx, orgID, projID, "app-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createUser(ctx, "user-1", "user-1", newIdentity("user-1"), orgID); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.orgs[orgID] != "org-1" {
+		t.Errorf("organization %s is %q, want org-1", orgID, m.orgs[orgID])
+	}
+	if p := m.projects[projID]; p.Name != "project-1" || p.Parent != orgID {
+		t.Errorf("project %s is %+v, want project-1 in %s", projID, p, orgID)
+	}
+	if a := m.apps[appID]; a.Name != "app-1" || a.Parent != projID {
+		t.Errorf("application %s is %+v, want app-1 in %s", appID, a, projID)
+	}
+	if u := m.users["user-1"]; u == nil || u.Username != "user-1" || u.OrgID != orgID {
+		t.Errorf("user user-1 is %+v, want user-1 in %s", u, orgID)
+	}
+}
+
+func TestClientReusesExistingEntities(t *testing.T) {
+	// Every create stores the entity and still answers 409
+	m := startMock(t, mockConfig{ConflictRate: 1})
+	ctx := context.Background()
+
+	orgID, err := createOrganization(ctx, "org-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	projID, err := createProject(ctx, orgID, "project-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appID, err := createApplication(ctx, orgID, projID, "app-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createUser(ctx, "user-1", "user-1", newIdentity("user-1"), orgID); err != nil {
+		t.Fatal(err)
+	}
+	// A user of another organization cannot be reused
+	if err := createUser(ctx, "user-1", "user-1", newIdentity("user-1"), "other-org"); err == nil {
+		t.Error("user of another organization was reused")
+	}
+
+	if orgs, projects, apps, users := m.counts(); orgs != 1 || projects != 1 || apps != 1 || users != 1 {
+		t.Errorf("mock stores %d orgs, %d projects, %d apps, %d users, want every entity once", orgs, projects, apps, users)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.orgs[orgID] != "org-1" || m.projects[projID].Name != "project-1" || m.apps[appID].Name != "app-1" {
+		t.Errorf("looked up IDs %s, %s, %s do not match the stored entities", orgID, projID, appID)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	startMock(t, mockConfig{ThrottleRate: 1, RetryAfter: 2 * time.Second})
+	_, err := api.AddOrganization(context.Background(), zitadel.AddOrganizationRequest{Name: "org-1"})
+
+	var apiErr *zitadel.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, want an *zitadel.APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 2*time.Second {
+		t.Errorf("got status %d, Retry-After %v, want 429, 2s", apiErr.StatusCode, apiErr.RetryAfter)
+	}
+	if class := classifyError(err); class != errorThrottled {
+		t.Errorf("classified as %q, want %q", class, errorThrottled)
+	}
+
+	// Requests without a token are rejected as client errors
+	api.(*zitadel.Client).Token = nil
+	_, err = api.AddOrganization(context.Background(), zitadel.AddOrganizationRequest{Name: "org-1"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v, want a 401 *zitadel.APIError", err)
+	}
+	if class := classifyError(err); class != errorClient {
+		t.Errorf("classified as %q, want %q", class, errorClient)
+	}
+}
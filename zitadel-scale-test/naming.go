@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Entity naming. Names are built from the run ID, the name template and the
+// position of the entity in the hierarchy created by the run, so that every
+// name is unique, reproducible with -run-id and traceable to its run.
+var (
+	runID        = time.Now().UTC().Format("20060102-150405")
+	nameTemplate = "{run}-{path}" // Placeholders: {run}, {kind}, {path}
+)
+
+// Position of an entity below its parent, e.g. "org-3-project-2" for the
+// second project of the third organization; indices are 1-based
+func entityPath(parent, kind string, index int) string {
+	if parent == "" {
+		return fmt.Sprintf("%s-%d", kind, index)
+	}
+	return fmt.Sprintf("%s-%s-%d", parent, kind, index)
+}
+
+// Name of the entity of the given kind at path
+func entityName(kind, path string) string {
+	return strings.NewReplacer("{run}", runID, "{kind}", kind, "{path}", path).Replace(nameTemplate)
+}
+
+// The path is the only part that differs between the entities of a run
+func validateNameTemplate(template string) error {
+	if !strings.Contains(template, "{path}") {
+		return fmt.Errorf("name template %q lacks the {path} placeholder", template)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Spaces out API calls to keep to a maximum rate
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // Time between two calls
+	next     time.Time     // Earliest start of the next call
+}
+
+// Limiter used by retryWithBackoff; nil when the rate is unlimited
+var limiter *rateLimiter
+
+// Create a limiter allowing perSecond calls per second; nil for no limit
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait for the next free slot; fail when ctx is done first
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if d := time.Until(slot); d > 0 {
+		sleepContext(ctx, d)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Retry policy shared by every API call
+type retryPolicy struct {
+	maxAttempts int           // Attempts including the first one
+	baseDelay   time.Duration // Backoff ceiling of the first retry, doubled on every retry
+	maxDelay    time.Duration // Upper bound of the backoff ceiling
+	maxElapsed  time.Duration // Total time after which no further attempt is started
+}
+
+// Policy used by retryWithBackoff; main overrides it from the command line
+var retry = retryPolicy{
+	maxAttempts: 3,
+	baseDelay:   100 * time.Millisecond,
+	maxDelay:    10 * time.Second,
+	maxElapsed:  time.Minute,
+}
+
+// Classes of errors, used both for the retry decision and in the stats
+const (
+	errorNetwork   = "network"
+	errorTimeout   = "timeout"
+	errorCanceled  = "canceled"
+	errorThrottled = "429"
+	errorServer    = "5xx"
+	errorClient    = "4xx"
+	errorOther     = "other"
+)
+
+// Classify an error returned by an API call
+func classifyError(err error) string {
+	var apiErr *zitadel.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return errorThrottled
+		case apiErr.StatusCode >= 500:
+			return errorServer
+		case apiErr.StatusCode >= 400:
+			return errorClient
+		}
+		return errorOther
+	}
+
+	// Request contexts are only canceled on shutdown, and time out after requestTimeout
+	if errors.Is(err, context.Canceled) {
+		return errorCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorTimeout
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return errorNetwork
+	}
+	return errorOther
+}
+
+// Only transient failures are worth another attempt
+func isRetryable(class string) bool {
+	return class == errorNetwork || class == errorTimeout || class == errorThrottled || class == errorServer
+}
+
+// Error that must not be retried whatever its class, e.g. the timeout of a
+// request that is not idempotent; it keeps the class of the wrapped error
+type noRetryError struct {
+	err error
+}
+
+func noRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+	return noRetryError{err}
+}
+
+func (e noRetryError) Error() string { return e.err.Error() }
+func (e noRetryError) Unwrap() error { return e.err }
+
+// Delay before the given retry (1 for the first retry): a uniformly random
+// duration up to the exponential ceiling ("full jitter"), but at least the
+// Retry-After the server asked for
+func (p retryPolicy) delay(retryNum int, err error) time.Duration {
+	ceiling := p.baseDelay << uint(retryNum-1)
+	if ceiling > p.maxDelay || ceiling <= 0 {
+		ceiling = p.maxDelay
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling) + 1))
+
+	var apiErr *zitadel.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+		delay = apiErr.RetryAfter
+	}
+	return delay
+}
+
+// Log a failed attempt with its error class and what happened next, as
+// "retried", "not retried", "gave up" or "retry budget exhausted"
+func logFailure(ctx context.Context, level slog.Level, err error, class, outcome string, attrs ...slog.Attr) {
+	var apiErr *zitadel.APIError
+	if errors.As(err, &apiErr) {
+		attrs = append(attrs, slog.String("status", fmt.Sprintf("%d %s", apiErr.StatusCode, http.StatusText(apiErr.StatusCode))))
+	}
+	attrs = append(attrs, slog.String("error_class", class), slog.String("outcome", outcome), slog.String("error", err.Error()))
+	slog.LogAttrs(ctx, level, "request failed", attrs...)
+}
+
+// Run fn until it succeeds, fails with a non-retryable error or the policy is
+// exhausted. op names the kind of operation in the stats, actionName the
+// entity in the logs. Every attempt is recorded in the stats of op. No new
+// attempt is started once ctx is done; every attempt gets its own request
+// context with the per-request timeout.
+func retryWithBackoff(ctx context.Context, op, actionName string, fn func(reqCtx context.Context) error) error {
+	return retryWithTimeout(ctx, op, actionName, requestTimeout, fn)
+}
+
+// Same as retryWithBackoff, with timeout instead of -request-timeout for
+// every attempt, for calls the server works on for longer
+func retryWithTimeout(ctx context.Context, op, actionName string, timeout time.Duration, fn func(reqCtx context.Context) error) error {
+	stats := statsFor(op)
+	start := time.Now()
+	sampled := sampleEntity()
+	var err error
+	for attempt := 1; ; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			stats.skip(errorCanceled)
+			if err != nil {
+				return fmt.Errorf("%w after %d attempts, last error: %v", ctxErr, attempt-1, err)
+			}
+			return ctxErr
+		}
+
+		// Hold the call while the server is considered down
+		if err := breaker.wait(ctx); err != nil {
+			stats.skip("circuit open")
+			return err
+		}
+
+		// Keep to the configured request rate
+		if err := limiter.wait(ctx); err != nil {
+			stats.skip(errorCanceled)
+			return err
+		}
+
+		reqCtx, cancel := context.WithTimeout(abortCtx, timeout)
+		reqCtx = withTraceLabel(reqCtx, op)
+		reqCtx = withLogFields(reqCtx, logFields{op: op, entity: actionName, attempt: attempt, sampled: sampled})
+		attemptStart := time.Now() // Start the timer for the API call
+		dash.attempt()
+		err = fn(reqCtx)
+		duration := time.Since(attemptStart) // Calculate the duration of the API call
+		cancel()
+		dash.attemptDone(op, duration, err)
+
+		// Client errors come from a healthy server and do not count against it,
+		// neither do requests canceled on shutdown
+		breaker.record(ctx, err != nil && isRetryable(classifyError(err)))
+
+		if err == nil {
+			stats.record(duration)
+			slog.LogAttrs(reqCtx, slog.LevelInfo, "request succeeded", slog.Duration("latency", duration))
+			return nil
+		}
+
+		class := classifyError(err)
+		if breaker.hasAborted() {
+			stats.fail(class + " (circuit open)")
+			return fmt.Errorf("%w, last error: %v", errCircuitOpen, err)
+		}
+		if !isRetryable(class) || errors.As(err, new(noRetryError)) {
+			stats.fail(class + " (not retried)")
+			logFailure(reqCtx, slog.LevelWarn, err, class, "not retried", slog.Duration("latency", duration))
+			return err
+		}
+		if attempt >= retry.maxAttempts {
+			stats.fail(class + " (gave up)")
+			logFailure(reqCtx, slog.LevelError, err, class, "gave up", slog.Duration("latency", duration))
+			break
+		}
+
+		delay := retry.delay(attempt, err)
+		if time.Since(start)+delay > retry.maxElapsed {
+			stats.fail(class + " (retry budget exhausted)")
+			logFailure(reqCtx, slog.LevelError, err, class, "retry budget exhausted", slog.Duration("latency", duration), slog.Duration("retry_budget", retry.maxElapsed))
+			return fmt.Errorf("retry budget of %v exhausted after %d attempts, last error: %w", retry.maxElapsed, attempt, err)
+		}
+
+		stats.fail(class + " (retried)")
+		logFailure(reqCtx, slog.LevelWarn, err, class, "retried", slog.Duration("latency", duration), slog.Duration("retry_in", delay))
+		sleepContext(ctx, delay)
+	}
+	return fmt.Errorf("after %d attempts, last error: %w", retry.maxAttempts, err)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Create an organization through retryWithBackoff, as the scheduler does
+func createOrgWithRetry(ctx context.Context, name string) error {
+	return retryWithBackoff(ctx, "Create Organization", name, func(reqCtx context.Context) error {
+		_, err := createOrganization(reqCtx, name)
+		return err
+	})
+}
+
+// Failures and operations not attempted recorded for op
+func opFailures(op string) (failures, notAttempted map[string]int) {
+	snap := statsFor(op).snapshot()
+	return snap.Failures, snap.NotAttempted
+}
+
+func TestRetryRecoversFromTransientErrors(t *testing.T) {
+	// The first two requests fail with 500, then the mock answers
+	m := newMockZitadel(mockConfig{})
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			writeMockError(w, http.StatusInternalServerError, 13, "Errors.Internal")
+			return
+		}
+		m.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	serveAPI(t, srv.URL, srv.Client())
+
+	if err := createOrgWithRetry(context.Background(), "org-1"); err != nil {
+		t.Fatal(err)
+	}
+	sum := statsFor("Create Organization").summary()
+	failures, _ := opFailures("Create Organization")
+	if sum.count != 1 || failures["5xx (retried)"] != 2 || len(failures) != 1 {
+		t.Errorf("got %d succeeded and failures %v, want 1 and 2 retried 5xx", sum.count, failures)
+	}
+	if orgs, _, _, _ := m.counts(); orgs != 1 {
+		t.Errorf("mock stores %d organizations, want 1", orgs)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	m := startMock(t, mockConfig{ErrorRate: 1})
+
+	err := createOrgWithRetry(context.Background(), "org-1")
+	var apiErr *zitadel.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got %v, want the last 500", err)
+	}
+	failures, _ := opFailures("Create Organization")
+	if failures["5xx (retried)"] != 2 || failures["5xx (gave up)"] != 1 {
+		t.Errorf("got failures %v, want 2 retried and 1 given up", failures)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := m.requests["POST /management/v1/orgs"]; n != retry.maxAttempts {
+		t.Errorf("mock got %d requests, want %d", n, retry.maxAttempts)
+	}
+}
+
+func TestRetrySkipsClientErrors(t *testing.T) {
+	m := startMock(t, mockConfig{})
+	api.(*zitadel.Client).Token = nil
+
+	if err := createOrgWithRetry(context.Background(), "org-1"); err == nil {
+		t.Fatal("request without a token succeeded")
+	}
+	failures, _ := opFailures("Create Organization")
+	if failures["4xx (not retried)"] != 1 || len(failures) != 1 {
+		t.Errorf("got failures %v, want 1 4xx not retried", failures)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := m.requests["POST /management/v1/orgs"]; n != 1 {
+		t.Errorf("mock got %d requests, want 1", n)
+	}
+}
+
+func TestRetryWaitsForRetryAfter(t *testing.T) {
+	startMock(t, mockConfig{ThrottleRate: 1, RetryAfter: time.Second})
+	retry.maxAttempts = 2
+
+	start := time.Now()
+	createOrgWithRetry(context.Background(), "org-1")
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the Retry-After of 1s", elapsed)
+	}
+	failures, _ := opFailures("Create Organization")
+	if failures["429 (retried)"] != 1 || failures["429 (gave up)"] != 1 {
+		t.Errorf("got failures %v, want 1 retried and 1 given up 429", failures)
+	}
+}
+
+func TestRetrySkipsCanceledWork(t *testing.T) {
+	m := startMock(t, mockConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := createOrgWithRetry(ctx, "org-1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	failures, notAttempted := opFailures("Create Organization")
+	if len(failures) != 0 || notAttempted[errorCanceled] != 1 {
+		t.Errorf("got failures %v and not attempted %v, want 1 canceled and no failure", failures, notAttempted)
+	}
+	if orgs, _, _, _ := m.counts(); orgs != 0 {
+		t.Errorf("mock stores %d organizations, want none", orgs)
+	}
+}
+
+func TestBreakerAbortsRun(t *testing.T) {
+	m := startMock(t, mockConfig{ErrorRate: 1})
+	retry.maxAttempts = 1
+	breaker = newCircuitBreaker(breakerAbort, 4, 0.5, 0, time.Second, probeZitadel)
+
+	ctx := context.Background()
+	for i := 0; i < 6; i++ {
+		err := createOrgWithRetry(ctx, "org-1")
+		if i >= 3 && !errors.Is(err, errCircuitOpen) {
+			t.Errorf("call %d: got %v, want errCircuitOpen", i+1, err)
+		}
+	}
+	if !breaker.hasAborted() {
+		t.Fatal("breaker did not abort after a window of failures")
+	}
+
+	// The call tripping the breaker is a failure, the later ones were never sent
+	failures, notAttempted := opFailures("Create Organization")
+	if failures["5xx (gave up)"] != 3 || failures["5xx (circuit open)"] != 1 || notAttempted["circuit open"] != 2 {
+		t.Errorf("got failures %v and not attempted %v", failures, notAttempted)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := m.requests["POST /management/v1/orgs"]; n != 4 {
+		t.Errorf("mock got %d requests, want 4", n)
+	}
+}
+
+func TestBreakerPausesUntilHealthy(t *testing.T) {
+	m := startMock(t, mockConfig{})
+	retry.maxAttempts = 1
+	breaker = newCircuitBreaker(breakerPause, 2, 1, 0, 20*time.Millisecond, probeZitadel)
+
+	outage := 200 * time.Millisecond
+	m.mu.Lock()
+	m.downUntil = time.Now().Add(outage)
+	m.mu.Unlock()
+
+	// Two failures open the breaker, the third call waits for the probe
+	start := time.Now()
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := createOrgWithRetry(ctx, "org-1"); err == nil {
+			t.Fatalf("call %d succeeded during the outage", i+1)
+		}
+	}
+	if err := createOrgWithRetry(ctx, "org-1"); err != nil {
+		t.Fatalf("call after the outage: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < outage {
+		t.Errorf("call went through after %v, before the outage of %v ended", elapsed, outage)
+	}
+
+	breaker.mu.Lock()
+	trips, paused := breaker.trips, breaker.pausedFor
+	breaker.mu.Unlock()
+	if trips != 1 || paused <= 0 {
+		t.Errorf("breaker opened %d times and paused for %v, want once and a pause", trips, paused)
+	}
+	failures, _ := opFailures("Create Organization")
+	if failures["5xx (gave up)"] != 2 || statsFor("Create Organization").summary().count != 1 {
+		t.Errorf("got failures %v, want 2 given up 5xx and 1 success", failures)
+	}
+}
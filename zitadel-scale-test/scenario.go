@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"zitadel-scale-test/zitadel"
+)
+
+// Actions a scenario step can perform, with the pool entity they need
+var scenarioActions = map[string]string{
+	"create_org":  "",
+	"create_user": entityOrg,
+	"login":       entityUser,
+	"search":      entityUser,
+	"update_user": entityUser,
+	"delete_user": entityUser,
+}
+
+// Scenario describes a weighted mix of steps executed by a pool of workers
+type Scenario struct {
+	Name       string        `yaml:"name"`
+	Duration   time.Duration `yaml:"duration"`   // Stop after this long...
+	Iterations int           `yaml:"iterations"` // ...or after this many steps, whichever comes first
+	Workers    int           `yaml:"workers"`
+	Seed       int64         `yaml:"seed"`
+	Manifest   string        `yaml:"manifest"` // Optional manifest whose orgs and users seed the pools
+	Steps      []Step        `yaml:"steps"`
+}
+
+// Step is one named, weighted action of a scenario
+type Step struct {
+	Name   string        `yaml:"name"`
+	Action string        `yaml:"action"`
+	Weight int           `yaml:"weight"`
+	Think  time.Duration `yaml:"think"` // Pause of the worker after the step
+	Needs  string        `yaml:"needs"` // Pool entity required before the step can run; defaults to what the action needs
+}
+
+// Load and validate a scenario file
+func loadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading scenario: %v", err)
+	}
+
+	var sc Scenario
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("parsing scenario: %v", err)
+	}
+
+	if len(sc.Steps) == 0 {
+		return nil, fmt.Errorf("scenario %s has no steps", sc.Name)
+	}
+	if sc.Duration <= 0 && sc.Iterations <= 0 {
+		return nil, fmt.Errorf("scenario %s needs a duration or a number of iterations", sc.Name)
+	}
+	if sc.Workers <= 0 {
+		sc.Workers = 1
+	}
+	if sc.Seed == 0 {
+		sc.Seed = time.Now().UnixNano()
+	}
+
+	names := make(map[string]bool)
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		needs, ok := scenarioActions[step.Action]
+		if !ok {
+			return nil, fmt.Errorf("step %s: unknown action %q", step.Name, step.Action)
+		}
+		if step.Name == "" {
+			step.Name = step.Action
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("duplicate step name %q", step.Name)
+		}
+		names[step.Name] = true
+		if step.Weight <= 0 {
+			return nil, fmt.Errorf("step %s: weight must be greater than 0", step.Name)
+		}
+		if step.Needs == "" {
+			step.Needs = needs
+		}
+		if step.Needs != "" && step.Needs != entityOrg && step.Needs != entityUser {
+			return nil, fmt.Errorf("step %s: unknown dependency %q", step.Name, step.Needs)
+		}
+	}
+	return &sc, nil
+}
+
+// User known to a scenario, either seeded from a manifest or created by a step
+type poolUser struct {
+	id       string
+	name     string
+	orgID    string
+	email    string
+	password string
+}
+
+// Entities available to the steps of a running scenario
+type entityPool struct {
+	mu    sync.Mutex
+	orgs  []string
+	users []poolUser
+}
+
+func (p *entityPool) addOrg(id string) {
+	p.mu.Lock()
+	p.orgs = append(p.orgs, id)
+	p.mu.Unlock()
+}
+
+func (p *entityPool) addUser(u poolUser) {
+	p.mu.Lock()
+	p.users = append(p.users, u)
+	p.mu.Unlock()
+}
+
+// Report whether the pool holds at least one entity of the given type
+func (p *entityPool) has(entity string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch entity {
+	case entityOrg:
+		return len(p.orgs) > 0
+	case entityUser:
+		return len(p.users) > 0
+	}
+	return true
+}
+
+func (p *entityPool) randomOrg(rng *rand.Rand) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.orgs) == 0 {
+		return "", false
+	}
+	return p.orgs[rng.Intn(len(p.orgs))], true
+}
+
+func (p *entityPool) randomUser(rng *rand.Rand) (poolUser, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.users) == 0 {
+		return poolUser{}, false
+	}
+	return p.users[rng.Intn(len(p.users))], true
+}
+
+// Remove a random user from the pool so no other step uses it afterwards
+func (p *entityPool) takeUser(rng *rand.Rand) (poolUser, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.users) == 0 {
+		return poolUser{}, false
+	}
+	i := rng.Intn(len(p.users))
+	u := p.users[i]
+	p.users[i] = p.users[len(p.users)-1]
+	p.users = p.users[:len(p.users)-1]
+	return u, true
+}
+
+// Function to log a user in by creating a session with a password check
+func loginUser(ctx context.Context, loginName, password string) error {
+	_, err := api.CreateSession(ctx, zitadel.CreateSessionRequest{
+		Checks: zitadel.SessionChecks{
+			User:     &zitadel.CheckUser{LoginName: loginName},
+			Password: &zitadel.CheckPassword{Password: password},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create session for %s: %w", loginName, err)
+	}
+	return nil
+}
+
+// Function to update the profile of a human user
+func updateUser(ctx context.Context, userId, givenName, familyName string) error {
+	err := api.UpdateHumanUser(ctx, userId, zitadel.UpdateHumanUserRequest{
+		Profile: &zitadel.Profile{GivenName: givenName, FamilyName: familyName},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user %s: %w", userId, err)
+	}
+	return nil
+}
+
+// Function to delete a user
+func deleteUser(ctx context.Context, userId string) error {
+	if err := api.DeleteUser(ctx, userId); err != nil {
+		return fmt.Errorf("failed to delete user %s: %w", userId, err)
+	}
+	return nil
+}
+
+// Executes the steps of a scenario and keeps their statistics
+type scenarioRunner struct {
+	sc      *Scenario
+	pool    *entityPool
+	stats   map[string]*latencyStats
+	counter int64 // Sequence used to name created entities
+	done    int64 // Number of steps executed so far
+}
+
+// Execute one step with the worker's random source
+func (r *scenarioRunner) execute(ctx context.Context, step Step, rng *rand.Rand) error {
+	n := atomic.AddInt64(&r.counter, 1)
+
+	switch step.Action {
+	case "create_org":
+		name := entityName(entityOrg, entityPath(r.sc.Name, entityOrg, int(n)))
+		id, err := createOrganization(ctx, name)
+		if err != nil {
+			return err
+		}
+		r.pool.addOrg(id)
+		entry := manifestEntry{Type: entityOrg, ID: id, Name: name}
+		manifest.record(entry)
+		lag.track(entry)
+
+	case "create_user":
+		orgID, ok := r.pool.randomOrg(rng)
+		if !ok {
+			return fmt.Errorf("no organization available")
+		}
+		name := entityName(entityUser, entityPath(r.sc.Name, entityUser, int(n)))
+		id := newIdentity(name)
+		u := poolUser{id: name, name: name, orgID: orgID, email: id.Email, password: id.Password}
+		if err := createUser(ctx, u.id, u.name, id, orgID); err != nil {
+			return err
+		}
+		r.pool.addUser(u)
+		entry := manifestEntry{Type: entityUser, ID: u.id, Name: u.name, OrgID: orgID, Email: u.email}
+		manifest.record(entry)
+		lag.track(entry)
+
+	case "login":
+		u, ok := r.pool.randomUser(rng)
+		if !ok {
+			return fmt.Errorf("no user available")
+		}
+		return loginUser(ctx, u.name, u.password)
+
+	case "search":
+		u, ok := r.pool.randomUser(rng)
+		if !ok {
+			return fmt.Errorf("no user available")
+		}
+		_, _, err := searchUsersPage(ctx, searchQuery{api: "v2", filter: "username-prefix", pageSize: 50, value: usernamePrefix(u.name)}, 0)
+		return err
+
+	case "update_user":
+		u, ok := r.pool.randomUser(rng)
+		if !ok {
+			return fmt.Errorf("no user available")
+		}
+		return updateUser(ctx, u.id, fmt.Sprintf("Given%d", n), fmt.Sprintf("Family%d", n))
+
+	case "delete_user":
+		u, ok := r.pool.takeUser(rng)
+		if !ok {
+			return fmt.Errorf("no user available")
+		}
+		return deleteUser(ctx, u.id)
+	}
+	return nil
+}
+
+// Pick a step at random according to the weights, among the steps whose
+// dependencies are currently available
+func (r *scenarioRunner) pick(rng *rand.Rand) (Step, bool) {
+	total := 0
+	eligible := make([]Step, 0, len(r.sc.Steps))
+	for _, step := range r.sc.Steps {
+		if step.Needs == "" || r.pool.has(step.Needs) {
+			eligible = append(eligible, step)
+			total += step.Weight
+		}
+	}
+	if total == 0 {
+		return Step{}, false
+	}
+
+	n := rng.Intn(total)
+	for _, step := range eligible {
+		if n < step.Weight {
+			return step, true
+		}
+		n -= step.Weight
+	}
+	return Step{}, false
+}
+
+// Worker loop: pick, execute and think until the scenario is over or ctx is done
+func (r *scenarioRunner) work(ctx context.Context, id int, deadline time.Time) {
+	rng := rand.New(rand.NewSource(r.sc.Seed + int64(id)))
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		if r.sc.Duration > 0 && time.Now().After(deadline) {
+			return
+		}
+
+		step, ok := r.pick(rng)
+		if !ok {
+			// Nothing can run until another worker creates what the steps need;
+			// waiting does not count as an iteration
+			sleepContext(ctx, 100*time.Millisecond)
+			continue
+		}
+		if r.sc.Iterations > 0 && atomic.AddInt64(&r.done, 1) > int64(r.sc.Iterations) {
+			return
+		}
+
+		// Stop this worker once the breaker has aborted the run, and keep to
+		// the configured request rate
+		if breaker.wait(ctx) != nil || limiter.wait(ctx) != nil {
+			return
+		}
+
+		reqCtx, cancel := requestContext()
+		reqCtx = withTraceLabel(reqCtx, step.Name)
+		reqCtx = withLogFields(reqCtx, logFields{op: step.Name, attempt: 1, sampled: sampleEntity()})
+		start := time.Now()
+		err := r.execute(reqCtx, step, rng)
+		duration := time.Since(start)
+		cancel()
+		breaker.record(ctx, err != nil && isRetryable(classifyError(err)))
+		if err != nil {
+			class := classifyError(err)
+			logFailure(reqCtx, slog.LevelWarn, err, class, "not retried", slog.Duration("latency", duration))
+			r.stats[step.Name].fail(class)
+		} else {
+			slog.LogAttrs(reqCtx, slog.LevelInfo, "request succeeded", slog.Duration("latency", duration))
+			r.stats[step.Name].record(duration)
+		}
+
+		if step.Think > 0 {
+			sleepContext(ctx, step.Think)
+		}
+	}
+}
+
+// Load a scenario file and the manifest seeding its pools. The seed is read
+// before the run opens its own manifest, which must be another file since
+// opening it empties it.
+func prepareScenario(path, outputManifest string) (*Scenario, []manifestEntry, error) {
+	sc, err := loadScenario(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading scenario %s: %v", path, err)
+	}
+	if sc.Manifest == "" {
+		return sc, nil, nil
+	}
+	if sameFile(sc.Manifest, outputManifest) {
+		return nil, nil, fmt.Errorf("scenario manifest %s is also the manifest written by this run and would be emptied before it is read; pass another -manifest", sc.Manifest)
+	}
+	seed, err := readManifest(sc.Manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading scenario manifest: %v", err)
+	}
+	return sc, seed, nil
+}
+
+// Whether two paths name the same file, including files that do not exist yet
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// Run a scenario seeded with the entities of a previous run and report
+// per-step latencies and the achieved mix
+func runScenario(ctx context.Context, sc *Scenario, seed []manifestEntry) {
+	fmt.Printf("Running scenario %s with %d workers (seed %d)...\n", sc.Name, sc.Workers, sc.Seed)
+	log.Printf("Running scenario %s with %d workers (seed %d)", sc.Name, sc.Workers, sc.Seed)
+
+	r := &scenarioRunner{sc: sc, pool: &entityPool{}, stats: make(map[string]*latencyStats)}
+	for _, step := range sc.Steps {
+		r.stats[step.Name] = newLatencyStats(step.Name)
+	}
+
+	// Seed the pools with entities of a previous run
+	for _, entry := range seed {
+		switch entry.Type {
+		case entityOrg:
+			r.pool.addOrg(entry.ID)
+		case entityUser:
+			// Passwords are regenerated from the name, with the seed of the run that created the user
+			r.pool.addUser(poolUser{id: entry.ID, name: entry.Name, orgID: entry.OrgID, email: entry.Email, password: newIdentity(entry.Name).Password})
+		}
+	}
+
+	start := time.Now()
+	deadline := start.Add(sc.Duration)
+	var wg sync.WaitGroup
+	for i := 0; i < sc.Workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			r.work(ctx, id, deadline)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	r.report(elapsed)
+	breaker.report()
+	reportHTTPTrace()
+	reportStopped(ctx.Err(), "Scenario", 0)
+}
+
+// Print the statistics of every step and compare the achieved mix with the weights
+func (r *scenarioRunner) report(elapsed time.Duration) {
+	totalWeight, executed := 0, 0
+	counts := make(map[string]int)
+	for _, step := range r.sc.Steps {
+		totalWeight += step.Weight
+		sum := r.stats[step.Name].summary()
+		counts[step.Name] = sum.count + sum.failed
+		executed += counts[step.Name]
+	}
+
+	steps := append([]Step(nil), r.sc.Steps...)
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Weight > steps[j].Weight })
+
+	for _, step := range steps {
+		r.stats[step.Name].report(elapsed)
+	}
+
+	fmt.Printf("\nScenario %s: %d steps in %v\n", r.sc.Name, executed, elapsed)
+	log.Printf("Scenario %s: %d steps in %v", r.sc.Name, executed, elapsed)
+	for _, step := range steps {
+		var achieved float64
+		if executed > 0 {
+			achieved = 100 * float64(counts[step.Name]) / float64(executed)
+		}
+		line := fmt.Sprintf("%-20s target %5.1f%%  achieved %5.1f%%", step.Name, 100*float64(step.Weight)/float64(totalWeight), achieved)
+		fmt.Println(line)
+		log.Println(line)
+	}
+}
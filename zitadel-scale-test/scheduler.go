@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Concurrent workers per entity type overriding workerPoolSize, set with
+// -type-workers
+var typeWorkers = map[string]int{}
+
+// Entity types in the order they are created and reported
+var entityTypes = []string{entityOrg, entityProject, entityApp, entityUser}
+
+// Parse a -type-workers value such as "org=10,user=200"
+func setTypeWorkers(value string) error {
+	workers := map[string]int{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kind, count, ok := strings.Cut(pair, "=")
+		kind = strings.TrimSpace(kind)
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if !ok || err != nil || n < 1 {
+			return fmt.Errorf("invalid entry %q, expected TYPE=N with N at least 1", pair)
+		}
+		if _, known := entityNoun[kind]; !known {
+			return fmt.Errorf("invalid entity type %q, choose 'org', 'project', 'app' or 'user'", kind)
+		}
+		workers[kind] = n
+	}
+	typeWorkers = workers
+	return nil
+}
+
+// Concurrent workers creating entities of a type
+func workersFor(kind string) int {
+	if n, ok := typeWorkers[kind]; ok {
+		return n
+	}
+	return workerPoolSize
+}
+
+// Plural of the entity types in reports
+var entityNoun = map[string]string{
+	entityOrg:     "Organizations",
+	entityProject: "Projects",
+	entityApp:     "Applications",
+	entityUser:    "Users",
+}
+
+// Creation of one entity in the DAG of the concurrent mode. A task only
+// becomes ready once its parent was created, and receives the parent's
+// manifest entry as input; organizations have no parent.
+type task struct {
+	op   string // Operation, e.g. "Create Project"
+	kind string // Entity type, selecting the concurrency limit
+	name string
+
+	// API call creating the entity, retried by the scheduler
+	create func(ctx context.Context, parent manifestEntry) (manifestEntry, error)
+	// Pass the tasks depending on the created entity to emit one by one, so
+	// that they are only generated as the queues take them; also called with
+	// a zero entry to count the subtree of a failed task
+	children func(created manifestEntry, emit func(*task))
+	// Called once with the final error of the API call, nil when it
+	// succeeded, e.g. to count outcomes per path; optional
+	done func(err error)
+
+	parent manifestEntry
+}
+
+// Ready tasks queued per worker of their entity type. Submitting to a full
+// queue blocks, so the tasks of a run are generated as fast as they are
+// created and memory does not grow with the run. Blocking cannot deadlock:
+// tasks are only submitted to the queues of child types, and applications
+// and users have none.
+const queuePerWorker = 2
+
+// Runs the tasks of the DAG with a fixed number of workers per entity type,
+// and records, counts and reports their outcome
+type scheduler struct {
+	ctx     context.Context
+	queues  map[string]chan *task
+	pending sync.WaitGroup // Tasks submitted but not yet finished
+	workers sync.WaitGroup
+
+	mu      sync.Mutex
+	created creationTotals
+	skipped map[string]int // Tasks not attempted because an ancestor failed, per entity type
+}
+
+// Start the workers of every entity type
+func newScheduler(ctx context.Context) *scheduler {
+	s := &scheduler{ctx: ctx, queues: map[string]chan *task{}, skipped: map[string]int{}}
+	for _, kind := range entityTypes {
+		queue := make(chan *task, workersFor(kind)*queuePerWorker)
+		s.queues[kind] = queue
+		for w := 0; w < workersFor(kind); w++ {
+			s.workers.Add(1)
+			go func() {
+				defer s.workers.Done()
+				for t := range queue {
+					s.run(t)
+				}
+			}()
+		}
+	}
+	return s
+}
+
+// Queue a ready task, waiting while the queue of its type is full
+func (s *scheduler) submit(t *task) {
+	s.pending.Add(1)
+	s.queues[t.kind] <- t
+}
+
+// Wait until every submitted task and its subtree finished, then stop the
+// workers. Once ctx is done the queued tasks return immediately, since every
+// API call checks the same context.
+func (s *scheduler) wait() {
+	s.pending.Wait()
+	for _, queue := range s.queues {
+		close(queue)
+	}
+	s.workers.Wait()
+}
+
+// Create the entity of a task and submit its children, or skip them when it
+// failed
+func (s *scheduler) run(t *task) {
+	defer s.pending.Done()
+
+	// Only the API call is retried; counting, recording and submitting the
+	// children happen once, after it succeeded
+	var entry manifestEntry
+	err := retryWithBackoff(s.ctx, t.op, t.name, func(reqCtx context.Context) (err error) {
+		entry, err = t.create(reqCtx, t.parent)
+		return err
+	})
+	if t.done != nil {
+		t.done(err)
+	}
+	if err != nil {
+		// Tasks stopped with the run are covered by its stop report
+		if stopping(s.ctx, err) {
+			return
+		}
+		slog.Error("creation failed", "op", t.op, "entity", t.name, "error", err)
+		dash.finished(t.op, false)
+		s.skipSubtree(t)
+		return
+	}
+
+	dash.finished(t.op, true)
+	s.mu.Lock()
+	countEntity(&s.created, entry.Type)
+	s.mu.Unlock()
+	manifest.record(entry)
+	lag.track(entry)
+
+	if t.children == nil {
+		return
+	}
+	t.children(entry, func(child *task) {
+		child.parent = entry
+		s.submit(child)
+	})
+}
+
+// Count the descendants of a failed task as skipped and take them off the
+// progress view
+func (s *scheduler) skipSubtree(t *task) {
+	counts := map[string]int{}
+	var walk func(t *task)
+	walk = func(t *task) {
+		if t.children == nil {
+			return
+		}
+		t.children(manifestEntry{}, func(child *task) {
+			counts[child.kind]++
+			dash.plan(child.op, -1)
+			walk(child)
+		})
+	}
+	walk(t)
+	if len(counts) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	attrs := []any{"op", t.op, "entity", t.name}
+	for _, kind := range entityTypes {
+		if counts[kind] > 0 {
+			s.skipped[kind] += counts[kind]
+			attrs = append(attrs, kind, counts[kind])
+		}
+	}
+	s.mu.Unlock()
+	slog.Warn("dependents skipped", attrs...)
+}
+
+// Totals of the run, with the entities skipped because an ancestor failed
+func (s *scheduler) totals() creationTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totals := s.created
+	totals.SkippedProjects = s.skipped[entityProject]
+	totals.SkippedApps = s.skipped[entityApp]
+	totals.SkippedUsers = s.skipped[entityUser]
+	return totals
+}
+
+// Print and log the entities skipped because their organization or project
+// failed
+func reportSkipped(totals creationTotals) {
+	for _, s := range []struct {
+		noun  string
+		count int
+	}{
+		{entityNoun[entityProject], totals.SkippedProjects},
+		{entityNoun[entityApp], totals.SkippedApps},
+		{entityNoun[entityUser], totals.SkippedUsers},
+	} {
+		if s.count > 0 {
+			line := fmt.Sprintf("Total %s Skipped: %d (parent creation failed)", s.noun, s.count)
+			fmt.Println(line)
+			log.Println(line)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Settings for the search benchmark
+var (
+	searchPageSizes   = []int{10, 50, 100} // Page sizes used to page through search results
+	searchMaxPages    = 10                 // Maximum number of pages fetched per query
+	searchRepeat      = 5                  // Number of times every query is executed
+	searchConcurrency = 10                 // Number of concurrent search queries
+	searchResultsFile = "search_results.csv"
+	searchTimeout     time.Duration // Deadline of the whole benchmark phase (0: no limit)
+)
+
+// Search filters exercised by the benchmark
+var searchFilters = []string{"username-prefix", "email", "org", "state"}
+
+// Search APIs exercised by the benchmark
+var searchAPIs = []string{"v2", "management"}
+
+// One paged search executed by the benchmark
+type searchQuery struct {
+	api      string
+	filter   string
+	pageSize int
+	orgID    string
+	value    string
+}
+
+// Name under which latencies of the query are aggregated
+func (q searchQuery) key() string {
+	return fmt.Sprintf("%s %s (page size %d)", q.api, q.filter, q.pageSize)
+}
+
+// Build the query criteria understood by both the v2 and management user search
+func (q searchQuery) criteria() []zitadel.UserQuery {
+	switch q.filter {
+	case "username-prefix":
+		return []zitadel.UserQuery{{UserNameQuery: &zitadel.UserNameQuery{UserName: q.value, Method: zitadel.TextQueryStartsWith}}}
+	case "email":
+		return []zitadel.UserQuery{{EmailQuery: &zitadel.EmailQuery{EmailAddress: q.value, Method: zitadel.TextQueryEquals}}}
+	case "org":
+		// Management searches are always scoped to the org given in the header
+		if q.api == "v2" {
+			return []zitadel.UserQuery{{OrganizationIDQuery: &zitadel.OrganizationIDQuery{OrganizationID: q.orgID}}}
+		}
+		return nil
+	case "state":
+		return []zitadel.UserQuery{{StateQuery: &zitadel.StateQuery{State: zitadel.UserStateActive}}}
+	}
+	return nil
+}
+
+// Function to fetch one page of users, returning the number of results and the total
+func searchUsersPage(ctx context.Context, q searchQuery, offset int) (int, int, error) {
+	req := zitadel.ListUsersRequest{
+		Query: zitadel.ListQuery{
+			Offset: strconv.Itoa(offset),
+			Limit:  q.pageSize,
+			Asc:    true,
+		},
+		SortingColumn: zitadel.UserFieldNameUserName,
+		Queries:       q.criteria(),
+	}
+
+	var resp *zitadel.ListUsersResponse
+	var err error
+	if q.api == "management" {
+		resp, err = api.SearchUsers(ctx, q.orgID, req)
+	} else {
+		resp, err = api.ListUsers(ctx, q.orgID, req)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("user search failed: %w", err)
+	}
+
+	total, _ := strconv.Atoi(resp.Details.TotalResult.String())
+	return len(resp.Result), total, nil
+}
+
+// Page through all results of a query, recording the latency of every page,
+// until ctx is done. Every page keeps to the request rate and holds while the
+// circuit breaker is open; a failed page ends the query and is counted under
+// its error class.
+func runSearchQuery(ctx context.Context, q searchQuery, stats *latencyStats) {
+	for page, offset := 0, 0; page < searchMaxPages && ctx.Err() == nil; page++ {
+		if breaker.wait(ctx) != nil || limiter.wait(ctx) != nil {
+			return
+		}
+		reqCtx, cancel := requestContext()
+		reqCtx = withTraceLabel(reqCtx, "User search")
+		reqCtx = withLogFields(reqCtx, logFields{op: "User search", entity: q.key(), attempt: 1, sampled: sampleEntity()})
+		start := time.Now()
+		n, total, err := searchUsersPage(reqCtx, q, offset)
+		cancel()
+		class := classifyError(err)
+		breaker.record(ctx, err != nil && isRetryable(class))
+		if err != nil {
+			logFailure(reqCtx, slog.LevelWarn, err, class, "not retried")
+			stats.fail(class)
+			return
+		}
+		stats.record(time.Since(start))
+
+		offset += n
+		if n == 0 || offset >= total {
+			return
+		}
+	}
+}
+
+// Return the part of a generated user name that is shared with its siblings,
+// e.g. "20240102-150405-org-1-user" for "20240102-150405-org-1-user-7"
+func usernamePrefix(name string) string {
+	if i := strings.LastIndex(name, "user"); i >= 0 {
+		return name[:i+len("user")]
+	}
+	return name[:len(name)/2]
+}
+
+// Build the benchmark queries from users picked at random in the manifest
+func buildSearchQueries(users []manifestEntry) []searchQuery {
+	var queries []searchQuery
+	for _, api := range searchAPIs {
+		for _, filter := range searchFilters {
+			for _, pageSize := range searchPageSizes {
+				for i := 0; i < searchRepeat; i++ {
+					user := users[rand.Intn(len(users))]
+					q := searchQuery{api: api, filter: filter, pageSize: pageSize, orgID: user.OrgID}
+					switch filter {
+					case "username-prefix":
+						q.value = usernamePrefix(user.Name)
+					case "email":
+						q.value = user.Email
+					}
+					queries = append(queries, q)
+				}
+			}
+		}
+	}
+	rand.Shuffle(len(queries), func(i, j int) { queries[i], queries[j] = queries[j], queries[i] })
+	return queries
+}
+
+// Run the user search benchmark against the users recorded in the manifest
+func runSearchBenchmark(ctx context.Context, manifestPath string) {
+	fmt.Println("Running user search benchmark...")
+
+	ctx, cancel := phaseContext(ctx, searchTimeout)
+	defer cancel()
+
+	entries, err := readManifest(manifestPath)
+	if err != nil {
+		log.Fatalf("Error reading manifest %s: %v", manifestPath, err)
+	}
+	var users []manifestEntry
+	for _, entry := range entries {
+		if entry.Type == entityUser {
+			users = append(users, entry)
+		}
+	}
+	if len(users) == 0 {
+		log.Fatalf("Manifest %s contains no users to search for", manifestPath)
+	}
+
+	// The total number of users in the instance is the x axis of the results
+	reqCtx, cancelReq := requestContext()
+	_, instanceUsers, err := searchUsersPage(reqCtx, searchQuery{api: "v2", pageSize: 1}, 0)
+	cancelReq()
+	if err != nil {
+		log.Printf("Error counting users in the instance: %v", err)
+	}
+	fmt.Printf("Users created by the run: %d, users in the instance: %d\n", len(users), instanceUsers)
+	log.Printf("Users created by the run: %d, users in the instance: %d", len(users), instanceUsers)
+
+	queries := buildSearchQueries(users)
+	stats := make(map[string]*latencyStats)
+	var keys []string
+	for _, q := range queries {
+		if _, ok := stats[q.key()]; !ok {
+			stats[q.key()] = newLatencyStats(q.key())
+			keys = append(keys, q.key())
+		}
+	}
+
+	jobs := make(chan searchQuery)
+	var wg sync.WaitGroup
+	for i := 0; i < searchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range jobs {
+				runSearchQuery(ctx, q, stats[q.key()])
+			}
+		}()
+	}
+
+	start := time.Now()
+dispatch:
+	for _, q := range queries {
+		select {
+		case jobs <- q:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for _, key := range keys {
+		stats[key].report(elapsed)
+	}
+	reportHTTPTrace()
+	reportStopped(ctx.Err(), "Search benchmark", searchTimeout)
+
+	if err := appendSearchResults(len(users), instanceUsers, keys, stats); err != nil {
+		log.Printf("Error writing search results: %v", err)
+	}
+}
+
+// Append the percentiles of this run to the results CSV so that runs against
+// growing populations can be compared
+func appendSearchResults(runUsers, instanceUsers int, keys []string, stats map[string]*latencyStats) error {
+	_, statErr := os.Stat(searchResultsFile)
+	file, err := os.OpenFile(searchResultsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if os.IsNotExist(statErr) {
+		w.Write([]string{"timestamp", "run_users", "instance_users", "query", "requests", "failed", "p50_ms", "p95_ms", "p99_ms"})
+	}
+	now := time.Now().Format(time.RFC3339)
+	for _, key := range keys {
+		sum := stats[key].summary()
+		w.Write([]string{
+			now, strconv.Itoa(runUsers), strconv.Itoa(instanceUsers), key,
+			strconv.Itoa(sum.count), strconv.Itoa(sum.failed),
+			fmt.Sprintf("%.3f", sum.p50.Seconds()*1000),
+			fmt.Sprintf("%.3f", sum.p95.Seconds()*1000),
+			fmt.Sprintf("%.3f", sum.p99.Seconds()*1000),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Timeout of a single API request, including reading the response
+var requestTimeout = 30 * time.Second
+
+// Canceled by the second SIGINT/SIGTERM. Every API request is derived from it,
+// so requests in flight when the first signal arrives are allowed to finish.
+var abortCtx = context.Background()
+
+// Install the signal handler and return the context that stops dispatching
+// new work. The first SIGINT/SIGTERM cancels it and lets in-flight requests
+// drain, the second one cancels the in-flight requests as well.
+func handleShutdown() context.Context {
+	abort, cancelAbort := context.WithCancel(context.Background())
+	dispatch, cancelDispatch := context.WithCancel(abort)
+	abortCtx = abort
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		consolef("\nReceived %v, finishing in-flight requests (send again to cancel them)...\n", sig)
+		log.Printf("Received %v, no new work is started", sig)
+		cancelDispatch()
+
+		sig = <-signals
+		consolef("\nReceived %v again, canceling in-flight requests...\n", sig)
+		log.Printf("Received %v again, canceling in-flight requests", sig)
+		cancelAbort()
+	}()
+	return dispatch
+}
+
+// Context for a single API request: canceled by its timeout or a second signal
+func requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(abortCtx, requestTimeout)
+}
+
+// Sleep for d, returning early when ctx is done
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// Context of a phase, canceled after timeout (no limit when zero)
+func phaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Report whether err means that the run is stopping, by interrupt, deadline or
+// circuit breaker, rather than that the API call itself failed
+func stopping(ctx context.Context, err error) bool {
+	return err != nil && (errors.Is(err, errCircuitOpen) || ctx.Err() != nil)
+}
+
+// Print and log why a phase stopped before finishing its work; stopped is the
+// error of the phase context, nil when the phase ran to its end
+func reportStopped(stopped error, phase string, timeout time.Duration) {
+	var line string
+	switch stopped {
+	case context.Canceled:
+		line = fmt.Sprintf("%s interrupted: the totals above only cover the work completed before", phase)
+	case context.DeadlineExceeded:
+		line = fmt.Sprintf("%s stopped after its deadline of %v: the totals above only cover the work completed before", phase, timeout)
+	default:
+		return
+	}
+	fmt.Println(line)
+	log.Println(line)
+}
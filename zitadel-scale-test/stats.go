@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latencies are counted in buckets instead of being stored, so that the
+// memory of the statistics does not grow with the run. Below
+// 2*histogramSubBuckets nanoseconds every bucket holds one value, above it
+// every power of two is split into histogramSubBuckets buckets, and a bucket
+// is reported as its midpoint, off by at most 1/(2*histogramSubBuckets) (0.8%).
+const histogramSubBuckets = 64
+
+// Bucket of a latency
+func histogramBucket(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	v := uint64(d)
+	if v < 2*histogramSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - bits.Len64(2*histogramSubBuckets-1) // Keeps the top bits of v in [histogramSubBuckets, 2*histogramSubBuckets)
+	return 2*histogramSubBuckets + (shift-1)*histogramSubBuckets + int(v>>shift) - histogramSubBuckets
+}
+
+// Midpoint of the latencies counted in a bucket
+func histogramValue(bucket int) time.Duration {
+	if bucket < 2*histogramSubBuckets {
+		return time.Duration(bucket)
+	}
+	shift := (bucket-2*histogramSubBuckets)/histogramSubBuckets + 1
+	top := uint64((bucket-2*histogramSubBuckets)%histogramSubBuckets + histogramSubBuckets)
+	return time.Duration(top<<shift + 1<<shift/2)
+}
+
+// Collects latencies and failure reasons for one benchmarked operation
+type latencyStats struct {
+	mu       sync.Mutex
+	name     string
+	count    int
+	total    time.Duration
+	max      time.Duration
+	buckets  map[int]int // Histogram bucket -> latencies counted in it
+	failures map[string]int
+	// Operations never sent, e.g. after an interrupt, per reason; they are
+	// not failures of the server and kept out of the failure totals
+	notAttempted map[string]int
+}
+
+func newLatencyStats(name string) *latencyStats {
+	return &latencyStats{name: name, buckets: make(map[int]int), failures: make(map[string]int), notAttempted: make(map[string]int)}
+}
+
+// Record the latency of a successful operation
+func (s *latencyStats) record(d time.Duration) {
+	s.mu.Lock()
+	s.count++
+	s.total += d
+	s.max = max(s.max, d)
+	s.buckets[histogramBucket(d)]++
+	s.mu.Unlock()
+}
+
+// Count a failed operation under the given reason
+func (s *latencyStats) fail(reason string) {
+	s.mu.Lock()
+	s.failures[reason]++
+	s.mu.Unlock()
+}
+
+// Count an operation that was given up before it was sent, under the given
+// reason
+func (s *latencyStats) skip(reason string) {
+	s.mu.Lock()
+	s.notAttempted[reason]++
+	s.mu.Unlock()
+}
+
+// Return the p-th percentile (0-100) of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p / 100)
+	return sorted[idx]
+}
+
+// Aggregated view of the collected latencies
+type latencySummary struct {
+	count                   int
+	failed                  int
+	notAttempted            int
+	avg, p50, p95, p99, max time.Duration
+}
+
+// Return the p-th percentile (0-100) of the histogram, picking the same rank
+// as percentile does on the sorted latencies; the caller holds mu
+func (s *latencyStats) histogramPercentile(buckets []int, p float64) time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	rank := int(float64(s.count-1) * p / 100)
+	seen := 0
+	for _, b := range buckets {
+		seen += s.buckets[b]
+		if seen > rank {
+			// The midpoint of the highest bucket may lie above the largest latency
+			return min(histogramValue(b), s.max)
+		}
+	}
+	return s.max
+}
+
+// Compute the current summary without resetting the collected latencies
+func (s *latencyStats) summary() latencySummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := make([]int, 0, len(s.buckets))
+	for b := range s.buckets {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+
+	sum := latencySummary{
+		count: s.count,
+		p50:   s.histogramPercentile(buckets, 50),
+		p95:   s.histogramPercentile(buckets, 95),
+		p99:   s.histogramPercentile(buckets, 99),
+		max:   s.max,
+	}
+	if s.count > 0 {
+		sum.avg = s.total / time.Duration(s.count)
+	}
+	for _, n := range s.failures {
+		sum.failed += n
+	}
+	for _, n := range s.notAttempted {
+		sum.notAttempted += n
+	}
+	return sum
+}
+
+// Print and log the summary for this operation; elapsed is the wall time of the phase
+func (s *latencyStats) report(elapsed time.Duration) {
+	sum := s.summary()
+	var throughput float64
+	if elapsed > 0 {
+		throughput = float64(sum.count) / elapsed.Seconds()
+	}
+
+	outcome := fmt.Sprintf("%d succeeded, %d failed", sum.count, sum.failed)
+	if sum.notAttempted > 0 {
+		outcome += fmt.Sprintf(", %d not attempted", sum.notAttempted)
+	}
+	lines := []string{
+		fmt.Sprintf("%s: %s in %v (%.2f/s)", s.name, outcome, elapsed, throughput),
+		fmt.Sprintf("%s latency: avg %v, p50 %v, p95 %v, p99 %v, max %v", s.name, sum.avg, sum.p50, sum.p95, sum.p99, sum.max),
+	}
+
+	s.mu.Lock()
+	for _, counts := range []struct {
+		label   string
+		reasons map[string]int
+	}{{"failure", s.failures}, {"not attempted", s.notAttempted}} {
+		reasons := make([]string, 0, len(counts.reasons))
+		for reason := range counts.reasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool { return counts.reasons[reasons[i]] > counts.reasons[reasons[j]] })
+		for _, reason := range reasons {
+			lines = append(lines, fmt.Sprintf("%s %s: %s (x%d)", s.name, counts.label, reason, counts.reasons[reason]))
+		}
+	}
+	s.mu.Unlock()
+
+	for _, line := range lines {
+		fmt.Println(line)
+		log.Println(line)
+	}
+}
+
+// Per-operation statistics of the current run, in registration order
+var (
+	opStatsMu sync.Mutex
+	opStats   = make(map[string]*latencyStats)
+	opOrder   []string
+)
+
+// Return the statistics of an operation, registering it on first use
+func statsFor(op string) *latencyStats {
+	opStatsMu.Lock()
+	defer opStatsMu.Unlock()
+	stats, ok := opStats[op]
+	if !ok {
+		stats = newLatencyStats(op)
+		opStats[op] = stats
+		opOrder = append(opOrder, op)
+	}
+	return stats
+}
+
+// Print and log the statistics of every operation of the run
+func reportOpStats(elapsed time.Duration) {
+	opStatsMu.Lock()
+	order := append([]string(nil), opOrder...)
+	opStatsMu.Unlock()
+
+	for _, op := range order {
+		statsFor(op).report(elapsed)
+	}
+}
+
+// Histogram, failures and operations not attempted, as sent from an agent to
+// the coordinator
+type statsSnapshot struct {
+	Name     string         `json:"name"`
+	Count    int            `json:"count"`
+	Total    time.Duration  `json:"total"`
+	Max      time.Duration  `json:"max"`
+	Buckets  map[int]int    `json:"buckets"`
+	Failures map[string]int `json:"failures"`
+
+	NotAttempted map[string]int `json:"not_attempted,omitempty"`
+}
+
+func (s *latencyStats) snapshot() statsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buckets := make(map[int]int, len(s.buckets))
+	for b, n := range s.buckets {
+		buckets[b] = n
+	}
+	failures := make(map[string]int, len(s.failures))
+	for reason, n := range s.failures {
+		failures[reason] = n
+	}
+	notAttempted := make(map[string]int, len(s.notAttempted))
+	for reason, n := range s.notAttempted {
+		notAttempted[reason] = n
+	}
+	return statsSnapshot{Name: s.name, Count: s.count, Total: s.total, Max: s.max, Buckets: buckets, Failures: failures, NotAttempted: notAttempted}
+}
+
+// Add the histogram, failures and operations not attempted of a snapshot to
+// these statistics
+func (s *latencyStats) merge(snap statsSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count += snap.Count
+	s.total += snap.Total
+	s.max = max(s.max, snap.Max)
+	for b, n := range snap.Buckets {
+		s.buckets[b] += n
+	}
+	for reason, n := range snap.Failures {
+		s.failures[reason] += n
+	}
+	for reason, n := range snap.NotAttempted {
+		s.notAttempted[reason] += n
+	}
+}
+
+// Snapshot the statistics of every operation of the run, in registration order
+func snapshotOpStats() []statsSnapshot {
+	opStatsMu.Lock()
+	order := append([]string(nil), opOrder...)
+	opStatsMu.Unlock()
+
+	snaps := make([]statsSnapshot, 0, len(order))
+	for _, op := range order {
+		snaps = append(snaps, statsFor(op).snapshot())
+	}
+	return snaps
+}
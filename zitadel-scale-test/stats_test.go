@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Latencies of 1ms to 100ms, one each
+func rampStats(name string) *latencyStats {
+	s := newLatencyStats(name)
+	for i := 1; i <= 100; i++ {
+		s.record(time.Duration(i) * time.Millisecond)
+	}
+	return s
+}
+
+// Report whether got is within the histogram's error of want
+func closeTo(got, want time.Duration) bool {
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= want/(2*histogramSubBuckets)
+}
+
+func TestLatencyStatsSummary(t *testing.T) {
+	s := rampStats("op")
+	s.fail("5xx (gave up)")
+	s.fail("5xx (gave up)")
+	s.fail("4xx (not retried)")
+	s.skip(errorCanceled)
+
+	sum := s.summary()
+	if sum.count != 100 || sum.failed != 3 || sum.notAttempted != 1 {
+		t.Errorf("got %d succeeded, %d failed, %d not attempted, want 100, 3, 1", sum.count, sum.failed, sum.notAttempted)
+	}
+	if sum.avg != 50500*time.Microsecond || sum.max != 100*time.Millisecond {
+		t.Errorf("got avg %v, max %v, want 50.5ms, 100ms", sum.avg, sum.max)
+	}
+	// Same ranks as percentile on the sorted latencies
+	for _, p := range []struct {
+		name      string
+		got, want time.Duration
+	}{{"p50", sum.p50, 50 * time.Millisecond}, {"p95", sum.p95, 95 * time.Millisecond}, {"p99", sum.p99, 99 * time.Millisecond}} {
+		if !closeTo(p.got, p.want) {
+			t.Errorf("%s is %v, want %v", p.name, p.got, p.want)
+		}
+	}
+}
+
+func TestLatencyStatsEmpty(t *testing.T) {
+	sum := newLatencyStats("op").summary()
+	if sum != (latencySummary{}) {
+		t.Errorf("got %+v, want a zero summary", sum)
+	}
+}
+
+func TestStatsSnapshotMerge(t *testing.T) {
+	// Two agents, each with half of the latencies and failures
+	first, second := newLatencyStats("op"), newLatencyStats("op")
+	for i := 1; i <= 100; i++ {
+		s := first
+		if i%2 == 0 {
+			s = second
+		}
+		s.record(time.Duration(i) * time.Millisecond)
+	}
+	first.fail("timeout (retried)")
+	second.fail("timeout (retried)")
+	second.skip("circuit open")
+
+	merged := newLatencyStats("op")
+	merged.merge(first.snapshot())
+	merged.merge(second.snapshot())
+
+	if got, want := merged.summary(), rampStats("op").summary(); got.count != want.count || got.avg != want.avg ||
+		got.p50 != want.p50 || got.p95 != want.p95 || got.p99 != want.p99 || got.max != want.max {
+		t.Errorf("merged summary %+v, want %+v", got, want)
+	}
+	snap := merged.snapshot()
+	if snap.Failures["timeout (retried)"] != 2 || snap.NotAttempted["circuit open"] != 1 {
+		t.Errorf("merged failures %v and not attempted %v", snap.Failures, snap.NotAttempted)
+	}
+}
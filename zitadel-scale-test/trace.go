@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Settings of the HTTP transport used by the REST client
+var (
+	maxIdleConns        = 100                             // Idle connections kept across all hosts (0: no limit)
+	maxIdleConnsPerHost = http.DefaultMaxIdleConnsPerHost // Idle connections kept per host
+	idleConnTimeout     = 90 * time.Second                // Time an idle connection is kept open
+	enableHTTP2         = true                            // Negotiate HTTP/2 with TLS servers
+	keepAlive           = true                            // Reuse connections between requests
+)
+
+// Phases of an HTTP request, in the order they happen
+var httpPhases = []string{"dns", "connect", "tls", "server", "ttfb", "body"}
+
+// Build the transport of the REST client from the settings above, instrumented
+// with the phase timing of every request
+func newHTTPTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = maxIdleConns
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	t.IdleConnTimeout = idleConnTimeout
+	t.DisableKeepAlives = !keepAlive
+	if !enableHTTP2 {
+		// A non-nil empty map disables the HTTP/2 upgrade
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return &tracingTransport{base: t}
+}
+
+type traceLabelKey struct{}
+
+// Attach the label under which the phases of the requests made with ctx are
+// aggregated, e.g. the operation being benchmarked
+func withTraceLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, traceLabelKey{}, label)
+}
+
+func traceLabel(ctx context.Context) string {
+	if label, ok := ctx.Value(traceLabelKey{}).(string); ok {
+		return label
+	}
+	return "Other requests"
+}
+
+// Transport timing the phases of every request with httptrace
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := &requestTrace{label: traceLabel(req.Context()), start: time.Now()}
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), tr.clientTrace())))
+	if err != nil {
+		tr.finish(0)
+		return nil, err
+	}
+	resp.Body = &tracedBody{ReadCloser: resp.Body, trace: tr, start: time.Now()}
+	return resp, nil
+}
+
+// Phase timestamps of one request; the httptrace hooks may run on other goroutines
+type requestTrace struct {
+	label string
+	start time.Time
+
+	mu                                 sync.Mutex
+	dnsStart, connectStart, tlsStart   time.Time
+	wroteRequest, firstByte            time.Time
+	dns, connect, tls                  time.Duration
+	gotConn, reused, wasIdle, finished bool
+}
+
+func (tr *requestTrace) clientTrace() *httptrace.ClientTrace {
+	lock := func(f func()) {
+		tr.mu.Lock()
+		f()
+		tr.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { lock(func() { tr.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { lock(func() { tr.dns = time.Since(tr.dnsStart) }) },
+		ConnectStart: func(string, string) {
+			lock(func() {
+				// Dialing may race several addresses; time from the first attempt
+				if tr.connectStart.IsZero() {
+					tr.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			lock(func() {
+				if err == nil {
+					tr.connect = time.Since(tr.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() { lock(func() { tr.tlsStart = time.Now() }) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { lock(func() { tr.tls = time.Since(tr.tlsStart) }) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			lock(func() { tr.gotConn, tr.reused, tr.wasIdle = true, info.Reused, info.WasIdle })
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { lock(func() { tr.wroteRequest = time.Now() }) },
+		GotFirstResponseByte: func() { lock(func() { tr.firstByte = time.Now() }) },
+	}
+}
+
+// Record the phases once the body has been read (body is the time it took)
+func (tr *requestTrace) finish(body time.Duration) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.finished {
+		return
+	}
+	tr.finished = true
+
+	phases := make(map[string]time.Duration)
+	if !tr.dnsStart.IsZero() {
+		phases["dns"] = tr.dns
+	}
+	if !tr.connectStart.IsZero() {
+		phases["connect"] = tr.connect
+	}
+	if !tr.tlsStart.IsZero() {
+		phases["tls"] = tr.tls
+	}
+	if !tr.firstByte.IsZero() {
+		phases["ttfb"] = tr.firstByte.Sub(tr.start)
+		if !tr.wroteRequest.IsZero() {
+			phases["server"] = tr.firstByte.Sub(tr.wroteRequest)
+		}
+		phases["body"] = body
+	}
+	recordTrace(tr.label, tr.gotConn, tr.reused, tr.wasIdle, phases)
+}
+
+// Response body recording the body phase when it is fully read or closed
+type tracedBody struct {
+	io.ReadCloser
+	trace *requestTrace
+	start time.Time
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.trace.finish(time.Since(b.start))
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	b.trace.finish(time.Since(b.start))
+	return b.ReadCloser.Close()
+}
+
+// Phase timings and connection reuse of the requests with one label
+type traceStats struct {
+	requests int // Requests that obtained a connection
+	reused   int // ... on a connection used before
+	idle     int // ... taken from the idle pool
+	phases   map[string]*latencyStats
+}
+
+// Trace statistics since the last report, by label in first-use order
+var (
+	traceMu    sync.Mutex
+	traces     = make(map[string]*traceStats)
+	traceOrder []string
+)
+
+func recordTrace(label string, gotConn, reused, wasIdle bool, phases map[string]time.Duration) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	s, ok := traces[label]
+	if !ok {
+		s = &traceStats{phases: make(map[string]*latencyStats)}
+		for _, phase := range httpPhases {
+			s.phases[phase] = newLatencyStats(phase)
+		}
+		traces[label] = s
+		traceOrder = append(traceOrder, label)
+	}
+	if gotConn {
+		s.requests++
+		if reused {
+			s.reused++
+		}
+		if wasIdle {
+			s.idle++
+		}
+	}
+	for phase, d := range phases {
+		s.phases[phase].record(d)
+	}
+}
+
+// Print and log the phase timings and connection reuse of the requests made
+// since the last report, then start over. Phases that did not happen in a
+// request, e.g. connect on a reused connection, are not counted for it.
+func reportHTTPTrace() {
+	traceMu.Lock()
+	order, byLabel := traceOrder, traces
+	traces, traceOrder = make(map[string]*traceStats), nil
+	traceMu.Unlock()
+
+	var lines []string
+	var requests, reused int
+	for _, label := range order {
+		s := byLabel[label]
+		requests += s.requests
+		reused += s.reused
+		lines = append(lines, fmt.Sprintf("HTTP phases of %s: %d requests, %d on reused connections (%.1f%%), %d from the idle pool",
+			label, s.requests, s.reused, percentOf(s.reused, s.requests), s.idle))
+		for _, phase := range httpPhases {
+			sum := s.phases[phase].summary()
+			if sum.count == 0 {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("  %-7s (%d requests): avg %v, p50 %v, p95 %v, p99 %v, max %v", phase, sum.count, sum.avg, sum.p50, sum.p95, sum.p99, sum.max))
+		}
+	}
+	if requests == 0 {
+		return
+	}
+	lines = append(lines, fmt.Sprintf("HTTP connection reuse: %d of %d requests (%.1f%%), %d new connections", reused, requests, percentOf(reused, requests), requests-reused))
+
+	for _, line := range lines {
+		fmt.Println(line)
+		log.Println(line)
+	}
+}
+
+func percentOf(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zitadel-scale-test/zitadel"
+)
+
+// Settings of the verify phase
+var (
+	verifyConcurrency = 10          // Number of concurrent read-backs
+	verifyMaxPrinted  = 20          // Problems printed to the console; all of them are logged
+	verifyTimeout     time.Duration // Deadline of the verify phase (0: no limit)
+)
+
+// Outcomes of the check of one manifest entry
+const (
+	verifyOK         = "ok"
+	verifyMissing    = "missing"    // Not found on the server
+	verifyDuplicated = "duplicated" // Recorded or existing more than once
+	verifyMismatched = "mismatched" // Found, but with other fields than were sent
+	verifyFailed     = "failed"     // Could not be read back, e.g. after exhausting the retries
+)
+
+var verifyOutcomes = []string{verifyOK, verifyMissing, verifyDuplicated, verifyMismatched, verifyFailed}
+
+// Problem found with one entity
+type verifyProblem struct {
+	entry   manifestEntry
+	outcome string
+	detail  string
+}
+
+func (p verifyProblem) String() string {
+	return fmt.Sprintf("%s %s %s (ID %s): %s", p.outcome, p.entry.Type, p.entry.Name, p.entry.ID, p.detail)
+}
+
+// Read back every entity recorded in the manifest and check that it exists
+// exactly once with the fields the tool sent. User profiles are regenerated
+// from the username, so -seed must be the one of the run that created them.
+func runVerify(ctx context.Context, manifestPath string) {
+	fmt.Println("Verifying created entities...")
+
+	ctx, cancel := phaseContext(ctx, verifyTimeout)
+	defer cancel()
+
+	entries, err := readManifest(manifestPath)
+	if err != nil {
+		log.Fatalf("Error reading manifest %s: %v", manifestPath, err)
+	}
+
+	// An entity recorded more than once was counted more than once; it is
+	// read back only once
+	var unique []manifestEntry
+	recorded := make(map[string]int)
+	for _, entry := range entries {
+		key := entry.Type + "/" + entry.Name
+		if recorded[key] == 0 {
+			unique = append(unique, entry)
+		}
+		recorded[key]++
+	}
+
+	counts := make(map[string]map[string]int) // type -> outcome -> count
+	for _, kind := range []string{entityOrg, entityProject, entityApp, entityUser} {
+		counts[kind] = make(map[string]int)
+	}
+	var problems []verifyProblem
+	var mu sync.Mutex
+	jobs := make(chan manifestEntry)
+	var wg sync.WaitGroup
+	for i := 0; i < verifyConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				var outcome, detail string
+				err := retryWithBackoff(ctx, "Verify "+entry.Type, entry.Name, func(reqCtx context.Context) (err error) {
+					outcome, detail, err = verifyEntry(reqCtx, entry)
+					return err
+				})
+				if stopping(ctx, err) {
+					continue
+				}
+				if err != nil {
+					outcome, detail = verifyFailed, err.Error()
+				}
+				if n := recorded[entry.Type+"/"+entry.Name]; n > 1 {
+					if outcome == verifyOK {
+						outcome, detail = verifyDuplicated, ""
+					} else {
+						detail += "; "
+					}
+					detail += fmt.Sprintf("recorded %d times in the manifest", n)
+				}
+				mu.Lock()
+				counts[entry.Type][outcome]++
+				if outcome != verifyOK {
+					problems = append(problems, verifyProblem{entry, outcome, detail})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+dispatch:
+	for _, entry := range unique {
+		select {
+		case jobs <- entry:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Printf("\nVerified %d entities (%d manifest entries) in %v\n", len(unique), len(entries), elapsed)
+	log.Printf("Verified %d entities (%d manifest entries) in %v", len(unique), len(entries), elapsed)
+	for _, kind := range []string{entityOrg, entityProject, entityApp, entityUser} {
+		c := counts[kind]
+		if len(c) == 0 {
+			continue
+		}
+		parts := make([]string, 0, len(verifyOutcomes))
+		for _, outcome := range verifyOutcomes {
+			parts = append(parts, fmt.Sprintf("%d %s", c[outcome], outcome))
+		}
+		line := fmt.Sprintf("Verify %s: %s", kind, strings.Join(parts, ", "))
+		fmt.Println(line)
+		log.Println(line)
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].entry.Name < problems[j].entry.Name })
+	for i, p := range problems {
+		log.Printf("Verify problem: %s", p)
+		if i < verifyMaxPrinted {
+			fmt.Println(p)
+		}
+	}
+	if len(problems) > verifyMaxPrinted {
+		fmt.Printf("... and %d more problems, see the log\n", len(problems)-verifyMaxPrinted)
+	}
+	reportStopped(ctx.Err(), "Verify phase", verifyTimeout)
+}
+
+// Read back one entity; err is only set when the check could not be made
+func verifyEntry(ctx context.Context, entry manifestEntry) (outcome, detail string, err error) {
+	switch entry.Type {
+	case entityOrg:
+		resp, err := api.ListOrganizations(ctx, zitadel.SearchByName(entry.Name))
+		return verifyNamed(resp, err, entry)
+	case entityProject:
+		resp, err := api.SearchProjects(ctx, entry.OrgID, zitadel.SearchByName(entry.Name))
+		return verifyNamed(resp, err, entry)
+	case entityApp:
+		resp, err := api.SearchApps(ctx, entry.OrgID, entry.ProjectID, zitadel.SearchByName(entry.Name))
+		return verifyNamed(resp, err, entry)
+	case entityUser:
+		resp, err := api.GetUserByID(ctx, entry.ID)
+		if zitadel.IsNotFound(err) {
+			return verifyMissing, "user not found", nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return verifyUser(resp, entry)
+	}
+	return "", "", fmt.Errorf("unknown entity type %q", entry.Type)
+}
+
+// Check the result of a search by name within the entity's parent
+func verifyNamed(resp *zitadel.SearchResponse, err error, entry manifestEntry) (string, string, error) {
+	if zitadel.IsNotFound(err) {
+		return verifyMissing, "parent not found", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	var ids []string
+	for _, r := range resp.Result {
+		if r.Name == entry.Name {
+			ids = append(ids, r.ID)
+		}
+	}
+	switch {
+	case len(ids) == 0:
+		return verifyMissing, "no " + entry.Type + " with this name", nil
+	case len(ids) > 1:
+		return verifyDuplicated, fmt.Sprintf("%d entities with this name: %s", len(ids), strings.Join(ids, ", ")), nil
+	case ids[0] != entry.ID:
+		return verifyMismatched, fmt.Sprintf("id is %s", ids[0]), nil
+	}
+	return verifyOK, "", nil
+}
+
+// Compare a user with the request the tool sent for it; fields left out of
+// the request are compared with the value Zitadel fills in
+func verifyUser(resp *zitadel.GetUserByIDResponse, entry manifestEntry) (string, string, error) {
+	want := newIdentity(entry.Name)
+	var diffs []string
+	check := func(field, got, want string) {
+		if got != want {
+			diffs = append(diffs, fmt.Sprintf("%s is %q, sent %q", field, got, want))
+		}
+	}
+	check("username", resp.User.Username, entry.Name)
+	check("organization", resp.Details.ResourceOwner, entry.OrgID)
+	if resp.User.Human == nil {
+		diffs = append(diffs, "not a human user")
+	} else {
+		h := resp.User.Human
+		check("email", h.Email.Email, entry.Email)
+		check("phone", h.Phone.Phone, want.Phone)
+		check("given name", h.Profile.GivenName, want.GivenName)
+		check("family name", h.Profile.FamilyName, want.FamilyName)
+		check("nickname", h.Profile.NickName, want.NickName)
+		check("display name", h.Profile.DisplayName, defaultDisplayName(want.DisplayName, want.GivenName, want.FamilyName))
+		check("preferred language", h.Profile.PreferredLanguage, defaultLanguage(want.PreferredLanguage))
+		check("gender", genderOrUnspecified(h.Profile.Gender), genderOrUnspecified(want.Gender))
+	}
+	if len(diffs) > 0 {
+		return verifyMismatched, strings.Join(diffs, "; "), nil
+	}
+	return verifyOK, "", nil
+}
+
+// Reads return the enum's zero value for users created without a gender
+func genderOrUnspecified(gender string) string {
+	if gender == "" {
+		return "GENDER_UNSPECIFIED"
+	}
+	return gender
+}
@@ -0,0 +1,17 @@
+package zitadel
+
+import "context"
+
+// Calls of the admin API (/admin/v1), acting on the whole instance. They are
+// only available over REST: GRPCClient does not implement them.
+
+// Import organizations with their human users in one request. Entities that
+// cannot be imported are listed in the errors of the response, the request
+// itself only fails as a whole, e.g. on a timeout.
+func (c *Client) ImportData(ctx context.Context, req ImportDataRequest) (*ImportDataResponse, error) {
+	var resp ImportDataResponse
+	if err := c.do(ctx, "POST", "/admin/v1/import", "", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,106 @@
+// Package zitadel is a small typed client for the parts of the Zitadel REST
+// API (management v1 and v2) used by the scale tests. Every call goes through
+// one request pipeline that adds the bearer token and the organization header,
+// logs the response and reports its latency, and turns non-2xx responses into
+// an *APIError parsed from Zitadel's error body.
+package zitadel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Client of one Zitadel instance. The fields may be set after NewClient but
+// must not be changed once the client is in use.
+type Client struct {
+	BaseURL    string       // Instance URL, e.g. http://localhost:8080
+	HTTPClient *http.Client // Client used to send the requests
+
+	// Returns the bearer token of a request, giving up when ctx is done; nil
+	// sends no Authorization header
+	Token func(ctx context.Context) (string, error)
+	// Logs one debug line per response, with the body of error responses;
+	// nil disables logging
+	Logger *slog.Logger
+}
+
+// Create a client for the instance at baseURL; a nil httpClient uses http.DefaultClient
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{BaseURL: baseURL, HTTPClient: httpClient}
+}
+
+// Send a request with in as JSON body (none when nil) and decode the response
+// body into out (ignored when nil). orgID, when set, selects the organization
+// the request acts in.
+func (c *Client) do(ctx context.Context, method, path, orgID string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshalling %s %s request: %v", method, path, err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("creating %s %s request: %v", method, path, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if orgID != "" {
+		req.Header.Set("x-zitadel-orgid", orgID)
+	}
+	if c.Token != nil {
+		token, err := c.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("obtaining access token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending %s %s request: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	elapsed := time.Since(start)
+	if err != nil {
+		return fmt.Errorf("reading %s %s response body: %w", method, path, err)
+	}
+
+	attrs := []slog.Attr{slog.String("method", method), slog.String("path", path), slog.String("status", resp.Status), slog.Duration("latency", elapsed)}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		c.log(ctx, append(attrs, slog.String("body", string(data)))...)
+		return newAPIError(method, path, resp, data)
+	}
+	c.log(ctx, attrs...)
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %v", method, path, err)
+	}
+	return nil
+}
+
+func (c *Client) log(ctx context.Context, attrs ...slog.Attr) {
+	if c.Logger != nil {
+		c.Logger.LogAttrs(ctx, slog.LevelDebug, "response", attrs...)
+	}
+}
@@ -0,0 +1,88 @@
+package zitadel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// gRPC status codes Zitadel reports in the code field of its error body
+const (
+	CodeInvalidArgument   = 3
+	CodeNotFound          = 5
+	CodeAlreadyExists     = 6
+	CodePermissionDenied  = 7
+	CodeResourceExhausted = 8
+	CodeUnavailable       = 14
+	CodeUnauthenticated   = 16
+)
+
+// Error returned for a non-2xx response
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Code       int               // gRPC status code from the error body, 0 if the body had none
+	Message    string            // Message from the error body, e.g. "Errors.Org.AlreadyExists"
+	Details    []json.RawMessage // Details from the error body
+	RetryAfter time.Duration     // Zero when the response carried no Retry-After header
+	Body       string            // Raw response body
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s failed, status code: %d, response: %s", e.Method, e.Path, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("%s %s failed, status code: %d, code: %d, message: %s", e.Method, e.Path, e.StatusCode, e.Code, e.Message)
+}
+
+// Build an APIError from a response whose body has already been read
+func newAPIError(method, path string, resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Body:       string(body),
+	}
+	var errorBody struct {
+		Code    int               `json:"code"`
+		Message string            `json:"message"`
+		Details []json.RawMessage `json:"details"`
+	}
+	if json.Unmarshal(body, &errorBody) == nil {
+		e.Code, e.Message, e.Details = errorBody.Code, errorBody.Message, errorBody.Details
+	}
+	return e
+}
+
+// Parse a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Report whether err is an API error telling that the entity exists already
+func IsAlreadyExists(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusConflict || apiErr.Code == CodeAlreadyExists)
+}
+
+// Report whether err is an API error telling that the entity does not exist
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.Code == CodeNotFound)
+}
@@ -0,0 +1,121 @@
+package zitadel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Translation of the gRPC calls of GRPCClient into the REST requests
+// Zitadel's REST gateway maps them to, and of the REST responses back. This
+// lets a REST-only fake, such as the mock server of the scale test, answer
+// gRPC clients.
+
+// gRPC server answering the methods used by GRPCClient by translating every
+// call into a request to the REST handler rest, the reverse of Zitadel's REST
+// gateway. Serve it next to the REST handler on the same h2c port through its
+// ServeHTTP method.
+func NewGatewayServer(rest http.Handler) *grpc.Server {
+	return grpc.NewServer(
+		grpc.ForceServerCodec(wireCodec{}),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			return serveGatewayCall(rest, stream)
+		}))
+}
+
+// Answer one gRPC call with the response of the REST handler
+func serveGatewayCall(rest http.Handler, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	req, err := gatewayRequest(stream.Context(), method, stream.RecvMsg)
+	if err != nil {
+		return err
+	}
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		for _, key := range []string{"authorization", "x-zitadel-orgid"} {
+			if values := md.Get(key); len(values) > 0 {
+				req.Header.Set(key, values[0])
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	rest.ServeHTTP(rec, req)
+	resp := rec.Result()
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		stream.SetHeader(metadata.Pairs("retry-after", retryAfter))
+	}
+	out, err := gatewayResponse(method, req, resp, rec.Body.Bytes())
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(out)
+}
+
+// Build the REST request of a gRPC call to method; recv decodes the request
+// message of the call. Unknown methods fail with codes.Unimplemented.
+func gatewayRequest(ctx context.Context, method string, recv func(msg interface{}) error) (*http.Request, error) {
+	route, ok := grpcRoutes[method]
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	msg := route.newRequest()
+	if err := recv(msg); err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if route.hasBody {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encoding REST request: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, route.httpMethod, route.path(msg), body)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "creating REST request: %v", err)
+	}
+	if route.hasBody {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// Convert the REST response to a request built by gatewayRequest into the
+// response message of method, or into the gRPC status error Zitadel answers
+// instead
+func gatewayResponse(method string, req *http.Request, resp *http.Response, body []byte) (interface{}, error) {
+	route, ok := grpcRoutes[method]
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := newAPIError(req.Method, req.URL.Path, resp, body)
+		code := codes.Code(apiErr.Code)
+		if apiErr.Code == 0 {
+			code = codeFromHTTPStatus(resp.StatusCode)
+		}
+		message := apiErr.Message
+		if message == "" {
+			message = strings.TrimSpace(apiErr.Body)
+		}
+		return nil, status.Error(code, message)
+	}
+
+	out := route.newResponse()
+	if err := json.Unmarshal(body, out); err != nil {
+		return nil, status.Errorf(codes.Internal, "decoding REST response: %v", err)
+	}
+	return out, nil
+}
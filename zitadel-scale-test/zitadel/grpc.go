@@ -0,0 +1,460 @@
+package zitadel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Calls shared by the REST and the gRPC client, so that the same workload can
+// run over either transport
+type API interface {
+	AddOrganization(ctx context.Context, req AddOrganizationRequest) (*AddOrganizationResponse, error)
+	AddProject(ctx context.Context, orgID string, req AddProjectRequest) (*AddProjectResponse, error)
+	SearchProjects(ctx context.Context, orgID string, req SearchRequest) (*SearchResponse, error)
+	AddAPIApp(ctx context.Context, orgID, projectID string, req AddAPIAppRequest) (*AddAPIAppResponse, error)
+	SearchApps(ctx context.Context, orgID, projectID string, req SearchRequest) (*SearchResponse, error)
+	SearchUsers(ctx context.Context, orgID string, req ListUsersRequest) (*ListUsersResponse, error)
+	ListOrganizations(ctx context.Context, req SearchRequest) (*SearchResponse, error)
+	AddHumanUser(ctx context.Context, req AddHumanUserRequest) (*AddHumanUserResponse, error)
+	GetUserByID(ctx context.Context, userID string) (*GetUserByIDResponse, error)
+	UpdateHumanUser(ctx context.Context, userID string, req UpdateHumanUserRequest) error
+	DeleteUser(ctx context.Context, userID string) error
+	ListUsers(ctx context.Context, orgID string, req ListUsersRequest) (*ListUsersResponse, error)
+	CreateSession(ctx context.Context, req CreateSessionRequest) (*CreateSessionResponse, error)
+}
+
+var (
+	_ API = (*Client)(nil)
+	_ API = (*GRPCClient)(nil)
+)
+
+// Client of the native gRPC API of one Zitadel instance. Errors are returned
+// as *APIError like those of the REST client, with the gRPC code mapped to
+// the HTTP status Zitadel's REST gateway would have answered.
+type GRPCClient struct {
+	conn *grpc.ClientConn
+
+	// Same as in Client; Logger logs the method name as rpc
+	Token  func(ctx context.Context) (string, error)
+	Logger *slog.Logger
+}
+
+// Create a gRPC client for the instance at baseURL; https URLs use TLS. The
+// connection is established lazily on the first call.
+func NewGRPCClient(baseURL string) (*GRPCClient, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", baseURL, err)
+	}
+	creds := insecure.NewCredentials()
+	port := "80"
+	if u.Scheme == "https" {
+		creds = credentials.NewTLS(&tls.Config{ServerName: u.Hostname()})
+		port = "443"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	conn, err := grpc.NewClient(net.JoinHostPort(u.Hostname(), port),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(wireCodec{})))
+	if err != nil {
+		return nil, fmt.Errorf("creating gRPC client for %s: %v", baseURL, err)
+	}
+	return &GRPCClient{conn: conn}, nil
+}
+
+// Close the connection
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// Call a unary method; orgID, when set, selects the organization the call acts in
+func (c *GRPCClient) invoke(ctx context.Context, method, orgID string, in, out interface{}) error {
+	md := metadata.MD{}
+	if orgID != "" {
+		md.Set("x-zitadel-orgid", orgID)
+	}
+	if c.Token != nil {
+		token, err := c.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("obtaining access token: %v", err)
+		}
+		md.Set("authorization", "Bearer "+token)
+	}
+
+	var header, trailer metadata.MD
+	start := time.Now()
+	err := c.conn.Invoke(metadata.NewOutgoingContext(ctx, md), method, in, out, grpc.Header(&header), grpc.Trailer(&trailer))
+	elapsed := time.Since(start)
+	if err == nil {
+		c.log(ctx, slog.String("rpc", method), slog.String("status", codes.OK.String()), slog.Duration("latency", elapsed))
+		return nil
+	}
+
+	// Report the cause like the REST client does when ctx ends a request
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("calling %s: %w", method, ctxErr)
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("calling %s: %w", method, err)
+	}
+
+	apiErr := &APIError{
+		Method:     "gRPC",
+		Path:       method,
+		StatusCode: httpStatusFromCode(st.Code()),
+		Code:       int(st.Code()),
+		Message:    st.Message(),
+	}
+	for _, md := range []metadata.MD{header, trailer} {
+		if values := md.Get("retry-after"); len(values) > 0 {
+			apiErr.RetryAfter = parseRetryAfter(values[0])
+		}
+	}
+	c.log(ctx, slog.String("rpc", method), slog.String("status", st.Code().String()), slog.Duration("latency", elapsed), slog.String("body", st.Message()))
+	return apiErr
+}
+
+func (c *GRPCClient) log(ctx context.Context, attrs ...slog.Attr) {
+	if c.Logger != nil {
+		c.Logger.LogAttrs(ctx, slog.LevelDebug, "response", attrs...)
+	}
+}
+
+// HTTP status Zitadel's REST gateway answers for a gRPC code
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// gRPC code for an HTTP status, for error responses carrying no code
+func codeFromHTTPStatus(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if statusCode >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// Full names of the gRPC methods used
+const (
+	managementService = "/zitadel.management.v1.ManagementService/"
+	orgService        = "/zitadel.org.v2.OrganizationService/"
+	userService       = "/zitadel.user.v2.UserService/"
+	sessionService    = "/zitadel.session.v2.SessionService/"
+
+	methodAddOrg            = managementService + "AddOrg"
+	methodAddProject        = managementService + "AddProject"
+	methodListProjects      = managementService + "ListProjects"
+	methodAddAPIApp         = managementService + "AddAPIApp"
+	methodListApps          = managementService + "ListApps"
+	methodListUsersV1       = managementService + "ListUsers"
+	methodListOrganizations = orgService + "ListOrganizations"
+	methodAddHumanUser      = userService + "AddHumanUser"
+	methodGetUserByID       = userService + "GetUserByID"
+	methodUpdateHumanUser   = userService + "UpdateHumanUser"
+	methodDeleteUser        = userService + "DeleteUser"
+	methodListUsers         = userService + "ListUsers"
+	methodCreateSession     = sessionService + "CreateSession"
+)
+
+// Messages whose protobuf layout differs from the REST body, because path
+// parameters are part of the message or field numbers differ between
+// services. The json tags match the REST body so that the gateway can
+// translate them.
+
+type addAPIAppMessage struct {
+	ProjectID string `json:"-" pb:"1"`
+	AddAPIAppRequest
+}
+
+type listOrganizationsMessage struct {
+	Query   *ListQuery    `json:"query,omitempty" pb:"1"`
+	Queries []SearchQuery `json:"queries,omitempty" pb:"3"`
+}
+
+type listProjectsMessage struct {
+	Query   *ListQuery    `json:"query,omitempty" pb:"1"`
+	Queries []SearchQuery `json:"queries,omitempty" pb:"2"`
+}
+
+type listAppsMessage struct {
+	ProjectID string        `json:"-" pb:"1"`
+	Query     *ListQuery    `json:"query,omitempty" pb:"2"`
+	Queries   []SearchQuery `json:"queries,omitempty" pb:"3"`
+}
+
+type userIDMessage struct {
+	UserID string `json:"-" pb:"1"`
+}
+
+type updateHumanUserMessage struct {
+	UserID string `json:"-" pb:"1"`
+	UpdateHumanUserRequest
+}
+
+type emptyMessage struct{}
+
+type organizationMessage struct {
+	ID   string `json:"id" pb:"1"`
+	Name string `json:"name" pb:"4"`
+}
+
+type projectMessage struct {
+	ID   string `json:"id" pb:"1"`
+	Name string `json:"name" pb:"3"`
+}
+
+type appMessage struct {
+	ID   string `json:"id" pb:"1"`
+	Name string `json:"name" pb:"4"`
+}
+
+type listOrganizationsResponseMessage struct {
+	Details ListDetails           `json:"details" pb:"1"`
+	Result  []organizationMessage `json:"result" pb:"3"`
+}
+
+type listProjectsResponseMessage struct {
+	Details ListDetails      `json:"details" pb:"1"`
+	Result  []projectMessage `json:"result" pb:"2"`
+}
+
+type listAppsResponseMessage struct {
+	Details ListDetails  `json:"details" pb:"1"`
+	Result  []appMessage `json:"result" pb:"2"`
+}
+
+// One gRPC method with the REST route Zitadel's gateway maps it to
+type grpcRoute struct {
+	httpMethod  string
+	path        func(req interface{}) string
+	hasBody     bool
+	newRequest  func() interface{}
+	newResponse func() interface{}
+}
+
+func staticPath(path string) func(interface{}) string {
+	return func(interface{}) string { return path }
+}
+
+var grpcRoutes = map[string]grpcRoute{
+	methodAddOrg: {"POST", staticPath("/management/v1/orgs"), true,
+		func() interface{} { return new(AddOrganizationRequest) }, func() interface{} { return new(AddOrganizationResponse) }},
+	methodAddProject: {"POST", staticPath("/management/v1/projects"), true,
+		func() interface{} { return new(AddProjectRequest) }, func() interface{} { return new(AddProjectResponse) }},
+	methodListProjects: {"POST", staticPath("/management/v1/projects/_search"), true,
+		func() interface{} { return new(listProjectsMessage) }, func() interface{} { return new(listProjectsResponseMessage) }},
+	methodAddAPIApp: {"POST", func(req interface{}) string {
+		return "/management/v1/projects/" + url.PathEscape(req.(*addAPIAppMessage).ProjectID) + "/apps/api"
+	}, true, func() interface{} { return new(addAPIAppMessage) }, func() interface{} { return new(AddAPIAppResponse) }},
+	methodListApps: {"POST", func(req interface{}) string {
+		return "/management/v1/projects/" + url.PathEscape(req.(*listAppsMessage).ProjectID) + "/apps/_search"
+	}, true, func() interface{} { return new(listAppsMessage) }, func() interface{} { return new(listAppsResponseMessage) }},
+	methodListUsersV1: {"POST", staticPath("/management/v1/users/_search"), true,
+		func() interface{} { return new(ListUsersRequest) }, func() interface{} { return new(ListUsersResponse) }},
+	methodListOrganizations: {"POST", staticPath("/v2/organizations/_search"), true,
+		func() interface{} { return new(listOrganizationsMessage) }, func() interface{} { return new(listOrganizationsResponseMessage) }},
+	methodAddHumanUser: {"POST", staticPath("/v2/users/human"), true,
+		func() interface{} { return new(AddHumanUserRequest) }, func() interface{} { return new(AddHumanUserResponse) }},
+	methodGetUserByID: {"GET", func(req interface{}) string {
+		return "/v2/users/" + url.PathEscape(req.(*userIDMessage).UserID)
+	}, false, func() interface{} { return new(userIDMessage) }, func() interface{} { return new(GetUserByIDResponse) }},
+	methodUpdateHumanUser: {"PUT", func(req interface{}) string {
+		return "/v2/users/human/" + url.PathEscape(req.(*updateHumanUserMessage).UserID)
+	}, true, func() interface{} { return new(updateHumanUserMessage) }, func() interface{} { return new(emptyMessage) }},
+	methodDeleteUser: {"DELETE", func(req interface{}) string {
+		return "/v2/users/" + url.PathEscape(req.(*userIDMessage).UserID)
+	}, false, func() interface{} { return new(userIDMessage) }, func() interface{} { return new(emptyMessage) }},
+	methodListUsers: {"POST", staticPath("/v2/users"), true,
+		func() interface{} { return new(ListUsersRequest) }, func() interface{} { return new(ListUsersResponse) }},
+	methodCreateSession: {"POST", staticPath("/v2/sessions"), true,
+		func() interface{} { return new(CreateSessionRequest) }, func() interface{} { return new(CreateSessionResponse) }},
+}
+
+// Convert the results of a name search to a SearchResponse
+func toSearchResponse(details ListDetails, n int, resource func(i int) NamedResource) *SearchResponse {
+	result := make([]NamedResource, n)
+	for i := range result {
+		result[i] = resource(i)
+	}
+	return &SearchResponse{Details: details, Result: result}
+}
+
+// Create an organization
+func (c *GRPCClient) AddOrganization(ctx context.Context, req AddOrganizationRequest) (*AddOrganizationResponse, error) {
+	var resp AddOrganizationResponse
+	if err := c.invoke(ctx, methodAddOrg, "", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Create a project in the organization
+func (c *GRPCClient) AddProject(ctx context.Context, orgID string, req AddProjectRequest) (*AddProjectResponse, error) {
+	var resp AddProjectResponse
+	if err := c.invoke(ctx, methodAddProject, orgID, &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search the projects of the organization
+func (c *GRPCClient) SearchProjects(ctx context.Context, orgID string, req SearchRequest) (*SearchResponse, error) {
+	var resp listProjectsResponseMessage
+	msg := listProjectsMessage{Query: req.Query, Queries: req.Queries}
+	if err := c.invoke(ctx, methodListProjects, orgID, &msg, &resp); err != nil {
+		return nil, err
+	}
+	return toSearchResponse(resp.Details, len(resp.Result), func(i int) NamedResource {
+		return NamedResource{ID: resp.Result[i].ID, Name: resp.Result[i].Name}
+	}), nil
+}
+
+// Create an API application in the project
+func (c *GRPCClient) AddAPIApp(ctx context.Context, orgID, projectID string, req AddAPIAppRequest) (*AddAPIAppResponse, error) {
+	var resp AddAPIAppResponse
+	msg := addAPIAppMessage{ProjectID: projectID, AddAPIAppRequest: req}
+	if err := c.invoke(ctx, methodAddAPIApp, orgID, &msg, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search the applications of the project
+func (c *GRPCClient) SearchApps(ctx context.Context, orgID, projectID string, req SearchRequest) (*SearchResponse, error) {
+	var resp listAppsResponseMessage
+	msg := listAppsMessage{ProjectID: projectID, Query: req.Query, Queries: req.Queries}
+	if err := c.invoke(ctx, methodListApps, orgID, &msg, &resp); err != nil {
+		return nil, err
+	}
+	return toSearchResponse(resp.Details, len(resp.Result), func(i int) NamedResource {
+		return NamedResource{ID: resp.Result[i].ID, Name: resp.Result[i].Name}
+	}), nil
+}
+
+// Search the users of the organization
+func (c *GRPCClient) SearchUsers(ctx context.Context, orgID string, req ListUsersRequest) (*ListUsersResponse, error) {
+	var resp ListUsersResponse
+	if err := c.invoke(ctx, methodListUsersV1, orgID, &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search organizations
+func (c *GRPCClient) ListOrganizations(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	var resp listOrganizationsResponseMessage
+	msg := listOrganizationsMessage{Query: req.Query, Queries: req.Queries}
+	if err := c.invoke(ctx, methodListOrganizations, "", &msg, &resp); err != nil {
+		return nil, err
+	}
+	return toSearchResponse(resp.Details, len(resp.Result), func(i int) NamedResource {
+		return NamedResource{ID: resp.Result[i].ID, Name: resp.Result[i].Name}
+	}), nil
+}
+
+// Create a human user in the organization given in the request
+func (c *GRPCClient) AddHumanUser(ctx context.Context, req AddHumanUserRequest) (*AddHumanUserResponse, error) {
+	var resp AddHumanUserResponse
+	if err := c.invoke(ctx, methodAddHumanUser, req.Organization.OrgID, &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Fetch a user
+func (c *GRPCClient) GetUserByID(ctx context.Context, userID string) (*GetUserByIDResponse, error) {
+	var resp GetUserByIDResponse
+	if err := c.invoke(ctx, methodGetUserByID, "", &userIDMessage{UserID: userID}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Update a human user
+func (c *GRPCClient) UpdateHumanUser(ctx context.Context, userID string, req UpdateHumanUserRequest) error {
+	msg := updateHumanUserMessage{UserID: userID, UpdateHumanUserRequest: req}
+	return c.invoke(ctx, methodUpdateHumanUser, "", &msg, &emptyMessage{})
+}
+
+// Delete a user
+func (c *GRPCClient) DeleteUser(ctx context.Context, userID string) error {
+	return c.invoke(ctx, methodDeleteUser, "", &userIDMessage{UserID: userID}, &emptyMessage{})
+}
+
+// Search users; orgID, when set, selects the organization the call acts in
+func (c *GRPCClient) ListUsers(ctx context.Context, orgID string, req ListUsersRequest) (*ListUsersResponse, error) {
+	var resp ListUsersResponse
+	if err := c.invoke(ctx, methodListUsers, orgID, &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Create a session, e.g. to log a user in with a password check
+func (c *GRPCClient) CreateSession(ctx context.Context, req CreateSessionRequest) (*CreateSessionResponse, error) {
+	var resp CreateSessionResponse
+	if err := c.invoke(ctx, methodCreateSession, "", &req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
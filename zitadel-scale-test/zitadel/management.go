@@ -0,0 +1,65 @@
+package zitadel
+
+import (
+	"context"
+	"net/url"
+)
+
+// Calls of the management API (/management/v1). Most of them act in the
+// organization given by orgID.
+
+// Create an organization
+func (c *Client) AddOrganization(ctx context.Context, req AddOrganizationRequest) (*AddOrganizationResponse, error) {
+	var resp AddOrganizationResponse
+	if err := c.do(ctx, "POST", "/management/v1/orgs", "", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Create a project in the organization
+func (c *Client) AddProject(ctx context.Context, orgID string, req AddProjectRequest) (*AddProjectResponse, error) {
+	var resp AddProjectResponse
+	if err := c.do(ctx, "POST", "/management/v1/projects", orgID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search the projects of the organization
+func (c *Client) SearchProjects(ctx context.Context, orgID string, req SearchRequest) (*SearchResponse, error) {
+	var resp SearchResponse
+	if err := c.do(ctx, "POST", "/management/v1/projects/_search", orgID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Create an API application in the project
+func (c *Client) AddAPIApp(ctx context.Context, orgID, projectID string, req AddAPIAppRequest) (*AddAPIAppResponse, error) {
+	var resp AddAPIAppResponse
+	path := "/management/v1/projects/" + url.PathEscape(projectID) + "/apps/api"
+	if err := c.do(ctx, "POST", path, orgID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search the applications of the project
+func (c *Client) SearchApps(ctx context.Context, orgID, projectID string, req SearchRequest) (*SearchResponse, error) {
+	var resp SearchResponse
+	path := "/management/v1/projects/" + url.PathEscape(projectID) + "/apps/_search"
+	if err := c.do(ctx, "POST", path, orgID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search the users of the organization
+func (c *Client) SearchUsers(ctx context.Context, orgID string, req ListUsersRequest) (*ListUsersResponse, error) {
+	var resp ListUsersResponse
+	if err := c.do(ctx, "POST", "/management/v1/users/_search", orgID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,330 @@
+package zitadel
+
+// Requests and responses of the calls used by the tests. The json tags give
+// the REST encoding, the pb tags the field numbers of the Zitadel protobuf
+// messages used by the gRPC transport (see wire.go).
+
+import "encoding/json"
+
+// Methods of text queries
+const (
+	TextQueryEquals     = "TEXT_QUERY_METHOD_EQUALS"
+	TextQueryStartsWith = "TEXT_QUERY_METHOD_STARTS_WITH"
+	TextQueryContains   = "TEXT_QUERY_METHOD_CONTAINS"
+)
+
+// Other enum values used in requests
+const (
+	APIAuthMethodBasic     = "API_AUTH_METHOD_TYPE_BASIC"
+	PrivateLabelingDefault = "PRIVATE_LABELING_SETTING_UNSPECIFIED"
+	UserStateActive        = "USER_STATE_ACTIVE"
+	UserFieldNameUserName  = "USER_FIELD_NAME_USER_NAME"
+)
+
+// Paging of list and search requests
+type ListQuery struct {
+	Offset string `json:"offset,omitempty" pb:"1,uint64"` // uint64, encoded as a string
+	Limit  int    `json:"limit,omitempty" pb:"2"`
+	Asc    bool   `json:"asc,omitempty" pb:"3"`
+}
+
+// Details of a list or search response
+type ListDetails struct {
+	TotalResult json.Number `json:"totalResult" pb:"1,uint64"`
+}
+
+// Details of a single object
+type ObjectDetails struct {
+	Sequence      json.Number `json:"sequence,omitempty" pb:"1,uint64"`
+	ResourceOwner string      `json:"resourceOwner" pb:"3"`
+}
+
+// Organizations
+
+type AddOrganizationRequest struct {
+	Name string `json:"name" pb:"1"`
+}
+
+type AddOrganizationResponse struct {
+	ID string `json:"id" pb:"1"`
+}
+
+// Projects and applications
+
+type AddProjectRequest struct {
+	Name                   string `json:"name" pb:"1"`
+	ProjectRoleAssertion   bool   `json:"projectRoleAssertion" pb:"2"`
+	ProjectRoleCheck       bool   `json:"projectRoleCheck" pb:"3"`
+	HasProjectCheck        bool   `json:"hasProjectCheck" pb:"4"`
+	PrivateLabelingSetting string `json:"privateLabelingSetting,omitempty" pb:"5,enum=PRIVATE_LABELING_SETTING_"`
+}
+
+type AddProjectResponse struct {
+	ID string `json:"id" pb:"1"`
+}
+
+type AddAPIAppRequest struct {
+	Name           string `json:"name" pb:"2"`
+	AuthMethodType string `json:"authMethodType" pb:"3,enum=API_AUTH_METHOD_TYPE_"`
+}
+
+type AddAPIAppResponse struct {
+	AppID        string `json:"appId" pb:"1"`
+	ClientID     string `json:"clientId" pb:"3"`
+	ClientSecret string `json:"clientSecret" pb:"4"`
+}
+
+// Search by name, used for organizations, projects and applications
+
+type NameQuery struct {
+	Name   string `json:"name" pb:"1"`
+	Method string `json:"method" pb:"2,enum=TEXT_QUERY_METHOD_"`
+}
+
+type SearchQuery struct {
+	NameQuery *NameQuery `json:"nameQuery,omitempty" pb:"1"`
+}
+
+type SearchRequest struct {
+	Query   *ListQuery    `json:"query,omitempty"`
+	Queries []SearchQuery `json:"queries,omitempty"`
+}
+
+// Search for the entities named exactly name
+func SearchByName(name string) SearchRequest {
+	return SearchRequest{Queries: []SearchQuery{{NameQuery: &NameQuery{Name: name, Method: TextQueryEquals}}}}
+}
+
+// Entity found by a search
+type NamedResource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type SearchResponse struct {
+	Details ListDetails     `json:"details"`
+	Result  []NamedResource `json:"result"`
+}
+
+// Users
+
+type Profile struct {
+	GivenName         string `json:"givenName" pb:"1"`
+	FamilyName        string `json:"familyName" pb:"2"`
+	NickName          string `json:"nickName,omitempty" pb:"3"`
+	DisplayName       string `json:"displayName,omitempty" pb:"4"`
+	PreferredLanguage string `json:"preferredLanguage,omitempty" pb:"5"`
+	Gender            string `json:"gender,omitempty" pb:"6,enum=GENDER_"`
+}
+
+type Email struct {
+	Email      string `json:"email" pb:"1"`
+	IsVerified bool   `json:"isVerified" pb:"4"`
+}
+
+type Phone struct {
+	Phone      string `json:"phone" pb:"1"`
+	IsVerified bool   `json:"isVerified" pb:"4"`
+}
+
+type Password struct {
+	Password       string `json:"password" pb:"1"`
+	ChangeRequired bool   `json:"changeRequired" pb:"2"`
+}
+
+type Organization struct {
+	OrgID string `json:"orgId" pb:"1"`
+}
+
+type AddHumanUserRequest struct {
+	UserID       string       `json:"userId,omitempty" pb:"1"`
+	Username     string       `json:"username" pb:"2"`
+	Organization Organization `json:"organization" pb:"3"`
+	Profile      Profile      `json:"profile" pb:"4"`
+	Email        Email        `json:"email" pb:"5"`
+	Phone        *Phone       `json:"phone,omitempty" pb:"10"`
+	Password     *Password    `json:"password,omitempty" pb:"7"`
+}
+
+type AddHumanUserResponse struct {
+	UserID string `json:"userId" pb:"1"`
+}
+
+type UpdateHumanUserRequest struct {
+	Profile *Profile `json:"profile,omitempty" pb:"3"`
+}
+
+type User struct {
+	UserID   string     `json:"userId" pb:"1"`
+	Username string     `json:"username" pb:"3"`
+	State    string     `json:"state" pb:"2,enum=USER_STATE_"`
+	Human    *HumanUser `json:"human,omitempty" pb:"6"`
+}
+
+// Human part of a user as returned by reads; nil for machine users
+type HumanUser struct {
+	Profile Profile    `json:"profile" pb:"1"`
+	Email   HumanEmail `json:"email" pb:"2"`
+	Phone   HumanPhone `json:"phone" pb:"3"`
+}
+
+type HumanEmail struct {
+	Email      string `json:"email" pb:"1"`
+	IsVerified bool   `json:"isVerified" pb:"2"`
+}
+
+type HumanPhone struct {
+	Phone      string `json:"phone" pb:"1"`
+	IsVerified bool   `json:"isVerified" pb:"2"`
+}
+
+type GetUserByIDResponse struct {
+	Details ObjectDetails `json:"details" pb:"1"`
+	User    User          `json:"user" pb:"2"`
+}
+
+// User search criteria; exactly one field is set per query
+type UserQuery struct {
+	UserNameQuery       *UserNameQuery       `json:"userNameQuery,omitempty" pb:"1"`
+	EmailQuery          *EmailQuery          `json:"emailQuery,omitempty" pb:"6"`
+	OrganizationIDQuery *OrganizationIDQuery `json:"organizationIdQuery,omitempty" pb:"15"`
+	StateQuery          *StateQuery          `json:"stateQuery,omitempty" pb:"7"`
+}
+
+type UserNameQuery struct {
+	UserName string `json:"userName" pb:"1"`
+	Method   string `json:"method" pb:"2,enum=TEXT_QUERY_METHOD_"`
+}
+
+type EmailQuery struct {
+	EmailAddress string `json:"emailAddress" pb:"1"`
+	Method       string `json:"method" pb:"2,enum=TEXT_QUERY_METHOD_"`
+}
+
+type OrganizationIDQuery struct {
+	OrganizationID string `json:"organizationId" pb:"1"`
+}
+
+type StateQuery struct {
+	State string `json:"state" pb:"1,enum=USER_STATE_"`
+}
+
+type ListUsersRequest struct {
+	Query         ListQuery   `json:"query" pb:"1"`
+	SortingColumn string      `json:"sortingColumn,omitempty" pb:"2,enum=USER_FIELD_NAME_"`
+	Queries       []UserQuery `json:"queries,omitempty" pb:"3"`
+}
+
+// Users are returned undecoded since the v2 and management APIs differ in
+// their representation; over gRPC every entry holds the protobuf encoding of
+// a user rather than JSON
+type ListUsersResponse struct {
+	Details ListDetails       `json:"details" pb:"1"`
+	Result  []json.RawMessage `json:"result" pb:"3"`
+}
+
+// Sessions
+
+type CheckUser struct {
+	LoginName string `json:"loginName" pb:"2"`
+}
+
+type CheckPassword struct {
+	Password string `json:"password" pb:"1"`
+}
+
+type SessionChecks struct {
+	User     *CheckUser     `json:"user,omitempty" pb:"1"`
+	Password *CheckPassword `json:"password,omitempty" pb:"2"`
+}
+
+type CreateSessionRequest struct {
+	Checks SessionChecks `json:"checks" pb:"1"`
+}
+
+type CreateSessionResponse struct {
+	SessionID    string `json:"sessionId" pb:"2"`
+	SessionToken string `json:"sessionToken" pb:"3"`
+}
+
+// Admin import (POST /admin/v1/import)
+
+type ImportDataRequest struct {
+	DataOrgs ImportDataOrgs `json:"dataOrgs"`
+	Timeout  string         `json:"timeout,omitempty"` // Duration the server works on the import, e.g. "10m"
+}
+
+type ImportDataOrgs struct {
+	Orgs []ImportDataOrg `json:"orgs"`
+}
+
+type ImportDataOrg struct {
+	OrgID      string            `json:"orgId"`
+	Org        ImportOrg         `json:"org"`
+	HumanUsers []ImportHumanUser `json:"humanUsers,omitempty"`
+}
+
+type ImportOrg struct {
+	Name string `json:"name"`
+}
+
+type ImportHumanUser struct {
+	UserID string                 `json:"userId"`
+	User   ImportHumanUserRequest `json:"user"`
+}
+
+// Human user of the management import, with the v1 field names
+type ImportHumanUserRequest struct {
+	UserName               string          `json:"userName"`
+	Profile                ImportProfile   `json:"profile"`
+	Email                  ImportEmail     `json:"email"`
+	Phone                  *ImportPhone    `json:"phone,omitempty"`
+	Password               string          `json:"password,omitempty"`
+	HashedPassword         *HashedPassword `json:"hashedPassword,omitempty"`
+	PasswordChangeRequired bool            `json:"passwordChangeRequired"`
+}
+
+type ImportProfile struct {
+	FirstName         string `json:"firstName"`
+	LastName          string `json:"lastName"`
+	NickName          string `json:"nickName,omitempty"`
+	DisplayName       string `json:"displayName,omitempty"`
+	PreferredLanguage string `json:"preferredLanguage,omitempty"`
+	Gender            string `json:"gender,omitempty"`
+}
+
+type ImportEmail struct {
+	Email           string `json:"email"`
+	IsEmailVerified bool   `json:"isEmailVerified"`
+}
+
+type ImportPhone struct {
+	Phone           string `json:"phone"`
+	IsPhoneVerified bool   `json:"isPhoneVerified"`
+}
+
+// Password hash in the modular crypt format, e.g. bcrypt "$2a$10$..."
+type HashedPassword struct {
+	Value string `json:"value"`
+}
+
+type ImportDataResponse struct {
+	Errors  []ImportDataError  `json:"errors,omitempty"`
+	Success *ImportDataSuccess `json:"success,omitempty"`
+}
+
+// Entity that could not be imported
+type ImportDataError struct {
+	Type    string `json:"type"` // "org", "human_user", ...
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+type ImportDataSuccess struct {
+	Orgs []ImportDataSuccessOrg `json:"orgs,omitempty"`
+}
+
+type ImportDataSuccessOrg struct {
+	OrgID        string   `json:"orgId"`
+	HumanUserIDs []string `json:"humanUserIds,omitempty"`
+}
@@ -0,0 +1,63 @@
+package zitadel
+
+import (
+	"context"
+	"net/url"
+)
+
+// Calls of the resource-based v2 API (/v2)
+
+// Search organizations
+func (c *Client) ListOrganizations(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	var resp SearchResponse
+	if err := c.do(ctx, "POST", "/v2/organizations/_search", "", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Create a human user in the organization given in the request
+func (c *Client) AddHumanUser(ctx context.Context, req AddHumanUserRequest) (*AddHumanUserResponse, error) {
+	var resp AddHumanUserResponse
+	if err := c.do(ctx, "POST", "/v2/users/human", req.Organization.OrgID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Fetch a user
+func (c *Client) GetUserByID(ctx context.Context, userID string) (*GetUserByIDResponse, error) {
+	var resp GetUserByIDResponse
+	if err := c.do(ctx, "GET", "/v2/users/"+url.PathEscape(userID), "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Update a human user
+func (c *Client) UpdateHumanUser(ctx context.Context, userID string, req UpdateHumanUserRequest) error {
+	return c.do(ctx, "PUT", "/v2/users/human/"+url.PathEscape(userID), "", req, nil)
+}
+
+// Delete a user
+func (c *Client) DeleteUser(ctx context.Context, userID string) error {
+	return c.do(ctx, "DELETE", "/v2/users/"+url.PathEscape(userID), "", nil, nil)
+}
+
+// Search users; orgID, when set, selects the organization the request acts in
+func (c *Client) ListUsers(ctx context.Context, orgID string, req ListUsersRequest) (*ListUsersResponse, error) {
+	var resp ListUsersResponse
+	if err := c.do(ctx, "POST", "/v2/users", orgID, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Create a session, e.g. to log a user in with a password check
+func (c *Client) CreateSession(ctx context.Context, req CreateSessionRequest) (*CreateSessionResponse, error) {
+	var resp CreateSessionResponse
+	if err := c.do(ctx, "POST", "/v2/sessions", "", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,340 @@
+package zitadel
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf encoding of the typed requests and responses, driven by pb struct
+// tags instead of generated code: `pb:"N"` gives the field number,
+// `pb:"N,enum=PREFIX_"` encodes a string as the value of the enum constant of
+// that name and `pb:"N,uint64"` a decimal string as uint64. Fields without a
+// pb tag are not encoded, embedded structs without one are inlined. Scalars
+// holding their zero value are omitted as in proto3.
+
+// Values of the enum constants used in the typed requests and responses
+var enumValues = map[string]int32{
+	"TEXT_QUERY_METHOD_EQUALS":                                        0,
+	"TEXT_QUERY_METHOD_EQUALS_IGNORE_CASE":                            1,
+	"TEXT_QUERY_METHOD_STARTS_WITH":                                   2,
+	"TEXT_QUERY_METHOD_STARTS_WITH_IGNORE_CASE":                       3,
+	"TEXT_QUERY_METHOD_CONTAINS":                                      4,
+	"TEXT_QUERY_METHOD_CONTAINS_IGNORE_CASE":                          5,
+	"TEXT_QUERY_METHOD_ENDS_WITH":                                     6,
+	"TEXT_QUERY_METHOD_ENDS_WITH_IGNORE_CASE":                         7,
+	"USER_STATE_UNSPECIFIED":                                          0,
+	"USER_STATE_ACTIVE":                                               1,
+	"USER_STATE_INACTIVE":                                             2,
+	"USER_STATE_DELETED":                                              3,
+	"USER_STATE_LOCKED":                                               4,
+	"USER_STATE_INITIAL":                                              5,
+	"USER_FIELD_NAME_UNSPECIFIED":                                     0,
+	"USER_FIELD_NAME_USER_NAME":                                       1,
+	"API_AUTH_METHOD_TYPE_BASIC":                                      0,
+	"API_AUTH_METHOD_TYPE_PRIVATE_KEY_JWT":                            1,
+	"PRIVATE_LABELING_SETTING_UNSPECIFIED":                            0,
+	"PRIVATE_LABELING_SETTING_ENFORCE_PROJECT_RESOURCE_OWNER_POLICY":  1,
+	"PRIVATE_LABELING_SETTING_ALLOW_LOGIN_USER_RESOURCE_OWNER_POLICY": 2,
+	"GENDER_UNSPECIFIED":                                              0,
+	"GENDER_FEMALE":                                                   1,
+	"GENDER_MALE":                                                     2,
+	"GENDER_DIVERSE":                                                  3,
+}
+
+// Name of the constant with value n among the enum constants starting with prefix
+func enumName(prefix string, n int32) string {
+	for name, value := range enumValues {
+		if value == n && strings.HasPrefix(name, prefix) {
+			return name
+		}
+	}
+	return prefix + strconv.Itoa(int(n))
+}
+
+// Encoding of one tagged struct field
+type wireField struct {
+	num    protowire.Number
+	index  []int  // Index sequence for reflect.Value.FieldByIndex
+	enum   string // Prefix of the enum constants, empty for non-enum fields
+	uint64 bool   // Decimal string encoded as uint64
+}
+
+var wireFieldCache sync.Map // reflect.Type -> []wireField
+
+// Tagged fields of a struct type, including those of untagged embedded structs
+func wireFields(t reflect.Type) []wireField {
+	if cached, ok := wireFieldCache.Load(t); ok {
+		return cached.([]wireField)
+	}
+	var fields []wireField
+	var collect func(t reflect.Type, prefix []int)
+	collect = func(t reflect.Type, prefix []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			index := append(append([]int(nil), prefix...), i)
+			tag := sf.Tag.Get("pb")
+			if tag == "" {
+				if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+					collect(sf.Type, index)
+				}
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			num, err := strconv.Atoi(parts[0])
+			if err != nil {
+				panic(fmt.Sprintf("zitadel: invalid pb tag %q on %s.%s", tag, t.Name(), sf.Name))
+			}
+			f := wireField{num: protowire.Number(num), index: index}
+			for _, opt := range parts[1:] {
+				switch {
+				case strings.HasPrefix(opt, "enum="):
+					f.enum = strings.TrimPrefix(opt, "enum=")
+				case opt == "uint64":
+					f.uint64 = true
+				}
+			}
+			fields = append(fields, f)
+		}
+	}
+	collect(t, nil)
+	wireFieldCache.Store(t, fields)
+	return fields
+}
+
+// Append the encoding of the struct v to b
+func marshalMessage(b []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for _, f := range wireFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		switch {
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+			for i := 0; i < fv.Len() && err == nil; i++ {
+				b, err = appendValue(b, f, fv.Index(i), true)
+			}
+		case fv.Kind() == reflect.Ptr:
+			if !fv.IsNil() {
+				b, err = appendValue(b, f, fv.Elem(), true)
+			}
+		default:
+			b, err = appendValue(b, f, fv, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Append one value of field f; zero scalars are only written when present is set
+func appendValue(b []byte, f wireField, v reflect.Value, present bool) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		var n uint64
+		switch {
+		case f.enum != "":
+			value, ok := enumValues[s]
+			if s != "" && (!ok || !strings.HasPrefix(s, f.enum)) {
+				return nil, fmt.Errorf("unknown %s value %q", strings.TrimSuffix(f.enum, "_"), s)
+			}
+			n = uint64(value)
+		case f.uint64:
+			if s != "" {
+				var err error
+				if n, err = strconv.ParseUint(s, 10, 64); err != nil {
+					return nil, fmt.Errorf("field %d: %v", f.num, err)
+				}
+			}
+		default:
+			if s == "" && !present {
+				return b, nil
+			}
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			return protowire.AppendString(b, s), nil
+		}
+		if n == 0 && !present {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, f.num, protowire.VarintType)
+		return protowire.AppendVarint(b, n), nil
+
+	case reflect.Bool:
+		if !v.Bool() && !present {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, f.num, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v.Bool())), nil
+
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if v.Int() == 0 && !present {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, f.num, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v.Int())), nil
+
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if v.Uint() == 0 && !present {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, f.num, protowire.VarintType)
+		return protowire.AppendVarint(b, v.Uint()), nil
+
+	case reflect.Struct:
+		inner, err := marshalMessage(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, f.num, protowire.BytesType)
+		return protowire.AppendBytes(b, inner), nil
+
+	case reflect.Slice: // Raw bytes, e.g. a json.RawMessage
+		if v.Len() == 0 && !present {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, f.num, protowire.BytesType)
+		return protowire.AppendBytes(b, v.Bytes()), nil
+	}
+	return nil, fmt.Errorf("field %d: unsupported type %s", f.num, v.Type())
+}
+
+// Decode b into the struct v; unknown fields are skipped
+func unmarshalMessage(b []byte, v reflect.Value) error {
+	fields := wireFields(v.Type())
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var f *wireField
+		for i := range fields {
+			if fields[i].num == num {
+				f = &fields[i]
+				break
+			}
+		}
+		if f == nil {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		fv := v.FieldByIndex(f.index)
+		var err error
+		switch {
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			n, err = consumeValue(b, typ, *f, elem)
+			fv.Set(reflect.Append(fv, elem))
+		case fv.Kind() == reflect.Ptr:
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			n, err = consumeValue(b, typ, *f, fv.Elem())
+		default:
+			n, err = consumeValue(b, typ, *f, fv)
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	// Absent enum fields hold the constant with value zero
+	for _, f := range fields {
+		if fv := v.FieldByIndex(f.index); f.enum != "" && fv.Kind() == reflect.String && fv.String() == "" {
+			fv.SetString(enumName(f.enum, 0))
+		}
+	}
+	return nil
+}
+
+// Decode one value of field f from b into v and return the number of bytes used
+func consumeValue(b []byte, typ protowire.Type, f wireField, v reflect.Value) (int, error) {
+	want := protowire.BytesType
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		want = protowire.VarintType
+	case reflect.String:
+		if f.enum != "" || f.uint64 {
+			want = protowire.VarintType
+		}
+	}
+	if typ != want {
+		return 0, fmt.Errorf("field %d: unexpected wire type %d", f.num, typ)
+	}
+
+	if want == protowire.VarintType {
+		x, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		switch v.Kind() {
+		case reflect.String:
+			if f.enum != "" {
+				v.SetString(enumName(f.enum, int32(x)))
+			} else {
+				v.SetString(strconv.FormatUint(x, 10))
+			}
+		case reflect.Bool:
+			v.SetBool(protowire.DecodeBool(x))
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			v.SetInt(int64(x))
+		default:
+			v.SetUint(x)
+		}
+		return n, nil
+	}
+
+	data, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(data))
+	case reflect.Struct:
+		if err := unmarshalMessage(data, v); err != nil {
+			return 0, err
+		}
+	case reflect.Slice:
+		v.SetBytes(append([]byte(nil), data...))
+	default:
+		return 0, fmt.Errorf("field %d: unsupported type %s", f.num, v.Type())
+	}
+	return n, nil
+}
+
+// gRPC codec encoding the tagged structs; it replaces the default proto codec,
+// so it is named "proto" to keep the application/grpc+proto content type
+type wireCodec struct{}
+
+func (wireCodec) Name() string { return "proto" }
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot encode %T as protobuf message", v)
+	}
+	return marshalMessage(nil, rv)
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode protobuf message into %T", v)
+	}
+	return unmarshalMessage(data, rv.Elem())
+}
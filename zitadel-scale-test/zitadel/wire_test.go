@@ -0,0 +1,450 @@
+package zitadel
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Descriptors of the Zitadel messages the client exchanges, transcribed from
+// the .proto files of zitadel/zitadel (proto/zitadel/...). Only the fields
+// the client reads or writes are required; the siblings listed keep the
+// codec from writing to a number that belongs to another field. Timestamps
+// and other messages the client never touches are left out.
+
+type protoField struct {
+	name     string
+	num      int32
+	typ      descriptorpb.FieldDescriptorProto_Type
+	typeName string // Message or enum of the field, fully qualified
+	repeated bool
+}
+
+func str(name string, num int32) protoField {
+	return protoField{name: name, num: num, typ: descriptorpb.FieldDescriptorProto_TYPE_STRING}
+}
+
+func boolean(name string, num int32) protoField {
+	return protoField{name: name, num: num, typ: descriptorpb.FieldDescriptorProto_TYPE_BOOL}
+}
+
+func u64(name string, num int32) protoField {
+	return protoField{name: name, num: num, typ: descriptorpb.FieldDescriptorProto_TYPE_UINT64}
+}
+
+func u32(name string, num int32) protoField {
+	return protoField{name: name, num: num, typ: descriptorpb.FieldDescriptorProto_TYPE_UINT32}
+}
+
+func msg(name string, num int32, typeName string) protoField {
+	return protoField{name: name, num: num, typ: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, typeName: typeName}
+}
+
+func enum(name string, num int32, typeName string) protoField {
+	return protoField{name: name, num: num, typ: descriptorpb.FieldDescriptorProto_TYPE_ENUM, typeName: typeName}
+}
+
+func repeated(f protoField) protoField {
+	f.repeated = true
+	return f
+}
+
+type protoFile struct {
+	pkg      string
+	deps     []string
+	messages map[string][]protoField
+	enums    map[string][]string // Constant names in the order of their values
+}
+
+func (f protoFile) descriptor() *descriptorpb.FileDescriptorProto {
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(f.pkg + ".proto"),
+		Package:    proto.String(f.pkg),
+		Dependency: f.deps,
+		Syntax:     proto.String("proto3"),
+	}
+	for name, values := range f.enums {
+		ed := &descriptorpb.EnumDescriptorProto{Name: proto.String(name)}
+		for i, value := range values {
+			ed.Value = append(ed.Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String(value), Number: proto.Int32(int32(i))})
+		}
+		fd.EnumType = append(fd.EnumType, ed)
+	}
+	for name, fields := range f.messages {
+		md := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		for _, field := range fields {
+			label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+			if field.repeated {
+				label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+			}
+			fdp := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(field.name),
+				Number: proto.Int32(field.num),
+				Label:  label.Enum(),
+				Type:   field.typ.Enum(),
+			}
+			if field.typeName != "" {
+				fdp.TypeName = proto.String("." + field.typeName)
+			}
+			md.Field = append(md.Field, fdp)
+		}
+		fd.MessageType = append(fd.MessageType, md)
+	}
+	return fd
+}
+
+var textQueryMethods = []string{
+	"TEXT_QUERY_METHOD_EQUALS", "TEXT_QUERY_METHOD_EQUALS_IGNORE_CASE",
+	"TEXT_QUERY_METHOD_STARTS_WITH", "TEXT_QUERY_METHOD_STARTS_WITH_IGNORE_CASE",
+	"TEXT_QUERY_METHOD_CONTAINS", "TEXT_QUERY_METHOD_CONTAINS_IGNORE_CASE",
+	"TEXT_QUERY_METHOD_ENDS_WITH", "TEXT_QUERY_METHOD_ENDS_WITH_IGNORE_CASE",
+}
+
+var zitadelProtos = []protoFile{
+	{
+		pkg: "zitadel.v1",
+		messages: map[string][]protoField{
+			"ListQuery":     {u64("offset", 1), u32("limit", 2), boolean("asc", 3)},
+			"ListDetails":   {u64("total_result", 1), u64("processed_sequence", 2)},
+			"ObjectDetails": {u64("sequence", 1), str("resource_owner", 4)},
+		},
+		enums: map[string][]string{"TextQueryMethod": textQueryMethods},
+	},
+	{
+		pkg: "zitadel.project.v1",
+		messages: map[string][]protoField{
+			"Project":          {str("id", 1), msg("details", 2, "zitadel.v1.ObjectDetails"), str("name", 3)},
+			"ProjectQuery":     {msg("name_query", 1, "zitadel.project.v1.ProjectNameQuery")},
+			"ProjectNameQuery": {str("name", 1), enum("method", 2, "zitadel.v1.TextQueryMethod")},
+		},
+		deps: []string{"zitadel.v1.proto"},
+		enums: map[string][]string{"PrivateLabelingSetting": {
+			"PRIVATE_LABELING_SETTING_UNSPECIFIED",
+			"PRIVATE_LABELING_SETTING_ENFORCE_PROJECT_RESOURCE_OWNER_POLICY",
+			"PRIVATE_LABELING_SETTING_ALLOW_LOGIN_USER_RESOURCE_OWNER_POLICY",
+		}},
+	},
+	{
+		pkg: "zitadel.app.v1",
+		messages: map[string][]protoField{
+			"App":          {str("id", 1), msg("details", 2, "zitadel.v1.ObjectDetails"), str("name", 4)},
+			"AppQuery":     {msg("name_query", 1, "zitadel.app.v1.AppNameQuery")},
+			"AppNameQuery": {str("name", 1), enum("method", 2, "zitadel.v1.TextQueryMethod")},
+		},
+		deps:  []string{"zitadel.v1.proto"},
+		enums: map[string][]string{"APIAuthMethodType": {"API_AUTH_METHOD_TYPE_BASIC", "API_AUTH_METHOD_TYPE_PRIVATE_KEY_JWT"}},
+	},
+	{
+		pkg: "zitadel.management.v1",
+		messages: map[string][]protoField{
+			"AddOrgRequest":  {str("name", 1)},
+			"AddOrgResponse": {str("id", 1), msg("details", 2, "zitadel.v1.ObjectDetails")},
+			"AddProjectRequest": {str("name", 1), boolean("project_role_assertion", 2), boolean("project_role_check", 3),
+				boolean("has_project_check", 4), enum("private_labeling_setting", 5, "zitadel.project.v1.PrivateLabelingSetting")},
+			"AddProjectResponse": {str("id", 1), msg("details", 2, "zitadel.v1.ObjectDetails")},
+			"ListProjectsRequest": {msg("query", 1, "zitadel.v1.ListQuery"),
+				repeated(msg("queries", 2, "zitadel.project.v1.ProjectQuery"))},
+			"ListProjectsResponse": {msg("details", 1, "zitadel.v1.ListDetails"),
+				repeated(msg("result", 2, "zitadel.project.v1.Project"))},
+			"AddAPIAppRequest": {str("project_id", 1), str("name", 2), enum("auth_method_type", 3, "zitadel.app.v1.APIAuthMethodType")},
+			"AddAPIAppResponse": {str("app_id", 1), msg("details", 2, "zitadel.v1.ObjectDetails"),
+				str("client_id", 3), str("client_secret", 4)},
+			"ListAppsRequest": {str("project_id", 1), msg("query", 2, "zitadel.v1.ListQuery"),
+				repeated(msg("queries", 3, "zitadel.app.v1.AppQuery"))},
+			"ListAppsResponse": {msg("details", 1, "zitadel.v1.ListDetails"),
+				repeated(msg("result", 2, "zitadel.app.v1.App"))},
+		},
+		deps: []string{"zitadel.v1.proto", "zitadel.project.v1.proto", "zitadel.app.v1.proto"},
+	},
+	{
+		pkg: "zitadel.object.v2",
+		messages: map[string][]protoField{
+			"Details":      {u64("sequence", 1), str("resource_owner", 3)},
+			"ListQuery":    {u64("offset", 1), u32("limit", 2), boolean("asc", 3)},
+			"ListDetails":  {u64("total_result", 1), u64("processed_sequence", 2)},
+			"Organization": {str("org_id", 1), str("org_domain", 2)},
+		},
+		enums: map[string][]string{"TextQueryMethod": textQueryMethods},
+	},
+	{
+		pkg: "zitadel.org.v2",
+		messages: map[string][]protoField{
+			"Organization":          {str("id", 1), msg("details", 2, "zitadel.object.v2.Details"), str("name", 4), str("primary_domain", 5)},
+			"SearchQuery":           {msg("name_query", 1, "zitadel.org.v2.OrganizationNameQuery")},
+			"OrganizationNameQuery": {str("name", 1), enum("method", 2, "zitadel.object.v2.TextQueryMethod")},
+			"ListOrganizationsRequest": {msg("query", 1, "zitadel.object.v2.ListQuery"),
+				repeated(msg("queries", 3, "zitadel.org.v2.SearchQuery"))},
+			"ListOrganizationsResponse": {msg("details", 1, "zitadel.object.v2.ListDetails"),
+				repeated(msg("result", 3, "zitadel.org.v2.Organization"))},
+		},
+		deps: []string{"zitadel.object.v2.proto"},
+	},
+	{
+		pkg: "zitadel.user.v2",
+		messages: map[string][]protoField{
+			"SetHumanProfile": {str("given_name", 1), str("family_name", 2), str("nick_name", 3), str("display_name", 4),
+				str("preferred_language", 5), enum("gender", 6, "zitadel.user.v2.Gender")},
+			"SetHumanEmail": {str("email", 1), boolean("is_verified", 4)},
+			"SetHumanPhone": {str("phone", 1), boolean("is_verified", 4)},
+			"Password":      {str("password", 1), boolean("change_required", 2)},
+			"AddHumanUserRequest": {str("user_id", 1), str("username", 2), msg("organization", 3, "zitadel.object.v2.Organization"),
+				msg("profile", 4, "zitadel.user.v2.SetHumanProfile"), msg("email", 5, "zitadel.user.v2.SetHumanEmail"),
+				msg("password", 7, "zitadel.user.v2.Password"), msg("phone", 10, "zitadel.user.v2.SetHumanPhone")},
+			"AddHumanUserResponse": {str("user_id", 1), msg("details", 2, "zitadel.object.v2.Details"), str("email_code", 3), str("phone_code", 4)},
+			"UpdateHumanUserRequest": {str("user_id", 1), str("username", 2), msg("profile", 3, "zitadel.user.v2.SetHumanProfile"),
+				msg("email", 4, "zitadel.user.v2.SetHumanEmail"), msg("phone", 5, "zitadel.user.v2.SetHumanPhone")},
+			"GetUserByIDRequest":  {str("user_id", 1)},
+			"GetUserByIDResponse": {msg("details", 1, "zitadel.object.v2.Details"), msg("user", 2, "zitadel.user.v2.User")},
+			"User": {str("user_id", 1), enum("state", 2, "zitadel.user.v2.UserState"), str("username", 3),
+				repeated(str("login_names", 4)), str("preferred_login_name", 5), msg("human", 6, "zitadel.user.v2.HumanUser"),
+				msg("details", 8, "zitadel.object.v2.Details")},
+			"HumanUser": {msg("profile", 1, "zitadel.user.v2.HumanProfile"), msg("email", 2, "zitadel.user.v2.HumanEmail"),
+				msg("phone", 3, "zitadel.user.v2.HumanPhone"), boolean("password_change_required", 4)},
+			"HumanProfile": {str("given_name", 1), str("family_name", 2), str("nick_name", 3), str("display_name", 4),
+				str("preferred_language", 5), enum("gender", 6, "zitadel.user.v2.Gender"), str("avatar_url", 7)},
+			"HumanEmail": {str("email", 1), boolean("is_verified", 2)},
+			"HumanPhone": {str("phone", 1), boolean("is_verified", 2)},
+			"SearchQuery": {msg("user_name_query", 1, "zitadel.user.v2.UserNameQuery"), msg("email_query", 6, "zitadel.user.v2.EmailQuery"),
+				msg("state_query", 7, "zitadel.user.v2.StateQuery"), msg("organization_id_query", 15, "zitadel.user.v2.OrganizationIdQuery")},
+			"UserNameQuery":       {str("user_name", 1), enum("method", 2, "zitadel.object.v2.TextQueryMethod")},
+			"EmailQuery":          {str("email_address", 1), enum("method", 2, "zitadel.object.v2.TextQueryMethod")},
+			"StateQuery":          {enum("state", 1, "zitadel.user.v2.UserState")},
+			"OrganizationIdQuery": {str("organization_id", 1)},
+			"ListUsersRequest": {msg("query", 1, "zitadel.object.v2.ListQuery"), enum("sorting_column", 2, "zitadel.user.v2.UserFieldName"),
+				repeated(msg("queries", 3, "zitadel.user.v2.SearchQuery"))},
+		},
+		deps: []string{"zitadel.object.v2.proto"},
+		enums: map[string][]string{
+			"Gender":        {"GENDER_UNSPECIFIED", "GENDER_FEMALE", "GENDER_MALE", "GENDER_DIVERSE"},
+			"UserState":     {"USER_STATE_UNSPECIFIED", "USER_STATE_ACTIVE", "USER_STATE_INACTIVE", "USER_STATE_DELETED", "USER_STATE_LOCKED", "USER_STATE_INITIAL"},
+			"UserFieldName": {"USER_FIELD_NAME_UNSPECIFIED", "USER_FIELD_NAME_USER_NAME"},
+		},
+	},
+	{
+		pkg: "zitadel.session.v2",
+		messages: map[string][]protoField{
+			"CheckUser":            {str("user_id", 1), str("login_name", 2)},
+			"CheckPassword":        {str("password", 1)},
+			"Checks":               {msg("user", 1, "zitadel.session.v2.CheckUser"), msg("password", 2, "zitadel.session.v2.CheckPassword")},
+			"CreateSessionRequest": {msg("checks", 1, "zitadel.session.v2.Checks")},
+			"CreateSessionResponse": {msg("details", 1, "zitadel.object.v2.Details"), str("session_id", 2),
+				str("session_token", 3)},
+		},
+		deps: []string{"zitadel.object.v2.proto"},
+	},
+}
+
+func zitadelDescriptors(t *testing.T) *protoregistry.Files {
+	t.Helper()
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, f := range zitadelProtos {
+		set.File = append(set.File, f.descriptor())
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatalf("building descriptors: %v", err)
+	}
+	return files
+}
+
+// Encode v with the codec, decode it with the protobuf runtime as message,
+// compare it to want (protojson), then encode want with the runtime and
+// decode it with the codec back into a value equal to v
+func assertWireRoundTrip(t *testing.T, files *protoregistry.Files, message string, v interface{}, want string) {
+	t.Helper()
+	d, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		t.Fatalf("%s: %v", message, err)
+	}
+	desc := d.(protoreflect.MessageDescriptor)
+
+	data, err := wireCodec{}.Marshal(v)
+	if err != nil {
+		t.Fatalf("%s: encoding %T: %v", message, v, err)
+	}
+	got := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, got); err != nil {
+		t.Fatalf("%s: decoding the encoding of %T: %v", message, v, err)
+	}
+	assertNoUnknownFields(t, message, got)
+
+	expected := dynamicpb.NewMessage(desc)
+	if err := protojson.Unmarshal([]byte(want), expected); err != nil {
+		t.Fatalf("%s: invalid expectation: %v", message, err)
+	}
+	if !proto.Equal(got, expected) {
+		gotJSON, _ := protojson.Marshal(got)
+		t.Errorf("%s: %T encodes as %s, want %s", message, v, gotJSON, want)
+	}
+
+	data, err = proto.MarshalOptions{Deterministic: true}.Marshal(expected)
+	if err != nil {
+		t.Fatalf("%s: encoding the expectation: %v", message, err)
+	}
+	back := reflect.New(reflect.TypeOf(v).Elem())
+	if err := (wireCodec{}).Unmarshal(data, back.Interface()); err != nil {
+		t.Fatalf("%s: decoding into %T: %v", message, v, err)
+	}
+	if !reflect.DeepEqual(back.Interface(), v) {
+		gotJSON, _ := json.Marshal(back.Interface())
+		wantJSON, _ := json.Marshal(v)
+		t.Errorf("%s: decodes as %s, want %s", message, gotJSON, wantJSON)
+	}
+}
+
+// Fields unknown to the descriptors mean a wrong field number in a pb tag
+func assertNoUnknownFields(t *testing.T, message string, m protoreflect.Message) {
+	t.Helper()
+	if len(m.GetUnknown()) > 0 {
+		t.Errorf("%s: fields unknown to the descriptor: %x", message, m.GetUnknown())
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				assertNoUnknownFields(t, message+"."+string(fd.Name()), v.List().Get(i).Message())
+			}
+		default:
+			assertNoUnknownFields(t, message+"."+string(fd.Name()), v.Message())
+		}
+		return true
+	})
+}
+
+func TestWireMatchesZitadelDescriptors(t *testing.T) {
+	files := zitadelDescriptors(t)
+
+	query := &ListQuery{Offset: "20", Limit: 10, Asc: true}
+	nameQueries := []SearchQuery{{NameQuery: &NameQuery{Name: "scale-", Method: "TEXT_QUERY_METHOD_STARTS_WITH"}}}
+	profile := Profile{GivenName: "Ada", FamilyName: "Lovelace", NickName: "ada", DisplayName: "Ada L.",
+		PreferredLanguage: "en", Gender: "GENDER_FEMALE"}
+	profileJSON := `{"givenName":"Ada","familyName":"Lovelace","nickName":"ada","displayName":"Ada L.","preferredLanguage":"en","gender":"GENDER_FEMALE"}`
+
+	tests := []struct {
+		message string
+		value   interface{}
+		want    string
+	}{
+		{"zitadel.management.v1.AddOrgRequest", &AddOrganizationRequest{Name: "org-1"}, `{"name":"org-1"}`},
+		{"zitadel.management.v1.AddOrgResponse", &AddOrganizationResponse{ID: "100"}, `{"id":"100"}`},
+		{"zitadel.management.v1.AddProjectRequest",
+			&AddProjectRequest{Name: "p", ProjectRoleAssertion: true, ProjectRoleCheck: true, HasProjectCheck: true,
+				PrivateLabelingSetting: "PRIVATE_LABELING_SETTING_ENFORCE_PROJECT_RESOURCE_OWNER_POLICY"},
+			`{"name":"p","projectRoleAssertion":true,"projectRoleCheck":true,"hasProjectCheck":true,"privateLabelingSetting":"PRIVATE_LABELING_SETTING_ENFORCE_PROJECT_RESOURCE_OWNER_POLICY"}`},
+		{"zitadel.management.v1.AddProjectResponse", &AddProjectResponse{ID: "200"}, `{"id":"200"}`},
+		{"zitadel.management.v1.ListProjectsRequest", &listProjectsMessage{Query: query, Queries: nameQueries},
+			`{"query":{"offset":"20","limit":10,"asc":true},"queries":[{"nameQuery":{"name":"scale-","method":"TEXT_QUERY_METHOD_STARTS_WITH"}}]}`},
+		{"zitadel.management.v1.ListProjectsResponse",
+			&listProjectsResponseMessage{Details: ListDetails{TotalResult: "2"}, Result: []projectMessage{{ID: "1", Name: "a"}, {ID: "2", Name: "b"}}},
+			`{"details":{"totalResult":"2"},"result":[{"id":"1","name":"a"},{"id":"2","name":"b"}]}`},
+		{"zitadel.management.v1.AddAPIAppRequest",
+			&addAPIAppMessage{ProjectID: "200", AddAPIAppRequest: AddAPIAppRequest{Name: "api", AuthMethodType: "API_AUTH_METHOD_TYPE_PRIVATE_KEY_JWT"}},
+			`{"projectId":"200","name":"api","authMethodType":"API_AUTH_METHOD_TYPE_PRIVATE_KEY_JWT"}`},
+		{"zitadel.management.v1.AddAPIAppResponse", &AddAPIAppResponse{AppID: "300", ClientID: "c", ClientSecret: "s"},
+			`{"appId":"300","clientId":"c","clientSecret":"s"}`},
+		{"zitadel.management.v1.ListAppsRequest", &listAppsMessage{ProjectID: "200", Query: query, Queries: nameQueries},
+			`{"projectId":"200","query":{"offset":"20","limit":10,"asc":true},"queries":[{"nameQuery":{"name":"scale-","method":"TEXT_QUERY_METHOD_STARTS_WITH"}}]}`},
+		{"zitadel.management.v1.ListAppsResponse",
+			&listAppsResponseMessage{Details: ListDetails{TotalResult: "1"}, Result: []appMessage{{ID: "300", Name: "api"}}},
+			`{"details":{"totalResult":"1"},"result":[{"id":"300","name":"api"}]}`},
+		{"zitadel.org.v2.ListOrganizationsRequest", &listOrganizationsMessage{Query: query, Queries: nameQueries},
+			`{"query":{"offset":"20","limit":10,"asc":true},"queries":[{"nameQuery":{"name":"scale-","method":"TEXT_QUERY_METHOD_STARTS_WITH"}}]}`},
+		{"zitadel.org.v2.ListOrganizationsResponse",
+			&listOrganizationsResponseMessage{Details: ListDetails{TotalResult: "1"}, Result: []organizationMessage{{ID: "100", Name: "org-1"}}},
+			`{"details":{"totalResult":"1"},"result":[{"id":"100","name":"org-1"}]}`},
+		{"zitadel.user.v2.AddHumanUserRequest",
+			&AddHumanUserRequest{UserID: "u1", Username: "ada", Organization: Organization{OrgID: "100"}, Profile: profile,
+				Email: Email{Email: "ada@example.com", IsVerified: true}, Phone: &Phone{Phone: "+41791234567", IsVerified: true},
+				Password: &Password{Password: "Secr3t!pass", ChangeRequired: true}},
+			`{"userId":"u1","username":"ada","organization":{"orgId":"100"},"profile":` + profileJSON + `,` +
+				`"email":{"email":"ada@example.com","isVerified":true},"phone":{"phone":"+41791234567","isVerified":true},` +
+				`"password":{"password":"Secr3t!pass","changeRequired":true}}`},
+		{"zitadel.user.v2.AddHumanUserResponse", &AddHumanUserResponse{UserID: "u1"}, `{"userId":"u1"}`},
+		{"zitadel.user.v2.UpdateHumanUserRequest", &updateHumanUserMessage{UserID: "u1", UpdateHumanUserRequest: UpdateHumanUserRequest{Profile: &profile}},
+			`{"userId":"u1","profile":` + profileJSON + `}`},
+		{"zitadel.user.v2.GetUserByIDRequest", &userIDMessage{UserID: "u1"}, `{"userId":"u1"}`},
+		{"zitadel.user.v2.GetUserByIDResponse",
+			&GetUserByIDResponse{Details: ObjectDetails{Sequence: "7", ResourceOwner: "100"}, User: User{UserID: "u1", Username: "ada",
+				State: "USER_STATE_ACTIVE", Human: &HumanUser{Profile: profile, Email: HumanEmail{Email: "ada@example.com", IsVerified: true},
+					Phone: HumanPhone{Phone: "+41791234567", IsVerified: true}}}},
+			`{"details":{"sequence":"7","resourceOwner":"100"},"user":{"userId":"u1","username":"ada","state":"USER_STATE_ACTIVE",` +
+				`"human":{"profile":` + profileJSON + `,"email":{"email":"ada@example.com","isVerified":true},` +
+				`"phone":{"phone":"+41791234567","isVerified":true}}}}`},
+		{"zitadel.user.v2.ListUsersRequest",
+			&ListUsersRequest{Query: *query, SortingColumn: "USER_FIELD_NAME_USER_NAME", Queries: []UserQuery{
+				{UserNameQuery: &UserNameQuery{UserName: "ada", Method: "TEXT_QUERY_METHOD_EQUALS"}},
+				{EmailQuery: &EmailQuery{EmailAddress: "ada@example.com", Method: "TEXT_QUERY_METHOD_EQUALS_IGNORE_CASE"}},
+				{OrganizationIDQuery: &OrganizationIDQuery{OrganizationID: "100"}},
+				{StateQuery: &StateQuery{State: "USER_STATE_ACTIVE"}},
+			}},
+			`{"query":{"offset":"20","limit":10,"asc":true},"sortingColumn":"USER_FIELD_NAME_USER_NAME","queries":[` +
+				`{"userNameQuery":{"userName":"ada"}},` +
+				`{"emailQuery":{"emailAddress":"ada@example.com","method":"TEXT_QUERY_METHOD_EQUALS_IGNORE_CASE"}},` +
+				`{"organizationIdQuery":{"organizationId":"100"}},` +
+				`{"stateQuery":{"state":"USER_STATE_ACTIVE"}}]}`},
+		{"zitadel.session.v2.CreateSessionRequest",
+			&CreateSessionRequest{Checks: SessionChecks{User: &CheckUser{LoginName: "ada"}, Password: &CheckPassword{Password: "Secr3t!pass"}}},
+			`{"checks":{"user":{"loginName":"ada"},"password":{"password":"Secr3t!pass"}}}`},
+		{"zitadel.session.v2.CreateSessionResponse", &CreateSessionResponse{SessionID: "s1", SessionToken: "t"},
+			`{"sessionId":"s1","sessionToken":"t"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			assertWireRoundTrip(t, files, tt.message, tt.value, tt.want)
+		})
+	}
+}
+
+// Enum fields left empty decode as the constant with value zero, and unknown
+// constants are rejected instead of being sent as zero
+func TestWireEnums(t *testing.T) {
+	data, err := wireCodec{}.Marshal(&AddAPIAppRequest{Name: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got AddAPIAppRequest
+	if err := (wireCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.AuthMethodType != "API_AUTH_METHOD_TYPE_BASIC" {
+		t.Errorf("empty enum decoded as %q, want API_AUTH_METHOD_TYPE_BASIC", got.AuthMethodType)
+	}
+
+	if _, err := (wireCodec{}).Marshal(&AddAPIAppRequest{Name: "api", AuthMethodType: "GENDER_MALE"}); err == nil {
+		t.Error("encoding a constant of another enum succeeded")
+	}
+}
+
+// Fields the client does not know, e.g. added in a later Zitadel release, are
+// skipped
+func TestWireSkipsUnknownFields(t *testing.T) {
+	files := zitadelDescriptors(t)
+	d, err := files.FindDescriptorByName("zitadel.user.v2.AddHumanUserResponse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+	if err := protojson.Unmarshal([]byte(`{"userId":"u1","details":{"sequence":"3"},"emailCode":"123456"}`), m); err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got AddHumanUserResponse
+	if err := (wireCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != "u1" {
+		t.Errorf("UserID = %q, want u1", got.UserID)
+	}
+}